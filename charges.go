@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// chargesCache remembers the last pending-charges value Vultr returned. It is
+// served as is while younger than chargesCacheTTL, and as a stale fallback
+// when a live fetch fails.
+type chargesCache struct {
+	mu     sync.Mutex
+	value  float64
+	sample time.Time
+}
+
+func (c *chargesCache) store(value float64, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = value
+	c.sample = at
+}
+
+// load returns the cached value and when it was fetched; ok is false if
+// nothing has been cached yet.
+func (c *chargesCache) load() (value float64, sample time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value, c.sample, !c.sample.IsZero()
+}
+
+// fetchCharges returns the cached pending charges while they are younger than
+// chargesCacheTTL. Otherwise it asks Vultr, retrying quickly up to
+// chargesRetries times, and caches a successful result.
+func (a *app) fetchCharges(ctx context.Context) (float64, error) {
+	if a.chargesCacheTTL > 0 {
+		if cached, sample, ok := a.charges.load(); ok && a.clock().Now().Sub(sample) < a.chargesCacheTTL {
+			return cached, nil
+		}
+	}
+
+	var (
+		charges float64
+		err     error
+	)
+	for attempt := 0; ; attempt++ {
+		charges, err = a.vultr.pendingCharges(ctx)
+		if err == nil {
+			a.charges.store(charges, a.clock().Now())
+			return charges, nil
+		}
+		if attempt >= a.chargesRetries {
+			return 0, err
+		}
+		a.logger.Warn("pending charges fetch failed; retrying", "attempt", attempt+1, "error", err)
+		if !a.sleepWithContext(ctx, a.chargesRetryDelay) {
+			return 0, err
+		}
+	}
+}
@@ -2,62 +2,74 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 func (a *app) runDailyCleanup(ctx context.Context) {
-	now := time.Now()
-	next := firstCleanupRunTimeKST(now, a.cleanupLoc)
+	now := a.clock().Now()
+	next := firstCleanupRunTimeKST(now, a.cleanupLoc, a.schedule)
 	a.logger.Info("daily instance cleanup scheduler started",
-		"timezone", cleanupTimeZone,
+		"timezone", a.cleanupLoc.String(),
 		"startup_kst", now.In(a.cleanupLoc).Format(time.RFC3339),
 		"next_run_kst", next.In(a.cleanupLoc).Format(time.RFC3339),
 	)
 
 	for {
-		wait := time.Until(next)
-		if wait < 0 {
-			wait = 0
-		}
-
-		timer := time.NewTimer(wait)
-		select {
-		case <-ctx.Done():
-			timer.Stop()
+		if !a.waitUntil(ctx, next) {
 			a.logger.Info("daily instance cleanup scheduler stopped")
 			return
-		case <-timer.C:
-			now := time.Now()
-			windowStart, windowEnd := cleanupWindowBounds(now, a.cleanupLoc)
-			if !isWithinCleanupWindow(now, a.cleanupLoc) {
-				a.logger.Warn("skipping cleanup outside allowed window",
-					"window_start_kst", windowStart.In(a.cleanupLoc).Format(time.RFC3339),
-					"window_end_kst", windowEnd.In(a.cleanupLoc).Format(time.RFC3339),
-					"current_kst", now.In(a.cleanupLoc).Format(time.RFC3339),
-				)
-				next = nextCleanupTimeKST(now, a.cleanupLoc)
-				continue
-			}
+		}
 
-			a.logger.Warn("starting scheduled instance cleanup run",
-				"scheduled_kst", next.In(a.cleanupLoc).Format(time.RFC3339),
-				"started_kst", now.In(a.cleanupLoc).Format(time.RFC3339),
+		now := a.clock().Now()
+		windowStart, windowEnd := cleanupWindowBounds(now, a.cleanupLoc, a.schedule.window)
+		if !isWithinCleanupWindow(now, a.cleanupLoc, a.schedule.window) {
+			a.logger.Warn("skipping cleanup outside allowed window",
+				"window_start_kst", windowStart.In(a.cleanupLoc).Format(time.RFC3339),
 				"window_end_kst", windowEnd.In(a.cleanupLoc).Format(time.RFC3339),
+				"current_kst", now.In(a.cleanupLoc).Format(time.RFC3339),
 			)
-			a.reconcileDestroyAllInstances(ctx, windowEnd)
-			next = nextCleanupTimeKST(time.Now(), a.cleanupLoc)
+			next = nextCleanupTimeKST(now, a.cleanupLoc, a.schedule.cleanupAt)
+			continue
+		}
+
+		if !a.runs.begin() {
+			a.logger.Info("skipping scheduled cleanup run: shutdown in progress")
+			next = nextCleanupTimeKST(now, a.cleanupLoc, a.schedule.cleanupAt)
+			continue
 		}
+
+		a.logger.Warn("starting scheduled instance cleanup run",
+			"scheduled_kst", next.In(a.cleanupLoc).Format(time.RFC3339),
+			"started_kst", now.In(a.cleanupLoc).Format(time.RFC3339),
+			"drift", now.Sub(next).String(),
+			"window_end_kst", windowEnd.In(a.cleanupLoc).Format(time.RFC3339),
+		)
+		a.scheduler.startRun("cleanup", next, now)
+		a.recordInstanceUsage(ctx)
+		err := a.reconcileDestroyAllInstances(ctx, windowEnd)
+		a.completeRun(ctx, "cleanup", &a.cleanupFailures, err)
+		a.runs.end()
+		next = nextCleanupTimeKST(a.clock().Now(), a.cleanupLoc, a.schedule.cleanupAt)
 	}
 }
 
-func nextCleanupTimeKST(now time.Time, loc *time.Location) time.Time {
+// nextCleanupTimeKST returns the first daily cleanup at time of day at that
+// comes after now.
+func nextCleanupTimeKST(now time.Time, loc *time.Location, at timeOfDay) time.Time {
 	localNow := now.In(loc)
 	scheduled := time.Date(
 		localNow.Year(),
 		localNow.Month(),
 		localNow.Day(),
-		cleanupHourKST,
-		cleanupMinuteKST,
+		at.Hour,
+		at.Minute,
 		0,
 		0,
 		loc,
@@ -70,9 +82,13 @@ func nextCleanupTimeKST(now time.Time, loc *time.Location) time.Time {
 	return scheduled
 }
 
-func firstCleanupRunTimeKST(now time.Time, loc *time.Location) time.Time {
-	if !isWithinCleanupWindow(now, loc) {
-		return nextCleanupTimeKST(now, loc)
+// firstCleanupRunTimeKST is when the cleanup scheduler first runs after a
+// start at now: right away when it starts inside the window after today's run
+// time, otherwise at the next run time.
+func firstCleanupRunTimeKST(now time.Time, loc *time.Location, schedule dailySchedule) time.Time {
+	at := schedule.cleanupAt
+	if !isWithinCleanupWindow(now, loc, schedule.window) {
+		return nextCleanupTimeKST(now, loc, at)
 	}
 
 	localNow := now.In(loc)
@@ -80,8 +96,8 @@ func firstCleanupRunTimeKST(now time.Time, loc *time.Location) time.Time {
 		localNow.Year(),
 		localNow.Month(),
 		localNow.Day(),
-		cleanupHourKST,
-		cleanupMinuteKST,
+		at.Hour,
+		at.Minute,
 		0,
 		0,
 		loc,
@@ -93,14 +109,15 @@ func firstCleanupRunTimeKST(now time.Time, loc *time.Location) time.Time {
 	return scheduledToday
 }
 
-func cleanupWindowBounds(now time.Time, loc *time.Location) (time.Time, time.Time) {
+// cleanupWindowBounds returns window as times on the day of now.
+func cleanupWindowBounds(now time.Time, loc *time.Location, window timeWindow) (time.Time, time.Time) {
 	localNow := now.In(loc)
 	windowStart := time.Date(
 		localNow.Year(),
 		localNow.Month(),
 		localNow.Day(),
-		cleanupWindowStartHourKST,
-		cleanupWindowStartMinuteKST,
+		window.Start.Hour,
+		window.Start.Minute,
 		0,
 		0,
 		loc,
@@ -109,8 +126,8 @@ func cleanupWindowBounds(now time.Time, loc *time.Location) (time.Time, time.Tim
 		localNow.Year(),
 		localNow.Month(),
 		localNow.Day(),
-		cleanupWindowEndHourKST,
-		cleanupWindowEndMinuteKST,
+		window.End.Hour,
+		window.End.Minute,
 		0,
 		0,
 		loc,
@@ -118,8 +135,8 @@ func cleanupWindowBounds(now time.Time, loc *time.Location) (time.Time, time.Tim
 	return windowStart, windowEnd
 }
 
-func isWithinCleanupWindow(now time.Time, loc *time.Location) bool {
-	windowStart, windowEnd := cleanupWindowBounds(now, loc)
+func isWithinCleanupWindow(now time.Time, loc *time.Location, window timeWindow) bool {
+	windowStart, windowEnd := cleanupWindowBounds(now, loc, window)
 	localNow := now.In(loc)
 	if localNow.Before(windowStart) {
 		return false
@@ -127,106 +144,616 @@ func isWithinCleanupWindow(now time.Time, loc *time.Location) bool {
 	return localNow.Before(windowEnd)
 }
 
-func (a *app) reconcileDestroyAllInstances(ctx context.Context, cutoff time.Time) {
+// reconcileDestroyAllInstances deletes instances until none remain, first on
+// the primary account and then on the secondary one when configured. It
+// returns nil once every account is clean (or cleanup was intentionally
+// skipped), errCleanupWindowClosed if the cutoff arrives first, or the context
+// error.
+func (a *app) reconcileDestroyAllInstances(ctx context.Context, cutoff time.Time) error {
+	if a.cleanupAllInstances && a.cleanupRequireDestroyAllAck {
+		a.logger.Error("refusing account-wide cleanup without acknowledgment",
+			"acknowledge_with", destroyAllAckEnv+"=yes",
+			"or_limit_with", cleanupScopeEnv+"=prefix",
+		)
+		return errDestroyAllNotAcknowledged
+	}
+	if a.readOnly {
+		a.logger.Warn("read-only mode; skipping cleanup reconciliation")
+		return nil
+	}
+
+	err := a.sweepAccount(ctx, a.vultr, provisionBlockStorageID, cutoff)
+	if a.secondaryVultr == nil || ctx.Err() != nil {
+		return err
+	}
+
+	a.logger.Info("cleanup reconciliation checking secondary account")
+	return errors.Join(err, a.sweepAccount(ctx, a.secondaryVultr, a.secondaryBlockStorageID, cutoff))
+}
+
+// sweepAccount deletes the account's instances and, with cleanupDeep, then
+// releases the resources they leave behind. With snapshotCarryOver it first
+// snapshots the primary account's instance for the next provision.
+func (a *app) sweepAccount(ctx context.Context, client *vultrClient, blockStorageID string, cutoff time.Time) error {
+	if a.snapshotCarryOver && !a.cleanupDryRun && client == a.vultr {
+		if err := a.snapshotBeforeCleanup(ctx, client, cutoff); err != nil {
+			a.logger.Error("snapshot before cleanup failed; the previous snapshot stays the boot source", "error", err)
+		}
+	}
+	if err := a.destroyAllInstances(ctx, client, blockStorageID, cutoff); err != nil || !a.cleanupDeep || a.cleanupDryRun {
+		return err
+	}
+	return a.deepCleanup(ctx, client, blockStorageID)
+}
+
+// detachBlockBeforeDelete detaches the managed block storage when Vultr
+// reports it attached to instanceID, which cleanup is about to delete. Vultr
+// can leave a volume in a bad state when its instance is deleted with it still
+// attached. Failures are only logged: the delete goes ahead either way.
+func (a *app) detachBlockBeforeDelete(ctx context.Context, client *vultrClient, blockStorageID, instanceID string) {
+	if blockStorageID == "" {
+		return
+	}
+	block, err := client.getBlockStorage(ctx, blockStorageID)
+	if err != nil {
+		a.logger.Error("failed to look up block storage before cleanup", "block_storage_id", blockStorageID, "error", err)
+		return
+	}
+	if block.AttachedToInstance != instanceID {
+		return
+	}
+
+	err = client.detachBlockStorage(ctx, blockStorageID, true)
+	switch {
+	case err == nil:
+		a.logger.Warn("detached block storage before deleting its instance",
+			"block_storage_id", blockStorageID,
+			"instance_id", instanceID,
+		)
+	case isBlockNotAttachedError(err):
+		a.logger.Info("block storage already detached; continuing",
+			"block_storage_id", blockStorageID,
+			"instance_id", instanceID,
+		)
+	default:
+		a.logger.Error("failed to detach block storage before cleanup; deleting its instance anyway",
+			"block_storage_id", blockStorageID,
+			"instance_id", instanceID,
+			"error", err,
+		)
+	}
+}
+
+// deepCleanup detaches the managed block storage and releases unattached
+// paropal- reserved IPs. It only acts once no cleanup targets remain, so a run
+// that deleted nothing (e.g. skipped on pending charges) leaves them alone.
+func (a *app) deepCleanup(ctx context.Context, client *vultrClient, blockStorageID string) error {
+	instances, err := client.listAllInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("deep cleanup: list instances: %w", err)
+	}
+	if remaining := a.cleanupTargets(instances); len(remaining) > 0 {
+		a.logger.Warn("skipping deep cleanup: instances remain", "remaining", len(remaining))
+		return nil
+	}
+
+	var errs []error
+	if blockStorageID != "" {
+		block, err := client.getBlockStorage(ctx, blockStorageID)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("deep cleanup: get block storage: %w", err))
+		case block.AttachedToInstance != "":
+			if err := client.detachBlockStorage(ctx, blockStorageID, true); err != nil {
+				errs = append(errs, fmt.Errorf("deep cleanup: detach block storage: %w", err))
+			} else {
+				a.logger.Warn("detached block storage",
+					"block_storage_id", blockStorageID,
+					"instance_id", block.AttachedToInstance,
+				)
+			}
+		}
+	}
+
+	ips, err := client.listReservedIPs(ctx)
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("deep cleanup: list reserved ips: %w", err))...)
+	}
+	for _, ip := range ips {
+		if !strings.HasPrefix(ip.Label, labelPrefix) {
+			continue
+		}
+		if ip.InstanceID != "" {
+			a.logger.Warn("keeping reserved ip still attached to an instance",
+				"reserved_ip_id", ip.ID,
+				"label", ip.Label,
+				"instance_id", ip.InstanceID,
+			)
+			continue
+		}
+		if err := client.deleteReservedIP(ctx, ip.ID); err != nil {
+			errs = append(errs, fmt.Errorf("deep cleanup: release reserved ip %s: %w", ip.ID, err))
+			continue
+		}
+		a.logger.Warn("released reserved ip", "reserved_ip_id", ip.ID, "label", ip.Label, "subnet", ip.Subnet)
+	}
+	return errors.Join(errs...)
+}
+
+func (a *app) destroyAllInstances(ctx context.Context, client *vultrClient, blockStorageID string, cutoff time.Time) error {
 	backoff := a.cleanupBackoffMin
+	settle := a.cleanupSettleDelay
+	previousCount := -1
+	var maintenanceBackoff time.Duration
+
+	if a.cleanupRequirePendingCharges {
+		charges, err := client.pendingCharges(ctx)
+		switch {
+		case err != nil:
+			a.logger.Warn("could not check pending charges before cleanup; proceeding", "error", err)
+		case charges <= a.cleanupMinPendingCharges:
+			a.logger.Warn("skipping cleanup: pending charges do not exceed threshold",
+				"pending_charges", charges,
+				"threshold", a.cleanupMinPendingCharges,
+			)
+			return nil
+		}
+	}
 
 	for {
 		if err := ctx.Err(); err != nil {
-			return
+			return err
 		}
-		if !time.Now().Before(cutoff) {
+		if !a.clock().Now().Before(cutoff) {
 			a.logger.Warn("cleanup reconciliation stopped at window cutoff",
 				"cutoff_kst", cutoff.In(a.cleanupLoc).Format(time.RFC3339),
 			)
-			return
+			return errCleanupWindowClosed
+		}
+		if remaining := cutoff.Sub(a.clock().Now()); remaining < a.cleanupMinWindowRemaining {
+			a.logger.Warn("insufficient window remaining; not starting cleanup pass",
+				"remaining", remaining.Round(time.Second).String(),
+				"min_remaining", a.cleanupMinWindowRemaining.String(),
+				"cutoff_kst", cutoff.In(a.cleanupLoc).Format(time.RFC3339),
+			)
+			return errCleanupWindowClosed
 		}
 
-		instances, err := a.vultr.listAllInstances(ctx)
+		instances, err := client.listAllInstances(ctx)
+		incomplete := false
+		if err != nil && a.cleanupUsePartialList && errors.Is(err, errIncompleteInstanceList) {
+			a.logger.Warn("cleanup reconciliation acting on partial instance list", "count", len(instances), "error", err)
+			incomplete = true
+			err = nil
+		}
 		if err != nil {
-			a.logger.Error("cleanup reconciliation failed to list instances", "error", err, "retry_in", backoff.String())
-			if !sleepWithContextUntil(ctx, backoff, cutoff) {
-				return
+			if wait, ok := a.maintenanceWait(err, &maintenanceBackoff); ok {
+				if !a.sleepWithContextUntil(ctx, wait, cutoff) {
+					return cleanupStopError(ctx)
+				}
+				continue
+			}
+			maintenanceBackoff = 0
+			wait := rateLimitWait(err, a.backoffDelay(a.cleanupBackoffMin, backoff))
+			a.logger.Error("cleanup reconciliation failed to list instances", "error", err, "retry_in", wait.String())
+			if !a.sleepWithContextUntil(ctx, wait, cutoff) {
+				return cleanupStopError(ctx)
 			}
-			backoff = nextBackoff(backoff, a.cleanupBackoffMax)
+			backoff = nextBackoffScaled(backoff, a.cleanupBackoffMax, a.cleanupBackoffMultiplier)
 			continue
 		}
 
+		instances = a.cleanupTargets(instances)
 		if len(instances) == 0 {
 			a.logger.Info("cleanup reconciliation complete", "remaining_instances", 0)
-			return
+			return nil
+		}
+
+		if a.cleanupDryRun {
+			return a.cleanupDryRunPass(instances, cutoff)
 		}
 
 		a.logger.Warn("cleanup reconciliation deleting instances", "count", len(instances))
 
-		deleteFailures := 0
-		for _, instance := range instances {
-			if !time.Now().Before(cutoff) {
-				a.logger.Warn("cleanup reconciliation reached window cutoff during delete pass",
-					"cutoff_kst", cutoff.In(a.cleanupLoc).Format(time.RFC3339),
-				)
-				return
-			}
+		deleted, err := a.cleanupDeletePass(ctx, client, blockStorageID, instances, cutoff)
+		if err != nil {
+			return err
+		}
+		deleteFailures := len(instances) - len(deleted)
 
-			if instance.ID == "" {
-				deleteFailures++
-				a.logger.Error("cleanup reconciliation found instance without id", "label", instance.Label, "ip", instance.MainIP)
-				continue
+		if deleteFailures > 0 || incomplete {
+			wait := a.backoffDelay(a.cleanupBackoffMin, backoff)
+			a.logger.Warn("cleanup reconciliation pass incomplete", "delete_failures", deleteFailures, "partial_list", incomplete, "retry_in", wait.String())
+			if !a.sleepWithContextUntil(ctx, wait, cutoff) {
+				return cleanupStopError(ctx)
 			}
+			backoff = nextBackoffScaled(backoff, a.cleanupBackoffMax, a.cleanupBackoffMultiplier)
+			continue
+		}
 
-			err := a.vultr.deleteInstance(ctx, instance.ID)
-			if err != nil {
-				deleteFailures++
-				a.logger.Error("cleanup reconciliation failed to delete instance",
-					"instance_id", instance.ID,
-					"label", instance.Label,
-					"error", err,
-				)
-				continue
+		if a.cleanupConfirmDeletes && a.deletesConfirmed(ctx, client, deleted) {
+			a.logger.Info("cleanup reconciliation complete; every delete confirmed by lookup", "deleted", len(deleted))
+			return nil
+		}
+
+		if a.cleanupSeparateVerify {
+			return a.verifyCleanupUntilEmpty(ctx, client, blockStorageID, cutoff, deleted)
+		}
+
+		// With a settle cap configured, back off re-listing while the remaining
+		// count holds steady, and return to the base delay once it moves.
+		if a.cleanupSettleDelayMax > a.cleanupSettleDelay {
+			if len(instances) == previousCount {
+				settle = nextBackoffScaled(settle, a.cleanupSettleDelayMax, a.cleanupBackoffMultiplier)
+			} else {
+				settle = a.cleanupSettleDelay
 			}
+		}
+		previousCount = len(instances)
+
+		// Deletions are asynchronous upstream; allow state to settle before verifying again.
+		a.logger.Info("cleanup reconciliation waiting for deletes to settle",
+			"remaining_instances", len(instances),
+			"settle_delay", settle.String(),
+		)
+		if !a.sleepWithContextUntil(ctx, settle, cutoff) {
+			return cleanupStopError(ctx)
+		}
+		backoff = a.cleanupBackoffMin
+	}
+}
+
+// cleanupTargets narrows a listing to the instances cleanup may delete: only
+// paropal- instances by default, or every instance with cleanupAllInstances.
+// With cleanupOwnOnly, an instance must also carry this daemon's ID tag.
+// Instances whose label contains pinnedMarker are always spared.
+// Every instance gets a decision log line with its reason, at debug level
+// unless cleanupLogDecisions raises it to info.
+func (a *app) cleanupTargets(instances []vultrInstance) []vultrInstance {
+	targets := instances[:0:0]
+	for _, instance := range instances {
+		d := a.cleanupDecisionFor(instance)
+		a.logCleanupDecision(d.msg, instance, d.decision, d.reason, d.extra...)
+		if d.decision == "delete" {
+			targets = append(targets, instance)
+		}
+	}
+	return targets
+}
+
+// cleanupDecision is why cleanup will ("delete") or will not ("spare") delete
+// an instance.
+type cleanupDecision struct {
+	msg      string
+	decision string
+	reason   string
+	extra    []any
+}
+
+func (a *app) cleanupDecisionFor(instance vultrInstance) cleanupDecision {
+	ownTag := daemonTagPrefix + a.daemonID
+	if isPinnedLabel(instance.Label, a.pinnedMarker) {
+		return cleanupDecision{
+			msg:      "sparing pinned instance",
+			decision: "spare",
+			reason:   "label contains pinned marker " + a.pinnedMarker,
+		}
+	}
+	if !a.cleanupAllInstances && !strings.HasPrefix(instance.Label, labelPrefix) {
+		return cleanupDecision{
+			msg:      "sparing instance without paropal label prefix",
+			decision: "spare",
+			reason:   "label does not start with " + labelPrefix,
+		}
+	}
+	if a.cleanupOwnOnly && !slices.Contains(instance.Tags, ownTag) {
+		return cleanupDecision{
+			msg:      "sparing instance not tagged with this daemon's id",
+			decision: "spare",
+			reason:   "missing tag " + ownTag,
+			extra:    []any{"daemon_id", a.daemonID},
+		}
+	}
+
+	reason := "label starts with " + labelPrefix
+	if a.cleanupAllInstances {
+		reason = "account-wide cleanup scope"
+	}
+	if a.cleanupOwnOnly {
+		reason += " and tagged " + ownTag
+	}
+	return cleanupDecision{msg: "cleanup may delete instance", decision: "delete", reason: reason}
+}
+
+// isCleanupTarget reports whether cleanup would delete instance, without
+// logging the decision.
+func (a *app) isCleanupTarget(instance vultrInstance) bool {
+	return a.cleanupDecisionFor(instance).decision == "delete"
+}
+
+// logCleanupDecision records why cleanup will or will not delete instance.
+func (a *app) logCleanupDecision(msg string, instance vultrInstance, decision, reason string, extra ...any) {
+	level := slog.LevelDebug
+	if a.cleanupLogDecisions {
+		level = slog.LevelInfo
+	}
+	args := append([]any{
+		"instance_id", instance.ID,
+		"label", instance.Label,
+		"decision", decision,
+		"reason", reason,
+	}, extra...)
+	a.logger.Log(context.Background(), level, msg, args...)
+}
+
+// cleanupDryRunPass logs each instance a real pass would delete, still
+// stopping at the cutoff, and then a summary count.
+func (a *app) cleanupDryRunPass(instances []vultrInstance, cutoff time.Time) error {
+	candidates := 0
+	for _, instance := range instances {
+		if !a.clock().Now().Before(cutoff) {
+			a.logger.Warn("cleanup dry run reached window cutoff", "candidates", candidates)
+			return errCleanupWindowClosed
+		}
+		a.logger.Warn("cleanup dry run: would delete instance",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"status", instance.Status,
+		)
+		candidates++
+	}
+	a.logger.Warn("cleanup dry run complete; nothing deleted", "candidates", candidates)
+	return nil
+}
 
-			a.logger.Info("cleanup reconciliation delete requested", "instance_id", instance.ID, "label", instance.Label)
+// cleanupDeletePass requests deletion of each instance, stopping at the
+// cutoff. It returns the IDs whose delete was accepted. With
+// cleanupDeleteConcurrency above 1 the deletes are spread across that many
+// workers.
+func (a *app) cleanupDeletePass(ctx context.Context, client *vultrClient, blockStorageID string, instances []vultrInstance, cutoff time.Time) ([]string, error) {
+	if a.cleanupDeleteConcurrency > 1 {
+		return a.cleanupDeletePassConcurrent(ctx, client, blockStorageID, instances, cutoff)
+	}
+
+	deleted := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		ok, err := a.cleanupDeleteInstance(ctx, client, blockStorageID, instance, cutoff)
+		if ok {
+			deleted = append(deleted, instance.ID)
+		}
+		if err != nil {
+			return deleted, err
+		}
+	}
 
-			// Keep a short gap between delete calls to reduce burst rate against the API.
-			if !sleepWithContextUntil(ctx, a.cleanupPassDeleteInterval, cutoff) {
-				return
+	return deleted, nil
+}
+
+// cleanupDeletePassConcurrent is cleanupDeletePass with a pool of
+// cleanupDeleteConcurrency workers. The first worker to hit the cutoff or a
+// cancelled context stops the pass; workers finish their current delete.
+func (a *app) cleanupDeletePassConcurrent(ctx context.Context, client *vultrClient, blockStorageID string, instances []vultrInstance, cutoff time.Time) ([]string, error) {
+	var (
+		mu      sync.Mutex
+		deleted = make([]string, 0, len(instances))
+		stopErr error
+		wg      sync.WaitGroup
+	)
+	jobs := make(chan vultrInstance)
+	stop := make(chan struct{})
+
+	for range min(a.cleanupDeleteConcurrency, len(instances)) {
+		wg.Go(func() {
+			for instance := range jobs {
+				ok, err := a.cleanupDeleteInstance(ctx, client, blockStorageID, instance, cutoff)
+
+				mu.Lock()
+				if ok {
+					deleted = append(deleted, instance.ID)
+				}
+				if err != nil && stopErr == nil {
+					stopErr = err
+					close(stop)
+				}
+				mu.Unlock()
 			}
+		})
+	}
+
+feed:
+	for _, instance := range instances {
+		select {
+		case jobs <- instance:
+		case <-stop:
+			break feed
 		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return deleted, stopErr
+}
 
-		if deleteFailures > 0 {
-			a.logger.Warn("cleanup reconciliation pass incomplete", "delete_failures", deleteFailures, "retry_in", backoff.String())
-			if !sleepWithContextUntil(ctx, backoff, cutoff) {
-				return
+// cleanupDeleteInstance requests deletion of one instance and then waits out
+// cleanupPassDeleteInterval. With cleanupSnapshotBeforeDelete, a paropal
+// instance is snapshotted first and skipped if the snapshot fails. The
+// managed block is detached first if it is attached to the instance. It
+// reports whether the delete was accepted, and returns an error only when the
+// pass must stop: the cutoff was reached or ctx is done.
+func (a *app) cleanupDeleteInstance(ctx context.Context, client *vultrClient, blockStorageID string, instance vultrInstance, cutoff time.Time) (bool, error) {
+	if !a.clock().Now().Before(cutoff) {
+		a.logger.Warn("cleanup reconciliation reached window cutoff during delete pass",
+			"cutoff_kst", cutoff.In(a.cleanupLoc).Format(time.RFC3339),
+		)
+		return false, errCleanupWindowClosed
+	}
+
+	if instance.ID == "" {
+		a.logger.Error("cleanup reconciliation found instance without id", "label", instance.Label, "ip", instance.MainIP)
+		return false, nil
+	}
+
+	if a.cleanupSnapshotBeforeDelete && strings.HasPrefix(instance.Label, labelPrefix) {
+		snapshot, err := client.createSnapshot(ctx, instance.ID, "paropal cleanup of "+instance.Label)
+		if err != nil {
+			// Deleting without the snapshot would lose the instance's state, so
+			// leave it for a later pass.
+			a.logger.Error("cleanup reconciliation failed to snapshot instance; not deleting it",
+				"instance_id", instance.ID,
+				"label", instance.Label,
+				"error", err,
+			)
+			a.scheduler.addToRun("cleanup", 0, 0, 1)
+			a.metrics.collectors().deleteFailures.Inc()
+			return false, nil
+		}
+		a.logger.Warn("snapshot requested before delete",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"snapshot_id", snapshot.ID,
+		)
+		// Vultr takes the snapshot from the running instance; give it a
+		// moment to start before the delete lands.
+		if !a.sleepWithContextUntil(ctx, a.cleanupSnapshotDelay, cutoff) {
+			return false, cleanupStopError(ctx)
+		}
+	}
+
+	a.detachBlockBeforeDelete(ctx, client, blockStorageID, instance.ID)
+	err := client.deleteInstance(ctx, instance.ID)
+	if err != nil {
+		a.logger.Error("cleanup reconciliation failed to delete instance",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"error", err,
+		)
+		a.scheduler.addToRun("cleanup", 0, 0, 1)
+		a.metrics.collectors().deleteFailures.Inc()
+		if wait := rateLimitWait(err, 0); wait > 0 {
+			a.logger.Warn("cleanup reconciliation rate limited; pausing delete pass", "retry_after", wait.String())
+			if !a.sleepWithContextUntil(ctx, wait, cutoff) {
+				return false, cleanupStopError(ctx)
 			}
-			backoff = nextBackoff(backoff, a.cleanupBackoffMax)
+		}
+		return false, nil
+	}
+
+	a.logger.Info("cleanup reconciliation delete requested", "instance_id", instance.ID, "label", instance.Label)
+	a.scheduler.addToRun("cleanup", 0, 1, 0)
+	a.countInstances(0, 1)
+	a.notifyInstance(ctx, "instance_deleted", "deleted instance "+instance.Label, map[string]any{
+		"instance_id": instance.ID,
+		"label":       instance.Label,
+	})
+
+	// Keep a short gap between delete calls to reduce burst rate against the API.
+	if !a.sleepWithContextUntil(ctx, a.cleanupPassDeleteInterval, cutoff) {
+		return true, cleanupStopError(ctx)
+	}
+	return true, nil
+}
+
+// deletesConfirmed looks up each deleted instance and reports whether Vultr
+// already answers not-found for all of them, which makes a settle and re-list
+// unnecessary. It stops at the first instance that is still there.
+func (a *app) deletesConfirmed(ctx context.Context, client *vultrClient, deleted []string) bool {
+	for _, id := range deleted {
+		instance, err := client.getInstance(ctx, id)
+		switch {
+		case errors.Is(err, errInstanceNotFound):
 			continue
+		case err != nil:
+			a.logger.Warn("could not confirm delete; falling back to re-list", "instance_id", id, "error", err)
+		default:
+			a.logger.Info("deleted instance still present; falling back to re-list", "instance_id", id, "status", instance.Status)
 		}
+		return false
+	}
+	return true
+}
 
-		// Deletions are asynchronous upstream; allow state to settle before verifying again.
-		if !sleepWithContextUntil(ctx, a.cleanupSettleDelay, cutoff) {
-			return
+// verifyCleanupUntilEmpty is the second phase of a two-phase cleanup: once
+// every delete has been issued, it polls at its own gentler cadence until the
+// account is empty, only deleting instances it has not already asked about.
+func (a *app) verifyCleanupUntilEmpty(ctx context.Context, client *vultrClient, blockStorageID string, cutoff time.Time, deleted []string) error {
+	requested := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		requested[id] = true
+	}
+
+	interval := a.cleanupVerifyInterval
+	for {
+		if !a.sleepWithContextUntil(ctx, interval, cutoff) {
+			return cleanupStopError(ctx)
 		}
-		backoff = a.cleanupBackoffMin
+		interval = nextBackoffScaled(interval, a.cleanupVerifyIntervalMax, a.cleanupBackoffMultiplier)
+
+		instances, err := client.listAllInstances(ctx)
+		if err != nil {
+			a.logger.Error("cleanup verification failed to list instances", "error", err, "retry_in", interval.String())
+			continue
+		}
+		instances = a.cleanupTargets(instances)
+		if len(instances) == 0 {
+			a.logger.Info("cleanup reconciliation complete", "remaining_instances", 0)
+			return nil
+		}
+
+		var unrequested []vultrInstance
+		for _, instance := range instances {
+			if !requested[instance.ID] {
+				unrequested = append(unrequested, instance)
+			}
+		}
+		if len(unrequested) > 0 {
+			a.logger.Warn("cleanup verification found instances without a pending delete", "count", len(unrequested))
+			newlyDeleted, err := a.cleanupDeletePass(ctx, client, blockStorageID, unrequested, cutoff)
+			if err != nil {
+				return err
+			}
+			for _, id := range newlyDeleted {
+				requested[id] = true
+			}
+		}
+
+		a.logger.Info("cleanup verification waiting for deletes to settle",
+			"remaining_instances", len(instances),
+			"next_check_in", interval.String(),
+		)
+	}
+}
+
+// cleanupStopError explains why a cleanup sleep was cut short.
+func cleanupStopError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	return errCleanupWindowClosed
 }
 
-func sleepWithContext(ctx context.Context, d time.Duration) bool {
-	timer := time.NewTimer(d)
+// sleepWithContext waits d on the app clock. It reports false when ctx is
+// done first.
+func (a *app) sleepWithContext(ctx context.Context, d time.Duration) bool {
+	timer := a.clock().NewTimer(d)
 	defer timer.Stop()
 
 	select {
 	case <-ctx.Done():
 		return false
-	case <-timer.C:
+	case <-timer.C():
 		return true
 	}
 }
 
-func sleepWithContextUntil(ctx context.Context, d time.Duration, cutoff time.Time) bool {
+// sleepWithContextUntil is sleepWithContext that never waits past cutoff. It
+// reports false when ctx is done or cutoff has been reached.
+func (a *app) sleepWithContextUntil(ctx context.Context, d time.Duration, cutoff time.Time) bool {
 	if cutoff.IsZero() {
-		return sleepWithContext(ctx, d)
+		return a.sleepWithContext(ctx, d)
 	}
 
-	remaining := time.Until(cutoff)
+	clk := a.clock()
+	remaining := cutoff.Sub(clk.Now())
 	if remaining <= 0 {
 		return false
 	}
@@ -236,21 +763,73 @@ func sleepWithContextUntil(ctx context.Context, d time.Duration, cutoff time.Tim
 		wait = remaining
 	}
 
-	timer := time.NewTimer(wait)
+	timer := clk.NewTimer(wait)
 	defer timer.Stop()
 
 	select {
 	case <-ctx.Done():
 		return false
-	case <-timer.C:
-		return time.Now().Before(cutoff)
+	case <-timer.C():
+		return clk.Now().Before(cutoff)
 	}
 }
 
+// maintenanceWait returns the delay before retrying after err when err shows
+// Vultr under maintenance. Those waits start at maintenanceBackoffMin and grow
+// to maintenanceBackoffMax, tracked in *current; ok is false for any other
+// error or when maintenance backoff is not configured.
+func (a *app) maintenanceWait(err error, current *time.Duration) (time.Duration, bool) {
+	if a.maintenanceBackoffMin <= 0 || !errors.Is(err, errVultrMaintenance) {
+		return 0, false
+	}
+
+	if *current == 0 {
+		*current = a.maintenanceBackoffMin
+	}
+	wait := *current
+	*current = nextBackoff(wait, max(a.maintenanceBackoffMax, a.maintenanceBackoffMin))
+
+	a.logger.Warn("vultr appears to be under maintenance; backing off", "error", err, "retry_in", wait.String())
+	return wait, true
+}
+
 func nextBackoff(current, max time.Duration) time.Duration {
-	next := current * 2
-	if next > max {
+	return nextBackoffScaled(current, max, defaultBackoffMultiplier)
+}
+
+// nextBackoffScaled grows current by multiplier, clamped to max. Multipliers
+// that would not grow the backoff fall back to doubling.
+func nextBackoffScaled(current, max time.Duration, multiplier float64) time.Duration {
+	if !(multiplier > 1) {
+		multiplier = defaultBackoffMultiplier
+	}
+
+	next := float64(current) * multiplier
+	if next > float64(max) {
 		return max
 	}
-	return next
+	return time.Duration(next)
+}
+
+// nextBackoffJittered returns a full-jitter delay drawn uniformly from
+// [floor, cap], so retries that started together drift apart. A nil rnd uses
+// the shared source.
+func nextBackoffJittered(floor, cap time.Duration, rnd *rand.Rand) time.Duration {
+	if cap <= floor {
+		return cap
+	}
+	span := int64(cap-floor) + 1
+	if rnd == nil {
+		return floor + time.Duration(rand.Int64N(span))
+	}
+	return floor + time.Duration(rnd.Int64N(span))
+}
+
+// backoffDelay is the delay to sleep for the current backoff: backoff itself,
+// or a jittered value between floor and backoff when backoffJitter is set.
+func (a *app) backoffDelay(floor, backoff time.Duration) time.Duration {
+	if !a.backoffJitter {
+		return backoff
+	}
+	return nextBackoffJittered(floor, backoff, a.jitterRand)
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// defaultSchedulerRecheckInterval bounds how long a scheduler sleeps before it
+// looks at the wall clock again, so an NTP step is noticed within that time.
+const defaultSchedulerRecheckInterval = time.Minute
+
+// clock is the time source for the schedulers. Tests substitute one whose
+// wall time can jump.
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) clockTimer
+}
+
+type clockTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) clockTimer { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct{ t *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+
+func (t systemTimer) Stop() bool { return t.t.Stop() }
+
+func (a *app) clock() clock {
+	if a.clk == nil {
+		return systemClock{}
+	}
+	return a.clk
+}
+
+// waitUntil blocks until the wall clock reaches next or ctx is done. Rather
+// than trusting a single long sleep, it wakes at least every
+// schedulerRecheckInterval and compares against the current time, so a
+// forward clock step fires the run promptly and a backward step does not fire
+// it early. It reports false when ctx is done.
+func (a *app) waitUntil(ctx context.Context, next time.Time) bool {
+	recheck := a.schedulerRecheckInterval
+	if recheck <= 0 {
+		recheck = defaultSchedulerRecheckInterval
+	}
+
+	clk := a.clock()
+	for {
+		wait := next.Sub(clk.Now())
+		if wait <= 0 {
+			return true
+		}
+
+		timer := clk.NewTimer(min(wait, recheck))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C():
+		}
+	}
+}
@@ -3,10 +3,17 @@ package main
 import (
 	"bytes"
 	"embed"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"text/template"
+
+	"gopkg.in/yaml.v3"
 )
 
 //go:embed cloudinit/*
@@ -16,10 +23,33 @@ type cloudInitTemplateData struct {
 	Timezone         string
 	Locale           string
 	PrimaryUser      string
+	SSHPort          int
 	BaseInitScript   string
 	BlockInitScript  string
 	BlockInitService string
 	BlockInitTimer   string
+	// ReadyCallbackURL, when set, installs a script that reports the
+	// instance's SSH endpoint to the daemon once block init finishes.
+	ReadyCallbackURL  string
+	ReadyToken        string
+	ReadyReportScript string
+	ExtraFiles        []cloudInitExtraFile
+}
+
+// cloudInitExtraFile is one file from the extra files directory, written to
+// the instance after the built-in files.
+type cloudInitExtraFile struct {
+	Path        string
+	Permissions string
+	// Content is base64 so any bytes survive the YAML document.
+	Content string
+}
+
+// readyCallback is where and with which token a new instance reports ready.
+// The zero value leaves the callback out of the cloud-config.
+type readyCallback struct {
+	URL   string
+	Token string
 }
 
 var (
@@ -74,7 +104,7 @@ func cloudConfigTemplate() (*template.Template, error) {
 	return cloudConfigTmpl, cloudConfigErr
 }
 
-func renderCloudConfig(primaryUser string) (string, error) {
+func renderCloudConfig(primaryUser string, sshPort int, ready readyCallback, extraFilesDir string) (string, error) {
 	baseScript, err := cloudInitFS.ReadFile("cloudinit/paropal-base-init.sh")
 	if err != nil {
 		return "", fmt.Errorf("read base-init script: %w", err)
@@ -83,15 +113,28 @@ func renderCloudConfig(primaryUser string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("read block-init script: %w", err)
 	}
-	blockService, err := cloudInitFS.ReadFile("cloudinit/paropal-block-init.service")
+	blockService, err := renderCloudInitFile("cloudinit/paropal-block-init.service", primaryUser)
 	if err != nil {
-		return "", fmt.Errorf("read block-init service: %w", err)
+		return "", err
 	}
 	blockTimer, err := cloudInitFS.ReadFile("cloudinit/paropal-block-init.timer")
 	if err != nil {
 		return "", fmt.Errorf("read block-init timer: %w", err)
 	}
 
+	var readyScript []byte
+	if ready.URL != "" {
+		readyScript, err = cloudInitFS.ReadFile("cloudinit/paropal-report-ready.sh")
+		if err != nil {
+			return "", fmt.Errorf("read report-ready script: %w", err)
+		}
+	}
+
+	extraFiles, err := loadExtraFiles(extraFilesDir)
+	if err != nil {
+		return "", err
+	}
+
 	tmpl, err := cloudConfigTemplate()
 	if err != nil {
 		return "", err
@@ -99,17 +142,125 @@ func renderCloudConfig(primaryUser string) (string, error) {
 
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, cloudInitTemplateData{
-		Timezone:         cloudInitTimeZone,
-		Locale:           cloudInitLocale,
-		PrimaryUser:      primaryUser,
-		BaseInitScript:   string(baseScript),
-		BlockInitScript:  string(blockScript),
-		BlockInitService: string(blockService),
-		BlockInitTimer:   string(blockTimer),
+		Timezone:          cloudInitTimeZone,
+		Locale:            cloudInitLocale,
+		PrimaryUser:       primaryUser,
+		SSHPort:           sshPort,
+		BaseInitScript:    string(baseScript),
+		BlockInitScript:   string(blockScript),
+		BlockInitService:  blockService,
+		BlockInitTimer:    string(blockTimer),
+		ReadyCallbackURL:  ready.URL,
+		ReadyToken:        ready.Token,
+		ReadyReportScript: string(readyScript),
+		ExtraFiles:        extraFiles,
 	})
 	if err != nil {
 		return "", fmt.Errorf("render cloud-config: %w", err)
 	}
+	if err := validateCloudConfig(buf.String()); err != nil {
+		return "", err
+	}
 
 	return buf.String(), nil
 }
+
+// loadExtraFiles reads every regular file under dir. A file's path below dir
+// is its path on the instance, so dir/etc/motd becomes /etc/motd, and its
+// permission bits carry over. An empty or missing dir yields no files.
+func loadExtraFiles(dir string) ([]cloudInitExtraFile, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	var files []cloudInitExtraFile
+	root := os.DirFS(dir)
+	err := fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, cloudInitExtraFile{
+			Path:        "/" + name,
+			Permissions: fmt.Sprintf("%04o", info.Mode().Perm()),
+			Content:     base64.StdEncoding.EncodeToString(content),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read extra files from %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// renderCloudInitFile executes an embedded file that needs the primary user
+// filled in, such as the block-init unit's ExecStart line.
+func renderCloudInitFile(name, primaryUser string) (string, error) {
+	raw, err := cloudInitFS.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	tmpl, err := template.New(name).Parse(string(raw))
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ PrimaryUser string }{primaryUser}); err != nil {
+		return "", fmt.Errorf("render %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// validateCloudConfig checks that a rendered cloud-config starts with the
+// #cloud-config header cloud-init looks for and parses as a YAML mapping, so
+// a broken template or an unescaped value fails the render instead of
+// shipping an instance that never configures itself.
+func validateCloudConfig(rendered string) error {
+	if header, _, _ := strings.Cut(rendered, "\n"); strings.TrimSpace(header) != "#cloud-config" {
+		return errors.New("cloud-config must start with a #cloud-config line")
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal([]byte(rendered), &doc); err != nil {
+		return fmt.Errorf("rendered cloud-config is not valid YAML: %w", err)
+	}
+	if len(doc) == 0 {
+		return errors.New("rendered cloud-config is empty")
+	}
+	return nil
+}
+
+// handleCloudConfig returns the cloud-config the next create would send,
+// as plain YAML rather than base64. The per-run ready token is not known
+// until a run starts, so a placeholder stands in for it.
+func (a *app) handleCloudConfig(w http.ResponseWriter, r *http.Request) {
+	var ready readyCallback
+	if a.readyCallbackURL != "" {
+		ready = readyCallback{URL: a.readyCallbackURL, Token: "<ready-token>"}
+	}
+	rendered, err := renderCloudConfig(a.sshUser(), a.sshListenPort(), ready, a.extraFilesDir)
+	if err != nil {
+		a.logger.Error("failed to render cloud-config", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to render cloud-config",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(rendered))
+}
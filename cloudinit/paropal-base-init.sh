@@ -2,6 +2,7 @@
 set -euo pipefail
 
 USER_NAME="${1:-linuxuser}"
+SSH_PORT="${2:-443}"
 STATE_DIR="/var/lib/paropal"
 DONE_MARKER="${STATE_DIR}/base-init.done"
 
@@ -9,6 +10,27 @@ log() {
   printf '[paropal-base-init] %s\n' "$*"
 }
 
+# Vultr's limited user scheme only creates linuxuser. Any other primary user
+# is created here and given the keys Vultr installed for linuxuser.
+ensure_user() {
+  if id "$USER_NAME" >/dev/null 2>&1; then
+    return 0
+  fi
+
+  log "Creating user ${USER_NAME}"
+  useradd --create-home --shell /bin/bash --groups sudo "$USER_NAME"
+  local home
+  home="$(getent passwd "$USER_NAME" | cut -d: -f6)"
+  install -d -m 0700 -o "$USER_NAME" -g "$USER_NAME" "${home}/.ssh"
+  local keys
+  for keys in /home/linuxuser/.ssh/authorized_keys /root/.ssh/authorized_keys; do
+    if [[ -s "$keys" ]]; then
+      install -m 0600 -o "$USER_NAME" -g "$USER_NAME" "$keys" "${home}/.ssh/authorized_keys"
+      break
+    fi
+  done
+}
+
 main() {
   if [[ -f "$DONE_MARKER" ]]; then
     log "Already initialized; exiting"
@@ -16,11 +38,12 @@ main() {
   fi
 
   mkdir -p "$STATE_DIR"
+  ensure_user
 
-  log "Configuring sshd (port 443, key OR TOTP, no root)"
+  log "Configuring sshd (port ${SSH_PORT}, key OR TOTP, no root)"
   install -d -m 0755 /etc/ssh/sshd_config.d
   cat >/etc/ssh/sshd_config.d/40-paropal.conf <<EOF
-Port 443
+Port ${SSH_PORT}
 PermitRootLogin no
 AllowUsers ${USER_NAME}
 
@@ -57,20 +80,20 @@ account required pam_nologin.so
 @include common-session
 EOF
 
-  log "Configuring UFW (only allow 443/tcp)"
+  log "Configuring UFW (only allow ${SSH_PORT}/tcp)"
   ufw --force reset
   ufw default deny incoming
   ufw default allow outgoing
-  ufw allow 443/tcp
+  ufw allow "${SSH_PORT}/tcp"
   ufw --force enable
 
-  log "Configuring fail2ban for sshd on 443"
+  log "Configuring fail2ban for sshd on ${SSH_PORT}"
   install -d -m 0755 /etc/fail2ban/jail.d
-  cat >/etc/fail2ban/jail.d/sshd.conf <<'EOF'
+  cat >/etc/fail2ban/jail.d/sshd.conf <<EOF
 [sshd]
 enabled = true
 mode = aggressive
-port = 443
+port = ${SSH_PORT}
 maxretry = 3
 findtime = 10m
 bantime = 12h
@@ -7,6 +7,7 @@ MNT="/mnt/blockstorage"
 STATE_DIR="/var/lib/paropal"
 BLOCK_DONE_MARKER="${STATE_DIR}/block-init.done"
 DEV_DONE_MARKER="${STATE_DIR}/dev-init.done"
+READY_SCRIPT="/usr/local/sbin/paropal-report-ready.sh"
 
 log() {
   printf '[paropal-block-init] %s\n' "$*"
@@ -271,6 +272,9 @@ main() {
   fi
 
   if [[ -f "$BLOCK_DONE_MARKER" && -f "$DEV_DONE_MARKER" ]]; then
+    if [[ -x "$READY_SCRIPT" ]]; then
+      "$READY_SCRIPT" "$USER_NAME"
+    fi
     systemctl disable --now paropal-block-init.timer >/dev/null 2>&1 || true
     log "All stages complete; timer disabled"
   fi
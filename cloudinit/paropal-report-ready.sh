@@ -0,0 +1,53 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+# Writes the instance's own view of its SSH endpoint to the block volume and
+# reports it to the daemon. Settings come from /etc/paropal/ready.env.
+
+ENV_FILE="/etc/paropal/ready.env"
+MNT="/mnt/blockstorage"
+STATE_DIR="/var/lib/paropal"
+READY_DONE_MARKER="${STATE_DIR}/ready-report.done"
+
+log() {
+  printf '[paropal-report-ready] %s\n' "$*"
+}
+
+fail() {
+  echo "[paropal-report-ready] ERROR: $*" >&2
+  exit 1
+}
+
+main() {
+  [[ -f "$READY_DONE_MARKER" ]] && return 0
+  [[ -f "$ENV_FILE" ]] || fail "missing ${ENV_FILE}"
+  # shellcheck disable=SC1090
+  source "$ENV_FILE"
+  [[ -n "${PAROPAL_READY_URL:-}" && -n "${PAROPAL_READY_TOKEN:-}" ]] || fail "ready callback is not configured"
+
+  local user="${1:-linuxuser}"
+  local port
+  port="$(sshd -T 2>/dev/null | awk '$1 == "port" { print $2; exit }')"
+  [[ -n "$port" ]] || fail "cannot read sshd port"
+
+  local status
+  status="$(printf '{"ssh_port":%d,"user":"%s","hostname":"%s","reported_at":"%s"}' \
+    "$port" "$user" "$(hostname)" "$(date -u +%Y-%m-%dT%H:%M:%SZ)")"
+
+  mkdir -p "$STATE_DIR"
+  printf '%s\n' "$status" >"${STATE_DIR}/status.json"
+  if mountpoint -q "$MNT"; then
+    printf '%s\n' "$status" >"${MNT}/paropal-status.json"
+  fi
+
+  curl -fsS --retry 5 --retry-delay 10 --retry-all-errors \
+    -X POST "$PAROPAL_READY_URL" \
+    -H "Authorization: Bearer ${PAROPAL_READY_TOKEN}" \
+    -H "Content-Type: application/json" \
+    -d "$status" >/dev/null || fail "ready callback failed"
+
+  touch "$READY_DONE_MARKER"
+  log "Reported ready (ssh port ${port}, user ${user})"
+}
+
+main "$@"
@@ -4,68 +4,432 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"net/netip"
+	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
-	vultrBaseURL                     = "https://api.vultr.com/v2"
-	labelPrefix                      = "paropal-"
-	listenAddr                       = ":8080"
-	requestTimeout                   = 10 * time.Second
-	shutdownTimeout                  = 15 * time.Second
-	shutdownTokenEnv                 = "SHUTDOWN_BEARER_TOKEN"
-	cleanupTimeZone                  = "Asia/Seoul"
-	cleanupHourKST                   = 0
-	cleanupMinuteKST                 = 10
-	cleanupWindowStartHourKST        = 0
-	cleanupWindowStartMinuteKST      = 0
-	cleanupWindowEndHourKST          = 7
-	cleanupWindowEndMinuteKST        = 0
-	createHourKST                    = 7
-	createMinuteKST                  = 10
-	labelTimeZone                    = "Asia/Tokyo"
-	cloudInitTimeZone                = "Asia/Tokyo"
-	cloudInitLocale                  = "en_US.UTF-8"
-	provisionRegionID                = "nrt"
-	provisionOSID                    = 2625
-	provisionPlanID                  = "vhp-2c-2gb-amd"
-	provisionUserScheme              = "limited"
-	provisionSSHKeyID                = "c426659e-454e-40de-8a8b-6b9820fe72f2"
-	provisionBlockStorageID          = "52cb7c3a-42fd-47e1-b120-6e8cf6b2ddd1"
-	provisionBlockAttachLive         = false
-	provisionReinstallAfterCreate    = true
-	provisionPrimaryUser             = "linuxuser"
-	defaultCleanupSettleDelay        = 20 * time.Second
-	defaultCleanupBackoffMin         = 15 * time.Second
-	defaultCleanupBackoffMax         = 5 * time.Minute
-	defaultCleanupPassDeleteInterval = 2 * time.Second
-	defaultProvisionBackoffMin       = 15 * time.Second
-	defaultProvisionBackoffMax       = 5 * time.Minute
+	vultrBaseURL                       = "https://api.vultr.com/v2"
+	labelPrefix                        = "paropal-"
+	createTokenTagPrefix               = "paropal-create-"
+	daemonTagPrefix                    = "paropal-daemon-"
+	listenAddr                         = ":8080"
+	listenAddrEnv                      = "PAROPAL_LISTEN_ADDR"
+	requestTimeout                     = 10 * time.Second
+	shutdownTimeout                    = 15 * time.Second
+	readyCacheTTL                      = 5 * time.Second
+	readyProbeTimeout                  = 3 * time.Second
+	shutdownTokenEnv                   = "SHUTDOWN_BEARER_TOKEN"
+	authHeaderEnv                      = "PAROPAL_AUTH_HEADER"
+	adminCIDRsEnv                      = "PAROPAL_ADMIN_CIDRS"
+	trustProxyEnv                      = "PAROPAL_TRUST_PROXY"
+	cleanupMinWindowRemainingEnv       = "PAROPAL_CLEANUP_MIN_WINDOW_REMAINING"
+	pidFileEnv                         = "PAROPAL_PID_FILE"
+	cleanupBackoffMultiplierEnv        = "PAROPAL_CLEANUP_BACKOFF_MULTIPLIER"
+	provisionBackoffMultiplierEnv      = "PAROPAL_PROVISION_BACKOFF_MULTIPLIER"
+	backoffJitterEnv                   = "PAROPAL_BACKOFF_JITTER"
+	cleanupDeleteConcurrencyEnv        = "PAROPAL_CLEANUP_DELETE_CONCURRENCY"
+	pruneMaxAgeEnv                     = "PAROPAL_PRUNE_MAX_AGE"
+	pruneIntervalEnv                   = "PAROPAL_PRUNE_INTERVAL"
+	warmupDelayEnv                     = "PAROPAL_WARMUP_DELAY"
+	readOnlyEnv                        = "PAROPAL_READ_ONLY"
+	pinnedMarkerEnv                    = "PAROPAL_PINNED_MARKER"
+	cleanupTimeEnv                     = "PAROPAL_CLEANUP_TIME"
+	provisionTimeEnv                   = "PAROPAL_PROVISION_TIME"
+	cleanupWindowStartEnv              = "PAROPAL_CLEANUP_WINDOW_START"
+	cleanupWindowEndEnv                = "PAROPAL_CLEANUP_WINDOW_END"
+	readyCallbackURLEnv                = "PAROPAL_READY_CALLBACK_URL"
+	snapshotCarryOverEnv               = "PAROPAL_SNAPSHOT_CARRYOVER"
+	cleanupSnapshotBeforeDeleteEnv     = "PAROPAL_CLEANUP_SNAPSHOT_BEFORE_DELETE"
+	snapshotStateFileEnv               = "PAROPAL_SNAPSHOT_STATE_FILE"
+	snapshotTimeoutEnv                 = "PAROPAL_SNAPSHOT_TIMEOUT"
+	cleanupLogDecisionsEnv             = "PAROPAL_CLEANUP_LOG_DECISIONS"
+	logBufferSizeEnv                   = "PAROPAL_LOG_BUFFER_SIZE"
+	logFormatEnv                       = "PAROPAL_LOG_FORMAT"
+	logLevelEnv                        = "PAROPAL_LOG_LEVEL"
+	rateLimitWarnRemainingEnv          = "PAROPAL_RATE_LIMIT_WARN_REMAINING"
+	readyFileEnv                       = "PAROPAL_READY_FILE"
+	provisionReplaceFailedEnv          = "PAROPAL_REPLACE_FAILED_INSTANCES"
+	blockAttachLiveEnv                 = "PAROPAL_BLOCK_ATTACH_LIVE"
+	provisionDryRunEnv                 = "PAROPAL_PROVISION_DRY_RUN"
+	provisionRegionEnv                 = "PAROPAL_REGION"
+	provisionPlanEnv                   = "PAROPAL_PLAN"
+	provisionOSIDEnv                   = "PAROPAL_OS_ID"
+	attachVerifyTimeoutEnv             = "PAROPAL_ATTACH_VERIFY_TIMEOUT"
+	attachVerifyIntervalEnv            = "PAROPAL_ATTACH_VERIFY_INTERVAL"
+	provisionRequireActiveEnv          = "PAROPAL_PROVISION_REQUIRE_ACTIVE"
+	provisionActiveTimeoutEnv          = "PAROPAL_PROVISION_ACTIVE_TIMEOUT"
+	labelTimeFormatEnv                 = "PAROPAL_LABEL_TIME_FORMAT"
+	provisionScriptIDEnv               = "PAROPAL_SCRIPT_ID"
+	timeZoneEnv                        = "PAROPAL_TIMEZONE"
+	labelTimeZoneEnv                   = "PAROPAL_LABEL_TIMEZONE"
+	provisionMaxInstancesEnv           = "PAROPAL_PROVISION_MAX_INSTANCES"
+	accountMaxInstancesEnv             = "PAROPAL_MAX_INSTANCES"
+	sshPortEnv                         = "PAROPAL_SSH_PORT"
+	firewallGroupIDEnv                 = "PAROPAL_FIREWALL_GROUP_ID"
+	primaryUserEnv                     = "PAROPAL_PRIMARY_USER"
+	sshKeyIDsEnv                       = "PAROPAL_SSH_KEY_IDS"
+	extraFilesEnv                      = "PAROPAL_EXTRA_FILES"
+	provisionModeEnv                   = "PAROPAL_PROVISION_MODE"
+	provisionAttachBackoffMinEnv       = "PAROPAL_PROVISION_ATTACH_BACKOFF_MIN"
+	provisionAttachBackoffMaxEnv       = "PAROPAL_PROVISION_ATTACH_BACKOFF_MAX"
+	cleanupRequirePendingChargesEnv    = "PAROPAL_CLEANUP_REQUIRE_PENDING_CHARGES"
+	cleanupMinPendingChargesEnv        = "PAROPAL_CLEANUP_MIN_PENDING_CHARGES"
+	cleanupUsePartialListEnv           = "PAROPAL_CLEANUP_USE_PARTIAL_LIST"
+	provisionRunTimeoutEnv             = "PAROPAL_PROVISION_RUN_TIMEOUT"
+	alertAfterFailedRunsEnv            = "PAROPAL_ALERT_AFTER_FAILED_RUNS"
+	webhookURLEnv                      = "PAROPAL_WEBHOOK_URL"
+	cleanupSeparateVerifyEnv           = "PAROPAL_CLEANUP_SEPARATE_VERIFY"
+	cleanupConfirmDeletesEnv           = "PAROPAL_CLEANUP_CONFIRM_DELETES"
+	cleanupVerifyIntervalEnv           = "PAROPAL_CLEANUP_VERIFY_INTERVAL"
+	cleanupVerifyIntervalMaxEnv        = "PAROPAL_CLEANUP_VERIFY_INTERVAL_MAX"
+	shutdownDrainEnv                   = "PAROPAL_SHUTDOWN_DRAIN"
+	secondaryAPIKeyEnv                 = "PAROPAL_SECONDARY_VULTR_API_KEY"
+	secondaryBlockStorageIDEnv         = "PAROPAL_SECONDARY_BLOCK_STORAGE_ID"
+	provisionFailoverAfterEnv          = "PAROPAL_PROVISION_FAILOVER_AFTER"
+	ddayTargetEnv                      = "PAROPAL_DDAY_TARGET"
+	provisionPlanUpgradesEnv           = "PAROPAL_PROVISION_PLAN_UPGRADES"
+	planUpgradeBandwidthBytesEnv       = "PAROPAL_PLAN_UPGRADE_BANDWIDTH_BYTES"
+	provisionRequireServerOKEnv        = "PAROPAL_PROVISION_REQUIRE_SERVER_OK"
+	notifyModeEnv                      = "PAROPAL_NOTIFY_MODE"
+	cleanupSettleDelayMaxEnv           = "PAROPAL_CLEANUP_SETTLE_DELAY_MAX"
+	provisionFallbackRegionsEnv        = "PAROPAL_PROVISION_FALLBACK_REGIONS"
+	countersFileEnv                    = "PAROPAL_COUNTERS_FILE"
+	stateFileEnv                       = "PAROPAL_STATE_FILE"
+	chargesRetriesEnv                  = "PAROPAL_CHARGES_RETRIES"
+	chargesRetryDelayEnv               = "PAROPAL_CHARGES_RETRY_DELAY"
+	chargesCacheTTLEnv                 = "PAROPAL_CHARGES_CACHE_TTL"
+	maintenanceAfterEnv                = "PAROPAL_MAINTENANCE_AFTER_503S"
+	vultrMaxRetriesEnv                 = "PAROPAL_VULTR_MAX_RETRIES"
+	vultrRetryBackoffEnv               = "PAROPAL_VULTR_RETRY_BACKOFF"
+	maintenanceBackoffMinEnv           = "PAROPAL_MAINTENANCE_BACKOFF_MIN"
+	maintenanceBackoffMaxEnv           = "PAROPAL_MAINTENANCE_BACKOFF_MAX"
+	vultrTimeoutsEnv                   = "PAROPAL_VULTR_TIMEOUTS"
+	dashboardMaxConcurrentEnv          = "PAROPAL_DASHBOARD_MAX_CONCURRENT"
+	dashboardQueueTimeoutEnv           = "PAROPAL_DASHBOARD_QUEUE_TIMEOUT"
+	cleanupScopeEnv                    = "PAROPAL_CLEANUP_SCOPE"
+	cleanupDeepEnv                     = "PAROPAL_CLEANUP_DEEP"
+	cleanupDryRunEnv                   = "PAROPAL_CLEANUP_DRY_RUN"
+	daemonIDEnv                        = "PAROPAL_DAEMON_ID"
+	cleanupOwnOnlyEnv                  = "PAROPAL_CLEANUP_OWN_ONLY"
+	destroyAllAckEnv                   = "PAROPAL_I_UNDERSTAND_DESTROY_ALL"
+	cleanupTimeZone                    = "Asia/Seoul"
+	cleanupHourKST                     = 0
+	cleanupMinuteKST                   = 10
+	cleanupWindowStartHourKST          = 0
+	cleanupWindowStartMinuteKST        = 0
+	cleanupWindowEndHourKST            = 7
+	cleanupWindowEndMinuteKST          = 0
+	createHourKST                      = 7
+	createMinuteKST                    = 10
+	labelTimeZone                      = "Asia/Tokyo"
+	defaultLabelTimeFormat             = "01-02_15-04-05"
+	cloudInitTimeZone                  = "Asia/Tokyo"
+	cloudInitLocale                    = "en_US.UTF-8"
+	provisionRegionID                  = "nrt"
+	provisionOSID                      = 2625
+	provisionPlanID                    = "vhp-2c-2gb-amd"
+	provisionUserScheme                = "limited"
+	provisionSSHKeyID                  = "c426659e-454e-40de-8a8b-6b9820fe72f2"
+	provisionBlockStorageID            = "52cb7c3a-42fd-47e1-b120-6e8cf6b2ddd1"
+	provisionReinstallAfterCreate      = true
+	provisionPrimaryUser               = "linuxuser"
+	provisionSSHPort                   = 443
+	defaultCleanupSettleDelay          = 20 * time.Second
+	defaultCleanupBackoffMin           = 15 * time.Second
+	defaultCleanupBackoffMax           = 5 * time.Minute
+	defaultCleanupPassDeleteInterval   = 2 * time.Second
+	defaultPruneInterval               = time.Hour
+	defaultSnapshotPollInterval        = 30 * time.Second
+	defaultSnapshotTimeout             = 30 * time.Minute
+	defaultCleanupSnapshotDelay        = 15 * time.Second
+	defaultCleanupMinWindowRemaining   = time.Minute
+	defaultCleanupVerifyInterval       = 30 * time.Second
+	defaultCleanupVerifyIntervalMax    = 5 * time.Minute
+	defaultProvisionBackoffMin         = 15 * time.Second
+	defaultProvisionBackoffMax         = 5 * time.Minute
+	defaultProvisionAttachBackoffMin   = 5 * time.Second
+	defaultProvisionAttachBackoffMax   = time.Minute
+	defaultBackoffMultiplier           = 2.0
+	defaultRateLimitWarnRemaining      = 5
+	defaultProvisionActiveTimeout      = 10 * time.Minute
+	defaultProvisionActivePollInterval = 10 * time.Second
+	maxProvisionActivePollInterval     = time.Minute
+	maxLogBufferSize                   = 10000
+	defaultAttachVerifyTimeout         = 2 * time.Minute
+	defaultAttachVerifyInterval        = 10 * time.Second
+	defaultAlertAfterFailedRuns        = 3
+	defaultProvisionFailoverAfter      = 3
+	defaultChargesRetries              = 2
+	defaultChargesRetryDelay           = 250 * time.Millisecond
+	defaultChargesCacheTTL             = 30 * time.Second
+	defaultMaintenanceAfter            = 3
+	defaultVultrMaxRetries             = 2
+	defaultVultrRetryBackoff           = 500 * time.Millisecond
+	defaultMaintenanceBackoffMin       = 2 * time.Minute
+	defaultMaintenanceBackoffMax       = 15 * time.Minute
+	defaultDDayTarget                  = "2026-02-26"
+	notifyModeEvent                    = "event"
+	notifyModeRun                      = "run"
+	provisionModeCreate                = "create"
+	provisionModeReinstall             = "reinstall"
+	runHistoryLimit                    = 200
+	defaultAccountMaxInstances         = 1
+)
+
+// defaultVultrTimeouts bounds each Vultr call by operation. Operations not
+// listed fall back to requestTimeout.
+var defaultVultrTimeouts = map[string]time.Duration{
+	"list":      10 * time.Second,
+	"get":       10 * time.Second,
+	"delete":    15 * time.Second,
+	"attach":    30 * time.Second,
+	"reinstall": 30 * time.Second,
+	"create":    60 * time.Second,
+}
+
+var (
+	errReadOnly                  = errors.New("read-only mode: vultr mutations are disabled")
+	errInstanceNotFound          = errors.New("no instance found with matching label prefix")
+	errIncompleteInstanceList    = errors.New("instance list incomplete")
+	errCleanupWindowClosed       = errors.New("cleanup window closed before all instances were deleted")
+	errVultrMaintenance          = errors.New("vultr appears to be under maintenance")
+	errDestroyAllNotAcknowledged = errors.New("account-wide cleanup not acknowledged")
+	errBlockStorageMissing       = errors.New("configured block storage does not exist")
+	errInstanceCeilingReached    = errors.New("paropal instance count is at the safety ceiling")
 )
 
-var errInstanceNotFound = errors.New("no instance found with matching label prefix")
+// provisionConfig holds the create specs that can be overridden from the
+// environment. Zero fields fall back to the compiled-in defaults.
+type provisionConfig struct {
+	Region string
+	Plan   string
+	OSID   int
+}
+
+func (c provisionConfig) region() string {
+	if c.Region == "" {
+		return provisionRegionID
+	}
+	return c.Region
+}
+
+func (c provisionConfig) plan() string {
+	if c.Plan == "" {
+		return provisionPlanID
+	}
+	return c.Plan
+}
+
+func (c provisionConfig) osID() int {
+	if c.OSID == 0 {
+		return provisionOSID
+	}
+	return c.OSID
+}
+
+func (a *app) sshListenPort() int {
+	if a.sshPort == 0 {
+		return provisionSSHPort
+	}
+	return a.sshPort
+}
+
+func (a *app) sshUser() string {
+	if a.primaryUser == "" {
+		return provisionPrimaryUser
+	}
+	return a.primaryUser
+}
+
+func (a *app) provisionSSHKeyIDs() []string {
+	if len(a.sshKeyIDs) == 0 {
+		return []string{provisionSSHKeyID}
+	}
+	return a.sshKeyIDs
+}
 
 type app struct {
-	vultr                     *vultrClient
-	logger                    *slog.Logger
-	server                    *http.Server
-	shutdownToken             string
-	stopBackground            context.CancelFunc
-	cleanupLoc                *time.Location
-	labelLoc                  *time.Location
+	vultr                   *vultrClient
+	secondaryVultr          *vultrClient
+	secondaryBlockStorageID string
+	provisionFailoverAfter  int
+	maintenanceBackoffMin   time.Duration
+	maintenanceBackoffMax   time.Duration
+	logger                  *slog.Logger
+	server                  *http.Server
+	// shutdownTokens are the bearer tokens accepted on authenticated
+	// endpoints. More than one is configured only while rotating.
+	shutdownTokens []string
+	authHeader     string
+	// adminCIDRs limits which source addresses may reach authenticated
+	// endpoints. Empty allows any address.
+	adminCIDRs []netip.Prefix
+	// trustProxy takes the client address from X-Forwarded-For instead of
+	// the connection's peer address.
+	trustProxy     bool
+	backgroundCtx  context.Context
+	stopBackground context.CancelFunc
+	// requestShutdown, set while serve runs, makes serve shut the daemon
+	// down. POST /api/shutdown uses it so serve waits for the shutdown to
+	// finish before returning.
+	requestShutdown context.CancelCauseFunc
+	// provisionInFlight is set while a scheduled or manual provision runs so
+	// the two never overlap.
+	provisionInFlight atomic.Bool
+	// draining is set once shutdown starts; API requests then get a 503.
+	draining                 atomic.Bool
+	clk                      clock
+	schedulerRecheckInterval time.Duration
+	shutdownDrain            bool
+	runs                     reconcileRuns
+	scheduler                schedulerState
+	counters                 lifetimeCounters
+	history                  runHistory
+	metrics                  daemonMetrics
+	logBufferSize            int
+	logs                     *logRing
+	readyFile                string
+	schedule                 dailySchedule
+	cleanupLoc               *time.Location
+	labelLoc                 *time.Location
+	labelTimeFormat          string
+	ddayTarget               string
+	chargesRetries           int
+	chargesRetryDelay        time.Duration
+	// chargesCacheTTL is how long a fetched pending-charges value is served
+	// without asking Vultr again. Zero fetches on every request.
+	chargesCacheTTL           time.Duration
+	dashboardMaxConcurrent    int
+	dashboardQueueTimeout     time.Duration
+	charges                   chargesCache
 	cleanupSettleDelay        time.Duration
+	cleanupSettleDelayMax     time.Duration
 	cleanupBackoffMin         time.Duration
 	cleanupBackoffMax         time.Duration
 	cleanupPassDeleteInterval time.Duration
-	provisionBackoffMin       time.Duration
-	provisionBackoffMax       time.Duration
+	cleanupDeleteConcurrency  int
+	pruneMaxAge               time.Duration
+	pruneInterval             time.Duration
+	warmupDelay               time.Duration
+	readOnly                  bool
+	pinnedMarker              string
+	readyCallbackURL          string
+	snapshotCarryOver         bool
+	snapshotPollInterval      time.Duration
+	// snapshotTimeout bounds the wait for the carry-over snapshot. Zero
+	// means defaultSnapshotTimeout.
+	snapshotTimeout              time.Duration
+	cleanupSnapshotBeforeDelete  bool
+	cleanupSnapshotDelay         time.Duration
+	snapshots                    snapshotStore
+	ready                        readyTracker
+	cleanupMinWindowRemaining    time.Duration
+	cleanupBackoffMultiplier     float64
+	cleanupRequirePendingCharges bool
+	cleanupMinPendingCharges     float64
+	cleanupUsePartialList        bool
+	cleanupAllInstances          bool
+	cleanupDeep                  bool
+	cleanupDryRun                bool
+	daemonID                     string
+	cleanupOwnOnly               bool
+	cleanupLogDecisions          bool
+	cleanupRequireDestroyAllAck  bool
+	cleanupSeparateVerify        bool
+	cleanupConfirmDeletes        bool
+	cleanupVerifyInterval        time.Duration
+	cleanupVerifyIntervalMax     time.Duration
+	provisionBackoffMin          time.Duration
+	provisionBackoffMax          time.Duration
+	provisionAttachBackoffMin    time.Duration
+	provisionAttachBackoffMax    time.Duration
+	provisionBackoffMultiplier   float64
+	backoffJitter                bool
+	jitterRand                   *rand.Rand
+	provisionReplaceFailed       bool
+	blockAttachLive              bool
+	provisionDryRun              bool
+	provision                    provisionConfig
+	attachVerifyTimeout          time.Duration
+	attachVerifyInterval         time.Duration
+	provisionRequireActive       bool
+	provisionRequireServerOK     bool
+	provisionActiveTimeout       time.Duration
+	provisionActivePollInterval  time.Duration
+	provisionScriptID            string
+	// provisionMaxInstances refuses a create while this many paropal
+	// instances already exist. Zero disables the ceiling.
+	provisionMaxInstances int
+	// accountMaxInstances refuses a create while this many instances of any
+	// label already exist, so a relabelled box is not duplicated. Zero
+	// disables it.
+	accountMaxInstances int
+	// sshPort is the port sshd listens on. It is written into the
+	// cloud-config, opened in the firewall group and shown on the dashboard.
+	// Zero means provisionSSHPort; read it through sshListenPort.
+	sshPort int
+	// primaryUser is the account sshd admits and block init sets up. Empty
+	// means provisionPrimaryUser; read it through sshUser.
+	primaryUser string
+	// sshKeyIDs are the Vultr SSH keys installed on created instances.
+	// Empty means provisionSSHKeyID; read them through provisionSSHKeyIDs.
+	sshKeyIDs []string
+	// extraFilesDir holds files appended to the cloud-config's write_files,
+	// laid out as they should appear on the instance.
+	extraFilesDir string
+	// provisionMode is provisionModeReinstall to reinstall a healthy
+	// existing instance instead of leaving it alone. Empty means
+	// provisionModeCreate.
+	provisionMode string
+	// firewallGroupID, when set, is attached to created instances and gets
+	// an inbound rule for sshPort.
+	firewallGroupID           string
+	provisionPlanUpgrades     []string
+	provisionFallbackRegions  []string
+	planUpgradeBandwidthBytes int64
+	plans                     planLadder
+	provisionRunTimeout       time.Duration
+	notifier                  *notifier
+	notifyMode                string
+	alertAfterFailedRuns      int
+	cleanupFailures           failureStreak
+	provisionFailures         failureStreak
 }
 
 type vultrClient struct {
 	apiKey     string
 	baseURL    string
 	httpClient *http.Client
+	logger     *slog.Logger
+	// rateLimitWarnRemaining logs a warning once the RateLimit-Remaining
+	// header reported by Vultr drops below this value. Zero disables it.
+	rateLimitWarnRemaining int
+	// lastSuccess holds the UnixNano time of the most recent 2xx response.
+	lastSuccess atomic.Int64
+	// maintenanceAfter is how many 503s in a row mark Vultr as under
+	// maintenance. Zero disables the detection.
+	maintenanceAfter  int
+	unavailableStreak atomic.Int32
+	// timeouts overrides defaultVultrTimeouts per operation.
+	timeouts map[string]time.Duration
+	// readOnly refuses every request that is not a GET with errReadOnly.
+	readOnly bool
+	// pinnedMarker, when set, hides instances whose label contains it from
+	// the label-prefix lookups.
+	pinnedMarker string
+	// requestDurations, when set, records how long each request takes.
+	requestDurations *prometheus.HistogramVec
+	// maxRetries is how many times a GET or DELETE is retried after a
+	// network error or a 502, 503 or 504. Zero disables retries.
+	maxRetries int
+	// retryBackoff is the wait before the first retry; it doubles after each.
+	retryBackoff time.Duration
 }
 
 type accountResponse struct {
@@ -75,10 +439,22 @@ type accountResponse struct {
 }
 
 type vultrInstance struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	MainIP string `json:"main_ip"`
-	Label  string `json:"label"`
+	ID           string   `json:"id"`
+	Status       string   `json:"status"`
+	PowerStatus  string   `json:"power_status"`
+	ServerStatus string   `json:"server_status"`
+	MainIP       string   `json:"main_ip"`
+	Label        string   `json:"label"`
+	Tags         []string `json:"tags"`
+	DateCreated  string   `json:"date_created"`
+}
+
+type instanceSummary struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	PowerStatus string `json:"power_status"`
+	IP          string `json:"ip"`
+	Label       string `json:"label"`
 }
 
 type listInstancesResponse struct {
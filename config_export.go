@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// exportedConfig is the effective configuration served by GET /api/config.
+// Secrets never appear in it: API keys, shutdown tokens and the notify webhook URL are
+// reduced to a fingerprint so two hosts can be compared without revealing
+// them.
+type exportedConfig struct {
+	DaemonID        string   `json:"daemon_id,omitempty"`
+	ReadOnly        bool     `json:"read_only"`
+	TimeZone        string   `json:"timezone"`
+	LabelTimeZone   string   `json:"label_timezone"`
+	LabelTimeFormat string   `json:"label_time_format"`
+	DDayTarget      string   `json:"dday_target,omitempty"`
+	AdminCIDRs      []string `json:"admin_cidrs,omitempty"`
+	TrustProxy      bool     `json:"trust_proxy"`
+
+	Schedule struct {
+		CleanupAt     string `json:"cleanup_at"`
+		ProvisionAt   string `json:"provision_at"`
+		CleanupWindow string `json:"cleanup_window"`
+	} `json:"schedule"`
+
+	Cleanup struct {
+		DryRun                bool    `json:"dry_run"`
+		Deep                  bool    `json:"deep"`
+		AllInstances          bool    `json:"all_instances"`
+		OwnOnly               bool    `json:"own_only"`
+		PinnedMarker          string  `json:"pinned_marker,omitempty"`
+		RequireDestroyAllAck  bool    `json:"require_destroy_all_ack"`
+		RequirePendingCharges bool    `json:"require_pending_charges"`
+		MinPendingCharges     float64 `json:"min_pending_charges"`
+		UsePartialList        bool    `json:"use_partial_list"`
+		SeparateVerify        bool    `json:"separate_verify"`
+		ConfirmDeletes        bool    `json:"confirm_deletes"`
+		SnapshotBeforeDelete  bool    `json:"snapshot_before_delete"`
+		DeleteConcurrency     int     `json:"delete_concurrency"`
+		SettleDelay           string  `json:"settle_delay"`
+		BackoffMin            string  `json:"backoff_min"`
+		BackoffMax            string  `json:"backoff_max"`
+		BackoffMultiplier     float64 `json:"backoff_multiplier"`
+		MinWindowRemaining    string  `json:"min_window_remaining"`
+		LogDecisions          bool    `json:"log_decisions"`
+	} `json:"cleanup"`
+
+	Provision struct {
+		DryRun               bool     `json:"dry_run"`
+		Region               string   `json:"region"`
+		FallbackRegions      []string `json:"fallback_regions,omitempty"`
+		Plan                 string   `json:"plan"`
+		PlanUpgrades         []string `json:"plan_upgrades,omitempty"`
+		OSID                 int      `json:"os_id"`
+		ScriptID             string   `json:"script_id,omitempty"`
+		SSHPort              int      `json:"ssh_port"`
+		PrimaryUser          string   `json:"primary_user"`
+		SSHKeyIDs            []string `json:"ssh_key_ids"`
+		BlockAttachLive      bool     `json:"block_attach_live"`
+		FirewallGroupID      string   `json:"firewall_group_id,omitempty"`
+		SecondaryAccount     bool     `json:"secondary_account"`
+		FailoverAfter        int      `json:"failover_after"`
+		Mode                 string   `json:"mode"`
+		MaxInstances         int      `json:"max_instances"`
+		AccountMaxInstances  int      `json:"account_max_instances"`
+		ReplaceFailed        bool     `json:"replace_failed"`
+		RequireActive        bool     `json:"require_active"`
+		RequireServerOK      bool     `json:"require_server_ok"`
+		ActiveTimeout        string   `json:"active_timeout"`
+		SnapshotCarryOver    bool     `json:"snapshot_carry_over"`
+		BackoffMin           string   `json:"backoff_min"`
+		BackoffMax           string   `json:"backoff_max"`
+		BackoffMultiplier    float64  `json:"backoff_multiplier"`
+		RunTimeout           string   `json:"run_timeout"`
+		ReadyCallbackEnabled bool     `json:"ready_callback_enabled"`
+	} `json:"provision"`
+
+	Notify struct {
+		Mode                 string `json:"mode,omitempty"`
+		WebhookFingerprint   string `json:"webhook_fingerprint,omitempty"`
+		AlertAfterFailedRuns int    `json:"alert_after_failed_runs"`
+	} `json:"notify"`
+
+	Secrets struct {
+		VultrAPIKey          string   `json:"vultr_api_key,omitempty"`
+		SecondaryVultrAPIKey string   `json:"secondary_vultr_api_key,omitempty"`
+		ShutdownTokens       []string `json:"shutdown_tokens,omitempty"`
+	} `json:"secrets"`
+}
+
+// secretFingerprint identifies a secret without revealing it: a short
+// SHA-256 prefix, or "" when the secret is unset.
+func secretFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+func (a *app) exportConfig() exportedConfig {
+	var c exportedConfig
+	c.DaemonID = a.daemonID
+	c.ReadOnly = a.readOnly
+	if a.cleanupLoc != nil {
+		c.TimeZone = a.cleanupLoc.String()
+	}
+	if a.labelLoc != nil {
+		c.LabelTimeZone = a.labelLoc.String()
+	}
+	c.LabelTimeFormat = a.labelTimeFormat
+	c.DDayTarget = a.ddayTarget
+	for _, prefix := range a.adminCIDRs {
+		c.AdminCIDRs = append(c.AdminCIDRs, prefix.String())
+	}
+	c.TrustProxy = a.trustProxy
+
+	c.Schedule.CleanupAt = a.schedule.cleanupAt.String()
+	c.Schedule.ProvisionAt = a.schedule.provisionAt.String()
+	c.Schedule.CleanupWindow = a.schedule.window.String()
+
+	c.Cleanup.DryRun = a.cleanupDryRun
+	c.Cleanup.Deep = a.cleanupDeep
+	c.Cleanup.AllInstances = a.cleanupAllInstances
+	c.Cleanup.OwnOnly = a.cleanupOwnOnly
+	c.Cleanup.PinnedMarker = a.pinnedMarker
+	c.Cleanup.RequireDestroyAllAck = a.cleanupRequireDestroyAllAck
+	c.Cleanup.RequirePendingCharges = a.cleanupRequirePendingCharges
+	c.Cleanup.MinPendingCharges = a.cleanupMinPendingCharges
+	c.Cleanup.UsePartialList = a.cleanupUsePartialList
+	c.Cleanup.SeparateVerify = a.cleanupSeparateVerify
+	c.Cleanup.ConfirmDeletes = a.cleanupConfirmDeletes
+	c.Cleanup.SnapshotBeforeDelete = a.cleanupSnapshotBeforeDelete
+	c.Cleanup.DeleteConcurrency = a.cleanupDeleteConcurrency
+	c.Cleanup.SettleDelay = a.cleanupSettleDelay.String()
+	c.Cleanup.BackoffMin = a.cleanupBackoffMin.String()
+	c.Cleanup.BackoffMax = a.cleanupBackoffMax.String()
+	c.Cleanup.BackoffMultiplier = a.cleanupBackoffMultiplier
+	c.Cleanup.MinWindowRemaining = a.cleanupMinWindowRemaining.String()
+	c.Cleanup.LogDecisions = a.cleanupLogDecisions
+
+	c.Provision.DryRun = a.provisionDryRun
+	c.Provision.Region = a.provision.region()
+	c.Provision.FallbackRegions = a.provisionFallbackRegions
+	c.Provision.Plan = a.provisionPlan()
+	c.Provision.PlanUpgrades = a.provisionPlanUpgrades
+	c.Provision.OSID = a.provision.osID()
+	c.Provision.ScriptID = a.provisionScriptID
+	c.Provision.SSHPort = a.sshListenPort()
+	c.Provision.PrimaryUser = a.sshUser()
+	c.Provision.SSHKeyIDs = a.provisionSSHKeyIDs()
+	c.Provision.BlockAttachLive = a.blockAttachLive
+	c.Provision.FirewallGroupID = a.firewallGroupID
+	c.Provision.SecondaryAccount = a.secondaryVultr != nil
+	c.Provision.FailoverAfter = a.provisionFailoverAfter
+	c.Provision.Mode = provisionModeCreate
+	if a.provisionMode != "" {
+		c.Provision.Mode = a.provisionMode
+	}
+	c.Provision.MaxInstances = a.provisionMaxInstances
+	c.Provision.AccountMaxInstances = a.accountMaxInstances
+	c.Provision.ReplaceFailed = a.provisionReplaceFailed
+	c.Provision.RequireActive = a.provisionRequireActive
+	c.Provision.RequireServerOK = a.provisionRequireServerOK
+	c.Provision.ActiveTimeout = a.provisionActiveTimeout.String()
+	c.Provision.SnapshotCarryOver = a.snapshotCarryOver
+	c.Provision.BackoffMin = a.provisionBackoffMin.String()
+	c.Provision.BackoffMax = a.provisionBackoffMax.String()
+	c.Provision.BackoffMultiplier = a.provisionBackoffMultiplier
+	c.Provision.RunTimeout = a.provisionRunTimeout.String()
+	c.Provision.ReadyCallbackEnabled = a.readyCallbackURL != ""
+
+	c.Notify.Mode = a.notifyMode
+	if a.notifier != nil {
+		c.Notify.WebhookFingerprint = secretFingerprint(a.notifier.url)
+	}
+	c.Notify.AlertAfterFailedRuns = a.alertAfterFailedRuns
+
+	if a.vultr != nil {
+		c.Secrets.VultrAPIKey = secretFingerprint(a.vultr.apiKey)
+	}
+	if a.secondaryVultr != nil {
+		c.Secrets.SecondaryVultrAPIKey = secretFingerprint(a.secondaryVultr.apiKey)
+	}
+	for _, token := range a.shutdownTokens {
+		c.Secrets.ShutdownTokens = append(c.Secrets.ShutdownTokens, secretFingerprint(token))
+	}
+	return c
+}
+
+// handleConfig returns the effective configuration with secrets replaced by
+// fingerprints.
+func (a *app) handleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.exportConfig())
+}
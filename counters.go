@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// counterValues are the lifetime totals, as stored on disk.
+type counterValues struct {
+	InstancesCreated int64 `json:"instances_created"`
+	InstancesDeleted int64 `json:"instances_deleted"`
+}
+
+// lifetimeCounters accumulate totals across the daemon's lifetime. With a
+// path set they are loaded at startup and rewritten after every change, so
+// totals survive restarts. The zero value counts in memory only.
+type lifetimeCounters struct {
+	mu     sync.Mutex
+	path   string
+	values counterValues
+}
+
+// load reads any totals previously saved at path and persists to it from
+// then on. A missing file starts from zero.
+func (c *lifetimeCounters) load(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.path = path
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read counters file: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.values); err != nil {
+		return fmt.Errorf("decode counters file: %w", err)
+	}
+	return nil
+}
+
+func (c *lifetimeCounters) add(created, deleted int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values.InstancesCreated += created
+	c.values.InstancesDeleted += deleted
+	return c.saveLocked()
+}
+
+func (c *lifetimeCounters) snapshot() counterValues {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values
+}
+
+// saveLocked writes the totals to path, if one is set.
+func (c *lifetimeCounters) saveLocked() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.values)
+	if err != nil {
+		return fmt.Errorf("encode counters: %w", err)
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return fmt.Errorf("write counters file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data via a temp file and rename so a
+// crash never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// countInstances adds to the lifetime totals, logging rather than failing
+// the caller when they cannot be persisted.
+func (a *app) countInstances(created, deleted int64) {
+	a.metrics.collectors().instancesDeleted.Add(float64(deleted))
+	if err := a.counters.add(created, deleted); err != nil {
+		a.logger.Error("failed to persist lifetime counters", "error", err)
+	}
+}
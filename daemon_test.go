@@ -1,19 +1,33 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v3"
 )
 
 func TestNextCleanupTimeKST(t *testing.T) {
@@ -46,7 +60,7 @@ func TestNextCleanupTimeKST(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := nextCleanupTimeKST(tt.now, loc)
+			got := nextCleanupTimeKST(tt.now, loc, defaultSchedule.cleanupAt)
 			if !got.Equal(tt.want) {
 				t.Fatalf("nextCleanupTimeKST() = %s, want %s", got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
 			}
@@ -54,6 +68,35 @@ func TestNextCleanupTimeKST(t *testing.T) {
 	}
 }
 
+func TestNextCleanupTimeInConfiguredTimeZone(t *testing.T) {
+	t.Setenv(timeZoneEnv, "America/New_York")
+	loc, err := locationFromEnv(timeZoneEnv, cleanupTimeZone)
+	if err != nil {
+		t.Fatalf("locationFromEnv() error = %v", err)
+	}
+	if loc.String() != "America/New_York" {
+		t.Fatalf("location = %s, want America/New_York", loc)
+	}
+
+	// 00:05 in New York is already 14:05 in Seoul, so a KST schedule would
+	// wait until the next day; the configured zone runs five minutes later.
+	now := time.Date(2026, time.March, 2, 0, 5, 0, 0, loc)
+	want := time.Date(2026, time.March, 2, 0, 10, 0, 0, loc)
+	if got := nextCleanupTimeKST(now, loc, defaultSchedule.cleanupAt); !got.Equal(want) {
+		t.Fatalf("nextCleanupTimeKST() = %s, want %s", got.Format(time.RFC3339), want.Format(time.RFC3339))
+	}
+
+	t.Setenv(timeZoneEnv, "Mars/Olympus_Mons")
+	if _, err := locationFromEnv(timeZoneEnv, cleanupTimeZone); err == nil || !strings.Contains(err.Error(), timeZoneEnv) {
+		t.Fatalf("locationFromEnv() error = %v, want one naming %s", err, timeZoneEnv)
+	}
+
+	t.Setenv(timeZoneEnv, "")
+	if loc, err := locationFromEnv(timeZoneEnv, cleanupTimeZone); err != nil || loc.String() != cleanupTimeZone {
+		t.Fatalf("locationFromEnv() = %v, %v, want the %s fallback", loc, err, cleanupTimeZone)
+	}
+}
+
 func TestFirstCleanupRunTimeKST(t *testing.T) {
 	loc, err := time.LoadLocation(cleanupTimeZone)
 	if err != nil {
@@ -89,7 +132,7 @@ func TestFirstCleanupRunTimeKST(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := firstCleanupRunTimeKST(tt.now, loc)
+			got := firstCleanupRunTimeKST(tt.now, loc, defaultSchedule)
 			if !got.Equal(tt.want) {
 				t.Fatalf("firstCleanupRunTimeKST() = %s, want %s", got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
 			}
@@ -127,7 +170,7 @@ func TestNextProvisionTimeKST(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := nextProvisionTimeKST(tt.now, loc)
+			got := nextProvisionTimeKST(tt.now, loc, defaultSchedule.provisionAt)
 			if !got.Equal(tt.want) {
 				t.Fatalf("nextProvisionTimeKST() = %s, want %s", got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
 			}
@@ -165,7 +208,7 @@ func TestFirstProvisionRunTimeKST(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := firstProvisionRunTimeKST(tt.now, loc)
+			got := firstProvisionRunTimeKST(tt.now, loc, defaultSchedule.provisionAt)
 			if !got.Equal(tt.want) {
 				t.Fatalf("firstProvisionRunTimeKST() = %s, want %s", got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
 			}
@@ -173,6 +216,210 @@ func TestFirstProvisionRunTimeKST(t *testing.T) {
 	}
 }
 
+func TestUpcomingRuns(t *testing.T) {
+	loc, err := time.LoadLocation(cleanupTimeZone)
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+
+	now := time.Date(2026, time.February, 17, 3, 0, 0, 0, loc)
+	got := upcomingRuns(now, loc, defaultSchedule, 2)
+
+	want := []scheduledRun{
+		{Kind: "provision", At: time.Date(2026, time.February, 17, 7, 10, 0, 0, loc)},
+		{Kind: "cleanup", At: time.Date(2026, time.February, 18, 0, 10, 0, 0, loc)},
+		{Kind: "provision", At: time.Date(2026, time.February, 18, 7, 10, 0, 0, loc)},
+		{Kind: "cleanup", At: time.Date(2026, time.February, 19, 0, 10, 0, 0, loc)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("upcomingRuns() returned %d runs, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Kind != want[i].Kind || !got[i].At.Equal(want[i].At) {
+			t.Fatalf("run %d = %s %s, want %s %s", i, got[i].Kind, got[i].At.Format(time.RFC3339), want[i].Kind, want[i].At.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestScheduleFunctionsUseConfiguredTimes(t *testing.T) {
+	loc, err := time.LoadLocation(cleanupTimeZone)
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	schedule := defaultSchedule
+	schedule.cleanupAt = timeOfDay{Hour: 2, Minute: 30}
+	schedule.provisionAt = timeOfDay{Hour: 8, Minute: 45}
+	cleanupAt, provisionAt := schedule.cleanupAt, schedule.provisionAt
+
+	tests := []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{
+			name: "next cleanup later today",
+			got:  nextCleanupTimeKST(time.Date(2026, time.February, 17, 1, 0, 0, 0, loc), loc, cleanupAt),
+			want: time.Date(2026, time.February, 17, 2, 30, 0, 0, loc),
+		},
+		{
+			name: "next cleanup tomorrow",
+			got:  nextCleanupTimeKST(time.Date(2026, time.February, 17, 2, 30, 0, 0, loc), loc, cleanupAt),
+			want: time.Date(2026, time.February, 18, 2, 30, 0, 0, loc),
+		},
+		{
+			name: "first cleanup waits for the configured time inside the window",
+			got:  firstCleanupRunTimeKST(time.Date(2026, time.February, 17, 0, 20, 0, 0, loc), loc, schedule),
+			want: time.Date(2026, time.February, 17, 2, 30, 0, 0, loc),
+		},
+		{
+			name: "first cleanup catches up inside the window",
+			got:  firstCleanupRunTimeKST(time.Date(2026, time.February, 17, 3, 0, 0, 0, loc), loc, schedule),
+			want: time.Date(2026, time.February, 17, 3, 0, 0, 0, loc),
+		},
+		{
+			name: "next provision later today",
+			got:  nextProvisionTimeKST(time.Date(2026, time.February, 17, 7, 10, 0, 0, loc), loc, provisionAt),
+			want: time.Date(2026, time.February, 17, 8, 45, 0, 0, loc),
+		},
+		{
+			name: "first provision catches up after the configured time",
+			got:  firstProvisionRunTimeKST(time.Date(2026, time.February, 17, 9, 0, 0, 0, loc), loc, provisionAt),
+			want: time.Date(2026, time.February, 17, 9, 0, 0, 0, loc),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.got.Equal(tt.want) {
+				t.Fatalf("got %s, want %s", tt.got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestScheduleFromEnv(t *testing.T) {
+	custom := dailySchedule{
+		cleanupAt:   timeOfDay{Hour: 23, Minute: 15},
+		provisionAt: timeOfDay{Hour: 9, Minute: 0},
+		window:      timeWindow{Start: timeOfDay{Hour: 22, Minute: 0}, End: timeOfDay{Hour: 23, Minute: 59}},
+	}
+
+	tests := []struct {
+		name                   string
+		cleanup, provision     string
+		windowStart, windowEnd string
+		want                   dailySchedule
+		wantErr                string
+	}{
+		{name: "defaults", want: defaultSchedule},
+		{
+			name:    "overrides",
+			cleanup: "23:15", provision: "9:00", windowStart: "22:00", windowEnd: "23:59",
+			want: custom,
+		},
+		{name: "malformed cleanup", cleanup: "0110", wantErr: cleanupTimeEnv + `: "0110" is missing the colon`},
+		{name: "malformed provision", provision: "25:00", wantErr: provisionTimeEnv + ": hour 25 is out of range"},
+		{name: "malformed window start", windowStart: "1:5", wantErr: cleanupWindowStartEnv + `: "1:5" needs a two-digit minute`},
+		{name: "cleanup outside window", cleanup: "07:00", wantErr: cleanupTimeEnv + ": 07:00 is outside the cleanup window 00:00-07:00"},
+		{name: "window end before start", windowStart: "06:00", windowEnd: "05:00", wantErr: cleanupWindowEndEnv + " 05:00 is not after " + cleanupWindowStartEnv + " 06:00"},
+		{name: "empty window", windowStart: "03:00", windowEnd: "03:00", wantErr: "is not after"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(cleanupTimeEnv, tt.cleanup)
+			t.Setenv(provisionTimeEnv, tt.provision)
+			t.Setenv(cleanupWindowStartEnv, tt.windowStart)
+			t.Setenv(cleanupWindowEndEnv, tt.windowEnd)
+
+			got, err := scheduleFromEnv(defaultSchedule)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("scheduleFromEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scheduleFromEnv() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("scheduleFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleNextWindow(t *testing.T) {
+	loc, err := time.LoadLocation(cleanupTimeZone)
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		now            time.Time
+		wantStart      string
+		wantEnd        string
+		wantInProgress bool
+		wantNext       string
+	}{
+		{
+			name:      "before midnight looks at tomorrow",
+			now:       time.Date(2026, time.February, 16, 22, 0, 0, 0, loc),
+			wantStart: "2026-02-17T00:00:00+09:00",
+			wantEnd:   "2026-02-17T07:00:00+09:00",
+			wantNext:  "2026-02-17T00:10:00+09:00",
+		},
+		{
+			name:           "inside the window returns the current one",
+			now:            time.Date(2026, time.February, 17, 3, 0, 0, 0, loc),
+			wantStart:      "2026-02-17T00:00:00+09:00",
+			wantEnd:        "2026-02-17T07:00:00+09:00",
+			wantInProgress: true,
+			wantNext:       "2026-02-18T00:10:00+09:00",
+		},
+		{
+			name:      "at window end moves to the next day",
+			now:       time.Date(2026, time.February, 17, 7, 0, 0, 0, loc),
+			wantStart: "2026-02-18T00:00:00+09:00",
+			wantEnd:   "2026-02-18T07:00:00+09:00",
+			wantNext:  "2026-02-18T00:10:00+09:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{
+				logger:     testLogger(),
+				cleanupLoc: loc,
+				schedule:   defaultSchedule,
+				clk:        &fakeClock{now: tt.now},
+			}
+
+			rec := httptest.NewRecorder()
+			a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/window/next", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var got cleanupWindow
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			want := cleanupWindow{
+				Start:       tt.wantStart,
+				End:         tt.wantEnd,
+				Timezone:    cleanupTimeZone,
+				InProgress:  tt.wantInProgress,
+				NextCleanup: tt.wantNext,
+			}
+			if got != want {
+				t.Fatalf("window = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
 func TestIsWithinCleanupWindow(t *testing.T) {
 	loc, err := time.LoadLocation(cleanupTimeZone)
 	if err != nil {
@@ -208,12 +455,63 @@ func TestIsWithinCleanupWindow(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isWithinCleanupWindow(tt.now, loc)
+			got := isWithinCleanupWindow(tt.now, loc, defaultSchedule.window)
+			if got != tt.want {
+				t.Fatalf("isWithinCleanupWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWithinCustomCleanupWindow(t *testing.T) {
+	loc, err := time.LoadLocation(cleanupTimeZone)
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	window := timeWindow{Start: timeOfDay{Hour: 13, Minute: 30}, End: timeOfDay{Hour: 17, Minute: 0}}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{
+			name: "closed at the default window",
+			now:  time.Date(2026, time.February, 17, 0, 10, 0, 0, loc),
+			want: false,
+		},
+		{
+			name: "closed just before start",
+			now:  time.Date(2026, time.February, 17, 13, 29, 59, 0, loc),
+			want: false,
+		},
+		{
+			name: "open at start",
+			now:  time.Date(2026, time.February, 17, 13, 30, 0, 0, loc),
+			want: true,
+		},
+		{
+			name: "closed at end",
+			now:  time.Date(2026, time.February, 17, 17, 0, 0, 0, loc),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isWithinCleanupWindow(tt.now, loc, window)
 			if got != tt.want {
 				t.Fatalf("isWithinCleanupWindow() = %v, want %v", got, tt.want)
 			}
 		})
 	}
+
+	start, end, inProgress := nextCleanupWindow(time.Date(2026, time.February, 17, 18, 0, 0, 0, loc), loc, window)
+	wantStart := time.Date(2026, time.February, 18, 13, 30, 0, 0, loc)
+	wantEnd := time.Date(2026, time.February, 18, 17, 0, 0, 0, loc)
+	if !start.Equal(wantStart) || !end.Equal(wantEnd) || inProgress {
+		t.Fatalf("nextCleanupWindow() = %s, %s, %v; want %s, %s, false", start, end, inProgress, wantStart, wantEnd)
+	}
 }
 
 func TestNextBackoff(t *testing.T) {
@@ -253,6 +551,163 @@ func TestNextBackoff(t *testing.T) {
 	}
 }
 
+func TestNextBackoffJittered(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	floor := 15 * time.Second
+	backoff := floor
+	seen := map[time.Duration]bool{}
+
+	for range 20 {
+		got := nextBackoffJittered(floor, backoff, rnd)
+		if got < floor || got > backoff {
+			t.Fatalf("nextBackoffJittered(%s, %s) = %s, want within [%s, %s]", floor, backoff, got, floor, backoff)
+		}
+		seen[got] = true
+		backoff = nextBackoff(backoff, 5*time.Minute)
+	}
+	if len(seen) < 2 {
+		t.Fatalf("jittered delays did not vary: %v", seen)
+	}
+
+	if got := nextBackoffJittered(time.Minute, 30*time.Second, rnd); got != 30*time.Second {
+		t.Fatalf("cap below floor = %s, want cap %s", got, 30*time.Second)
+	}
+
+	a := &app{}
+	if got := a.backoffDelay(floor, time.Minute); got != time.Minute {
+		t.Fatalf("backoffDelay without jitter = %s, want %s", got, time.Minute)
+	}
+}
+
+func TestNextBackoffScaled(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    time.Duration
+		max        time.Duration
+		multiplier float64
+		want       time.Duration
+	}{
+		{
+			name:       "1.5x grows under max",
+			current:    10 * time.Second,
+			max:        5 * time.Minute,
+			multiplier: 1.5,
+			want:       15 * time.Second,
+		},
+		{
+			name:       "1.5x clamps at max",
+			current:    4 * time.Minute,
+			max:        5 * time.Minute,
+			multiplier: 1.5,
+			want:       5 * time.Minute,
+		},
+		{
+			name:       "2x grows under max",
+			current:    15 * time.Second,
+			max:        5 * time.Minute,
+			multiplier: 2.0,
+			want:       30 * time.Second,
+		},
+		{
+			name:       "2x clamps at max",
+			current:    3 * time.Minute,
+			max:        5 * time.Minute,
+			multiplier: 2.0,
+			want:       5 * time.Minute,
+		},
+		{
+			name:       "unset multiplier doubles",
+			current:    15 * time.Second,
+			max:        5 * time.Minute,
+			multiplier: 0,
+			want:       30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextBackoffScaled(tt.current, tt.max, tt.multiplier)
+			if got != tt.want {
+				t.Fatalf("nextBackoffScaled() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffMultiplierFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{name: "unset uses fallback", value: "", want: 2},
+		{name: "fractional", value: "1.5", want: 1.5},
+		{name: "exactly one rejected", value: "1", wantErr: true},
+		{name: "below one rejected", value: "0.5", wantErr: true},
+		{name: "garbage rejected", value: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(cleanupBackoffMultiplierEnv, tt.value)
+
+			got, err := backoffMultiplierFromEnv(cleanupBackoffMultiplierEnv, 2)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("backoffMultiplierFromEnv() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("backoffMultiplierFromEnv() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("backoffMultiplierFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProvisionConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		region  string
+		plan    string
+		osID    string
+		want    provisionConfig
+		wantErr string
+	}{
+		{name: "defaults", want: provisionConfig{Region: provisionRegionID, Plan: provisionPlanID, OSID: provisionOSID}},
+		{name: "overrides", region: "icn", plan: "vc2-4c-8gb", osID: "2136", want: provisionConfig{Region: "icn", Plan: "vc2-4c-8gb", OSID: 2136}},
+		{name: "partial override", plan: "vc2-1c-1gb", want: provisionConfig{Region: provisionRegionID, Plan: "vc2-1c-1gb", OSID: provisionOSID}},
+		{name: "non-numeric os id", osID: "debian", wantErr: "PAROPAL_OS_ID must be a numeric Vultr OS id"},
+		{name: "negative os id", osID: "-1", wantErr: "PAROPAL_OS_ID must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(provisionRegionEnv, tt.region)
+			t.Setenv(provisionPlanEnv, tt.plan)
+			t.Setenv(provisionOSIDEnv, tt.osID)
+
+			got, err := loadProvisionConfigFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadProvisionConfigFromEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadProvisionConfigFromEnv() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("loadProvisionConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAuthorizedBearerToken(t *testing.T) {
 	const expected = "s3cret-token"
 
@@ -298,90 +753,255 @@ func TestAuthorizedBearerToken(t *testing.T) {
 	}
 }
 
-func TestListAllInstancesPagination(t *testing.T) {
+func TestRequireBearerAcceptsCustomHeader(t *testing.T) {
 	t.Parallel()
 
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet || r.URL.Path != "/v2/instances" {
-			http.NotFound(w, r)
-			return
-		}
+	tests := []struct {
+		name       string
+		authHeader string
+		header     string
+		value      string
+		wantAccess bool
+	}{
+		{name: "authorization default", header: "Authorization", value: "Bearer s3cret-token", wantAccess: true},
+		{name: "custom header not configured", header: "X-Paropal-Token", value: "s3cret-token", wantAccess: false},
+		{name: "custom header", authHeader: "X-Paropal-Token", header: "X-Paropal-Token", value: "s3cret-token", wantAccess: true},
+		{name: "custom header wrong token", authHeader: "X-Paropal-Token", header: "X-Paropal-Token", value: "wrong", wantAccess: false},
+		{name: "authorization with custom header configured", authHeader: "X-Paropal-Token", header: "Authorization", value: "Bearer s3cret-token", wantAccess: true},
+	}
 
-		cursor := r.URL.Query().Get("cursor")
-		switch cursor {
-		case "":
-			resp := listInstancesResponse{
-				Instances: []vultrInstance{{ID: "inst-1", Label: "first"}},
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{shutdownTokens: []string{"s3cret-token"}, authHeader: tt.authHeader}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			if got := a.requireBearer(rec, req, "daemon-admin"); got != tt.wantAccess {
+				t.Fatalf("requireBearer() = %v, want %v", got, tt.wantAccess)
 			}
-			resp.Meta.Links.Next = "https://api.vultr.com/v2/instances?cursor=page-2"
-			writeJSON(w, http.StatusOK, resp)
-		case "page-2":
-			resp := listInstancesResponse{
-				Instances: []vultrInstance{{ID: "inst-2", Label: "second"}},
+			if !tt.wantAccess && rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
 			}
-			writeJSON(w, http.StatusOK, resp)
-		default:
-			t.Fatalf("unexpected cursor %q", cursor)
-		}
-	}))
-	defer server.Close()
-
-	client := newTestVultrClient(server)
-
-	instances, err := client.listAllInstances(context.Background())
-	if err != nil {
-		t.Fatalf("listAllInstances() error = %v", err)
+		})
 	}
+}
 
-	if len(instances) != 2 {
-		t.Fatalf("listAllInstances() returned %d instances, want 2", len(instances))
+func TestRequireBearerAcceptsAnyConfiguredToken(t *testing.T) {
+	t.Setenv(shutdownTokenEnv, " old-token , new-token ,")
+	tokens, err := shutdownTokenFromEnv()
+	if err != nil {
+		t.Fatalf("shutdownTokenFromEnv() error = %v", err)
 	}
-	if instances[0].ID != "inst-1" || instances[1].ID != "inst-2" {
-		t.Fatalf("unexpected instance order/ids: %+v", instances)
+	if want := []string{"old-token", "new-token"}; !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("shutdownTokenFromEnv() = %q, want %q", tokens, want)
 	}
-}
-
-func TestReconcileDestroyAllInstances(t *testing.T) {
-	t.Parallel()
 
-	type state struct {
-		mu          sync.Mutex
-		instances   map[string]vultrInstance
-		listCalls   int
-		deleteCalls int
+	a := &app{shutdownTokens: tokens, authHeader: "X-Paropal-Token"}
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantAccess bool
+	}{
+		{name: "old token", header: "Authorization", value: "Bearer old-token", wantAccess: true},
+		{name: "new token", header: "Authorization", value: "Bearer new-token", wantAccess: true},
+		{name: "new token in custom header", header: "X-Paropal-Token", value: "new-token", wantAccess: true},
+		{name: "third token", header: "Authorization", value: "Bearer other-token", wantAccess: false},
+		{name: "list as token", header: "Authorization", value: "Bearer old-token,new-token", wantAccess: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(tt.header, tt.value)
+			if got := a.requireBearer(httptest.NewRecorder(), req, "daemon-admin"); got != tt.wantAccess {
+				t.Fatalf("requireBearer() = %v, want %v", got, tt.wantAccess)
+			}
+		})
 	}
 
-	st := &state{
-		instances: map[string]vultrInstance{
-			"inst-a": {ID: "inst-a", Label: "a"},
-			"inst-b": {ID: "inst-b", Label: "b"},
-		},
+	t.Setenv(shutdownTokenEnv, " , ")
+	if _, err := shutdownTokenFromEnv(); err == nil {
+		t.Fatal("shutdownTokenFromEnv() error = nil for a list of blanks")
+	}
+}
+
+func TestAdminCIDRsRestrictAuthenticatedEndpoints(t *testing.T) {
+	t.Setenv(adminCIDRsEnv, "203.0.113.0/24, 2001:db8::1/64")
+	prefixes, err := prefixesFromEnv(adminCIDRsEnv)
+	if err != nil {
+		t.Fatalf("prefixesFromEnv() error = %v", err)
+	}
+
+	a := &app{
+		logger:         testLogger(),
+		shutdownTokens: []string{"s3cret-token"},
+		adminCIDRs:     prefixes,
+	}
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		forwarded  string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "in range", remoteAddr: "203.0.113.7:51000", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusOK},
+		{name: "in range ipv6", remoteAddr: "[2001:db8::beef]:51000", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusOK},
+		{name: "ipv4-mapped in range", remoteAddr: "[::ffff:203.0.113.7]:51000", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusOK},
+		{name: "out of range", remoteAddr: "198.51.100.7:51000", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusForbidden},
+		{name: "shutdown out of range", remoteAddr: "198.51.100.7:51000", method: http.MethodPost, path: "/api/shutdown", wantStatus: http.StatusForbidden},
+		{name: "forwarded ignored without trust", remoteAddr: "198.51.100.7:51000", forwarded: "203.0.113.7", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusForbidden},
+		{name: "trusted proxy forwards in range", trustProxy: true, remoteAddr: "10.0.0.2:51000", forwarded: "198.51.100.9, 203.0.113.7", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusOK},
+		{name: "trusted proxy ignores spoofed first hop", trustProxy: true, remoteAddr: "10.0.0.2:51000", forwarded: "203.0.113.7, 198.51.100.9", method: http.MethodGet, path: "/api/config", wantStatus: http.StatusForbidden},
+		{name: "unauthenticated endpoint unaffected", remoteAddr: "198.51.100.7:51000", method: http.MethodGet, path: "/api/runs", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.trustProxy = tt.trustProxy
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Authorization", "Bearer s3cret-token")
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			a.routes().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	t.Setenv(adminCIDRsEnv, "203.0.113.7")
+	if _, err := prefixesFromEnv(adminCIDRsEnv); err == nil {
+		t.Fatal("prefixesFromEnv() error = nil for a bare address")
 	}
+}
+
+func TestVultrClientAppliesPerOperationTimeouts(t *testing.T) {
+	t.Parallel()
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(150 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+
 		switch {
 		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
-			st.mu.Lock()
-			st.listCalls++
-			list := make([]vultrInstance, 0, len(st.instances))
-			for _, inst := range st.instances {
-				list = append(list, inst)
-			}
-			st.mu.Unlock()
-			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
-			resp := listInstancesResponse{Instances: list}
-			writeJSON(w, http.StatusOK, resp)
-		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
-			rawID := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
-			id, err := url.PathUnescape(rawID)
-			if err != nil {
-				t.Fatalf("path unescape: %v", err)
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+	client.timeouts = map[string]time.Duration{
+		"list":   30 * time.Millisecond,
+		"create": 5 * time.Second,
+	}
+
+	started := time.Now()
+	_, err := client.listAllInstances(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("listAllInstances() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(started); elapsed >= 150*time.Millisecond {
+		t.Fatalf("list call took %s, want it cut off at its 30ms bound", elapsed)
+	}
+
+	id, err := client.createInstance(context.Background(), createInstanceRequest{Label: "paropal-test"})
+	if err != nil {
+		t.Fatalf("createInstance() error = %v", err)
+	}
+	if id != "inst-1" {
+		t.Fatalf("createInstance() id = %q, want %q", id, "inst-1")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, time.February, 16, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		raw  string
+		want time.Duration
+	}{
+		{raw: "7", want: 7 * time.Second},
+		{raw: " 0 ", want: 0},
+		{raw: "-3", want: 0},
+		{raw: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second},
+		{raw: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{raw: "soon", want: 0},
+		{raw: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := parseRetryAfter(tt.raw, now); got != tt.want {
+				t.Fatalf("parseRetryAfter(%q) = %s, want %s", tt.raw, got, tt.want)
 			}
+		})
+	}
+}
 
-			st.mu.Lock()
-			st.deleteCalls++
-			delete(st.instances, id)
-			st.mu.Unlock()
+func TestVultrClientReturnsRateLimitError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := newTestVultrClient(server).listAllInstances(context.Background())
+	var limited *rateLimitError
+	if !errors.As(err, &limited) {
+		t.Fatalf("listAllInstances() error = %v, want *rateLimitError", err)
+	}
+	if limited.retryAfter != 7*time.Second {
+		t.Fatalf("retryAfter = %s, want 7s", limited.retryAfter)
+	}
+	if got := rateLimitWait(fmt.Errorf("list instances: %w", err), time.Second); got != 7*time.Second {
+		t.Fatalf("rateLimitWait() = %s, want 7s", got)
+	}
+	if got := rateLimitWait(errors.New("boom"), time.Second); got != time.Second {
+		t.Fatalf("rateLimitWait() for other errors = %s, want the backoff", got)
+	}
+}
+
+func TestReconcileEnsureWaitsForRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		listTimes []time.Time
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			mu.Lock()
+			listTimes = append(listTimes, time.Now())
+			first := len(listTimes) == 1
+			mu.Unlock()
+			if first {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+				return
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
 			w.WriteHeader(http.StatusNoContent)
 		default:
 			http.NotFound(w, r)
@@ -390,225 +1010,7058 @@ func TestReconcileDestroyAllInstances(t *testing.T) {
 	defer server.Close()
 
 	a := &app{
-		vultr:                     newTestVultrClient(server),
-		logger:                    testLogger(),
-		cleanupSettleDelay:        time.Millisecond,
-		cleanupBackoffMin:         time.Millisecond,
-		cleanupBackoffMax:         5 * time.Millisecond,
-		cleanupPassDeleteInterval: time.Millisecond,
+		vultr:               newTestVultrClient(server),
+		logger:              testLogger(),
+		labelLoc:            time.UTC,
+		provisionBackoffMin: time.Millisecond,
+		provisionBackoffMax: 5 * time.Millisecond,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	if err := a.reconcileEnsureParopalInstance(context.Background()); err != nil {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v", err)
+	}
 
-	a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+	mu.Lock()
+	defer mu.Unlock()
+	if len(listTimes) != 2 {
+		t.Fatalf("list calls = %d, want 2", len(listTimes))
+	}
+	if gap := listTimes[1].Sub(listTimes[0]); gap < 900*time.Millisecond {
+		t.Fatalf("retry came after %s, want at least the 1s Retry-After", gap)
+	}
+}
 
-	st.mu.Lock()
-	defer st.mu.Unlock()
+func TestGetInstance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    *vultrInstance
+		wantErr error
+	}{
+		{
+			name:   "decodes instance wrapper",
+			status: http.StatusOK,
+			body:   `{"instance":{"id":"inst-1","label":"paropal-03-10_07-10-00","status":"active","main_ip":"203.0.113.7"}}`,
+			want:   &vultrInstance{ID: "inst-1", Label: "paropal-03-10_07-10-00", Status: "active", MainIP: "203.0.113.7"},
+		},
+		{
+			name:    "not found maps to errInstanceNotFound",
+			status:  http.StatusNotFound,
+			body:    `{"error":"instance not found","status":404}`,
+			wantErr: errInstanceNotFound,
+		},
+		{
+			name:   "malformed body",
+			status: http.StatusOK,
+			body:   `{"instance":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/v2/instances/inst-1" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			got, err := newTestVultrClient(server).getInstance(context.Background(), "inst-1")
+			if tt.want != nil {
+				if err != nil {
+					t.Fatalf("getInstance() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("getInstance() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("getInstance() = %+v, want error", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getInstance() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && errors.Is(err, errInstanceNotFound) {
+				t.Fatalf("getInstance() error = %v, want a decode error", err)
+			}
+		})
+	}
+}
+
+func TestListAllInstancesPagination(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v2/instances" {
+			http.NotFound(w, r)
+			return
+		}
+
+		cursor := r.URL.Query().Get("cursor")
+		switch cursor {
+		case "":
+			resp := listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "first"}},
+			}
+			resp.Meta.Links.Next = "https://api.vultr.com/v2/instances?cursor=page-2"
+			writeJSON(w, http.StatusOK, resp)
+		case "page-2":
+			resp := listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-2", Label: "second"}},
+			}
+			writeJSON(w, http.StatusOK, resp)
+		default:
+			t.Fatalf("unexpected cursor %q", cursor)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+
+	instances, err := client.listAllInstances(context.Background())
+	if err != nil {
+		t.Fatalf("listAllInstances() error = %v", err)
+	}
+
+	if len(instances) != 2 {
+		t.Fatalf("listAllInstances() returned %d instances, want 2", len(instances))
+	}
+	if instances[0].ID != "inst-1" || instances[1].ID != "inst-2" {
+		t.Fatalf("unexpected instance order/ids: %+v", instances)
+	}
+}
+
+func TestDoRequestReturnsVultrAPIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/blocks/blk-1/attach":
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "Block storage is already attached to a server", "status": 400})
+		case "/v2/instances/gone":
+			http.Error(w, "upstream proxy error", http.StatusNotFound)
+		case "/v2/account":
+			w.Header().Set("Retry-After", "3")
+			writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": "Rate limit reached", "status": 429})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := newTestVultrClient(server)
+	ctx := context.Background()
+
+	t.Run("json body", func(t *testing.T) {
+		err := client.attachBlockStorage(ctx, "blk-1", "inst-1", false)
+		var apiErr *vultrAPIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("error %v is not a *vultrAPIError", err)
+		}
+		want := vultrAPIError{StatusCode: http.StatusBadRequest, Message: "Block storage is already attached to a server", Path: "/blocks/blk-1/attach"}
+		if *apiErr != want {
+			t.Fatalf("api error = %+v, want %+v", *apiErr, want)
+		}
+		if got := err.Error(); got != "vultr /blocks/blk-1/attach returned 400 Bad Request: Block storage is already attached to a server" {
+			t.Fatalf("Error() = %q", got)
+		}
+		if !isBlockAlreadyAttachedError(err) {
+			t.Fatal("isBlockAlreadyAttachedError() = false for an already-attached response")
+		}
+	})
+
+	t.Run("raw body fallback", func(t *testing.T) {
+		err := client.do(ctx, http.MethodGet, "/instances/gone", nil)
+		var apiErr *vultrAPIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("error %v is not a *vultrAPIError", err)
+		}
+		if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "upstream proxy error" {
+			t.Fatalf("api error = %+v, want 404 with the raw body", *apiErr)
+		}
+		if !isNotFoundError(err) {
+			t.Fatal("isNotFoundError() = false for a 404")
+		}
+	})
+
+	t.Run("wrapped in rate limit error", func(t *testing.T) {
+		_, err := client.pendingCharges(ctx)
+		var limited *rateLimitError
+		if !errors.As(err, &limited) || limited.retryAfter != 3*time.Second {
+			t.Fatalf("error %v is not a rate limit error with a 3s retry", err)
+		}
+		var apiErr *vultrAPIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "Rate limit reached" {
+			t.Fatalf("errors.As(*vultrAPIError) = %+v from %v", apiErr, err)
+		}
+	})
+
+	t.Run("matchers ignore other errors", func(t *testing.T) {
+		err := errors.New("dial tcp: block already attached 404")
+		if isBlockAlreadyAttachedError(err) || isNotFoundError(err) {
+			t.Fatal("matchers accepted an error that did not come from Vultr")
+		}
+	})
+}
+
+func TestVultrClientRetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("get succeeds after two 503s", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) <= 2 {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "try again", "status": 503})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"account": map[string]any{"pending_charges": 4.25}})
+		}))
+		defer server.Close()
+
+		client := newTestVultrClient(server)
+		client.maxRetries = 3
+		client.retryBackoff = time.Millisecond
+
+		charges, err := client.pendingCharges(context.Background())
+		if err != nil {
+			t.Fatalf("pendingCharges() error = %v", err)
+		}
+		if charges != 4.25 {
+			t.Fatalf("pendingCharges() = %v, want 4.25", charges)
+		}
+		if got := attempts.Load(); got != 3 {
+			t.Fatalf("attempts = %d, want 3", got)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client := newTestVultrClient(server)
+		client.maxRetries = 2
+		client.retryBackoff = time.Millisecond
+
+		err := client.deleteInstance(context.Background(), "inst-1")
+		var apiErr *vultrAPIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("deleteInstance() error = %v, want the 502", err)
+		}
+		if got := attempts.Load(); got != 3 {
+			t.Fatalf("attempts = %d, want 3 (1 + 2 retries)", got)
+		}
+	})
+
+	t.Run("create is never retried", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		client := newTestVultrClient(server)
+		client.maxRetries = 3
+		client.retryBackoff = time.Millisecond
+
+		if _, err := client.createInstance(context.Background(), createInstanceRequest{Label: "paropal-x"}); err == nil {
+			t.Fatal("createInstance() error = nil, want the 503")
+		}
+		if got := attempts.Load(); got != 1 {
+			t.Fatalf("create attempts = %d, want 1", got)
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			http.NotFound(w, r)
+		}))
+		defer server.Close()
+
+		client := newTestVultrClient(server)
+		client.maxRetries = 3
+		client.retryBackoff = time.Millisecond
+
+		if _, err := client.getInstance(context.Background(), "inst-1"); !errors.Is(err, errInstanceNotFound) {
+			t.Fatalf("getInstance() error = %v, want %v", err, errInstanceNotFound)
+		}
+		if got := attempts.Load(); got != 1 {
+			t.Fatalf("attempts = %d, want 1", got)
+		}
+	})
+
+	t.Run("cancellation stops the backoff", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		client := newTestVultrClient(server)
+		client.maxRetries = 5
+		client.retryBackoff = time.Hour
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := client.pendingCharges(ctx); err == nil {
+			t.Fatal("pendingCharges() error = nil, want the 503")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("pendingCharges() took %s; cancellation should end the backoff", elapsed)
+		}
+		if got := attempts.Load(); got != 1 {
+			t.Fatalf("attempts = %d, want 1", got)
+		}
+	})
+}
+
+func TestDoRequestWarnsWhenRateLimitLow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		status    int
+		remaining string
+		wantLog   string
+	}{
+		{name: "plenty remaining", status: http.StatusOK, remaining: "20"},
+		{name: "low remaining", status: http.StatusOK, remaining: "2", wantLog: "approaching vultr rate limit"},
+		{name: "throttled", status: http.StatusTooManyRequests, wantLog: "vultr rate limit exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.remaining != "" {
+					w.Header().Set("RateLimit-Remaining", tt.remaining)
+				}
+				writeJSON(w, tt.status, accountResponse{})
+			}))
+			defer server.Close()
+
+			logger, logs := capturingLogger()
+			client := newTestVultrClient(server)
+			client.logger = logger
+			client.rateLimitWarnRemaining = 5
+
+			_, _ = client.pendingCharges(context.Background())
+
+			out := logs.String()
+			if tt.wantLog == "" {
+				if strings.Contains(out, "rate limit") {
+					t.Fatalf("unexpected rate limit warning: %s", out)
+				}
+				return
+			}
+			if !strings.Contains(out, tt.wantLog) {
+				t.Fatalf("expected %q in logs, got: %s", tt.wantLog, out)
+			}
+		})
+	}
+}
+
+func TestListAllInstancesReturnsPartialPagesOnFailure(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			resp := listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-1"}},
+			}
+			resp.Meta.Links.Next = "https://api.vultr.com/v2/instances?cursor=page-2"
+			writeJSON(w, http.StatusOK, resp)
+		default:
+			http.Error(w, "temporary upstream failure", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+
+	instances, err := client.listAllInstances(context.Background())
+	if !errors.Is(err, errIncompleteInstanceList) {
+		t.Fatalf("listAllInstances() error = %v, want errIncompleteInstanceList", err)
+	}
+	if len(instances) != 1 || instances[0].ID != "inst-1" {
+		t.Fatalf("listAllInstances() partial instances = %+v, want [inst-1]", instances)
+	}
+}
+
+func TestReconcileDestroyAllInstances(t *testing.T) {
+	t.Parallel()
+
+	type state struct {
+		mu          sync.Mutex
+		instances   map[string]vultrInstance
+		listCalls   int
+		deleteCalls int
+	}
+
+	st := &state{
+		instances: map[string]vultrInstance{
+			"inst-a": {ID: "inst-a", Label: "a"},
+			"inst-b": {ID: "inst-b", Label: "b"},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			st.mu.Lock()
+			st.listCalls++
+			list := make([]vultrInstance, 0, len(st.instances))
+			for _, inst := range st.instances {
+				list = append(list, inst)
+			}
+			st.mu.Unlock()
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+			resp := listInstancesResponse{Instances: list}
+			writeJSON(w, http.StatusOK, resp)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			rawID := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
+			id, err := url.PathUnescape(rawID)
+			if err != nil {
+				t.Fatalf("path unescape: %v", err)
+			}
+
+			st.mu.Lock()
+			st.deleteCalls++
+			delete(st.instances, id)
+			st.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupAllInstances:       true,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.instances) != 0 {
+		t.Fatalf("reconcileDestroyAllInstances() left %d instances; want 0", len(st.instances))
+	}
+	if st.deleteCalls != 2 {
+		t.Fatalf("expected 2 delete calls, got %d", st.deleteCalls)
+	}
+	if st.listCalls < 2 {
+		t.Fatalf("expected at least 2 list calls, got %d", st.listCalls)
+	}
+}
+
+func TestCleanupDeletePassConcurrent(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+		calls    int
+	)
+	failing := map[string]bool{"inst-03": true, "inst-07": true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || !strings.HasPrefix(r.URL.Path, "/v2/instances/") {
+			http.NotFound(w, r)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
+
+		mu.Lock()
+		calls++
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if failing[id] {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	instances := make([]vultrInstance, 0, 10)
+	for i := range 10 {
+		id := fmt.Sprintf("inst-%02d", i)
+		instances = append(instances, vultrInstance{ID: id, Label: "paropal-" + id})
+	}
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.UTC,
+		cleanupPassDeleteInterval: time.Millisecond,
+		cleanupDeleteConcurrency:  4,
+	}
+
+	deleted, err := a.cleanupDeletePass(context.Background(), a.vultr, "", instances, time.Now().Add(5*time.Second))
+	if err != nil {
+		t.Fatalf("cleanupDeletePass() error = %v", err)
+	}
+
+	sort.Strings(deleted)
+	want := []string{"inst-00", "inst-01", "inst-02", "inst-04", "inst-05", "inst-06", "inst-08", "inst-09"}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted = %v, want %v", deleted, want)
+	}
+	if failures := len(instances) - len(deleted); failures != 2 {
+		t.Fatalf("delete failures = %d, want 2", failures)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 10 {
+		t.Fatalf("delete calls = %d, want 10", calls)
+	}
+	if peak < 2 || peak > 4 {
+		t.Fatalf("peak concurrent deletes = %d, want between 2 and 4", peak)
+	}
+}
+
+func TestPruneOldInstances(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+				{ID: "old", Label: "paropal-03-07_07-10-00", DateCreated: "2026-03-07T07:10:00+00:00"},
+				{ID: "fresh", Label: "paropal-03-10_07-10-00", DateCreated: "2026-03-10T07:10:00+00:00"},
+				{ID: "old-label", Label: "paropal-03-06_07-10-00"},
+				{ID: "foreign", Label: "shared-db", DateCreated: "2025-01-01T00:00:00+00:00"},
+			}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			mu.Lock()
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/instances/"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:       newTestVultrClient(server),
+		logger:      testLogger(),
+		labelLoc:    time.UTC,
+		clk:         &fakeClock{now: now},
+		pruneMaxAge: 48 * time.Hour,
+	}
+
+	if err := a.pruneOldInstances(context.Background()); err != nil {
+		t.Fatalf("pruneOldInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(deleted)
+	if want := []string{"old", "old-label"}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted = %v, want %v", deleted, want)
+	}
+}
+
+func TestPruneOldInstancesDetachesBlockAndHonoursDryRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		dryRun    bool
+		wantCalls []string
+		wantLog   string
+	}{
+		{
+			name:   "deletes after detaching",
+			dryRun: false,
+			wantCalls: []string{
+				"GET /v2/blocks/" + provisionBlockStorageID,
+				"POST /v2/blocks/" + provisionBlockStorageID + "/detach",
+				"DELETE /v2/instances/old",
+			},
+			wantLog: "age prune deleted over-age instance",
+		},
+		{
+			name:    "dry run only logs",
+			dryRun:  true,
+			wantLog: "age prune dry run: would delete over-age instance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu    sync.Mutex
+				calls []string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet && r.URL.Path == "/v2/instances" {
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+						{ID: "old", Label: "paropal-03-07_07-10-00", DateCreated: "2026-03-07T07:10:00+00:00"},
+					}})
+					return
+				}
+				mu.Lock()
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				mu.Unlock()
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+					writeJSON(w, http.StatusOK, getBlockResponse{Block: vultrBlock{ID: provisionBlockStorageID, AttachedToInstance: "old"}})
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer server.Close()
+
+			logger, logs := capturingLogger()
+			a := &app{
+				vultr:         newTestVultrClient(server),
+				logger:        logger,
+				labelLoc:      time.UTC,
+				clk:           &fakeClock{now: time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)},
+				pruneMaxAge:   48 * time.Hour,
+				cleanupDryRun: tt.dryRun,
+			}
+
+			if err := a.pruneOldInstances(context.Background()); err != nil {
+				t.Fatalf("pruneOldInstances() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Fatalf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Fatalf("logs missing %q:\n%s", tt.wantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestReadOnlyModeBlocksMutations(t *testing.T) {
+	t.Parallel()
+
+	var mutations atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			mutations.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+			{ID: "inst-a", Label: "paropal-02-16_07-10-00", DateCreated: "2020-01-01T00:00:00+00:00"},
+		}})
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+	client.readOnly = true
+	a := &app{
+		vultr:       client,
+		logger:      testLogger(),
+		cleanupLoc:  time.UTC,
+		labelLoc:    time.UTC,
+		readOnly:    true,
+		pruneMaxAge: time.Hour,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+	if err := a.reconcileEnsureParopalInstance(ctx); err != nil {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v", err)
+	}
+	if err := a.pruneOldInstances(ctx); err != nil {
+		t.Fatalf("pruneOldInstances() error = %v", err)
+	}
+	if err := client.deleteInstance(ctx, "inst-a"); !errors.Is(err, errReadOnly) {
+		t.Fatalf("deleteInstance() error = %v, want %v", err, errReadOnly)
+	}
+	if got := mutations.Load(); got != 0 {
+		t.Fatalf("server saw %d mutating requests, want 0", got)
+	}
+
+	called := false
+	handler := a.refuseWhenReadOnly(func(w http.ResponseWriter, r *http.Request) { called = true })
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/provision", nil))
+	if rec.Code != http.StatusLocked {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusLocked)
+	}
+	if called {
+		t.Fatal("wrapped handler ran in read-only mode")
+	}
+}
+
+func TestAuthenticatedRoutesCheckBearerFirst(t *testing.T) {
+	t.Parallel()
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		writeJSON(w, http.StatusOK, accountResponse{})
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                  newTestVultrClient(server),
+		logger:                 testLogger(),
+		readOnly:               true,
+		shutdownTokens:         []string{"s3cret-token"},
+		dashboardMaxConcurrent: 1,
+	}
+	handler := a.routes()
+
+	// Hold the only Vultr slot so a request that reached the limiter would
+	// be shed with 503.
+	first := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/charges", nil))
+		first <- rec.Code
+	}()
+	<-entered
+	defer func() {
+		close(release)
+		<-first
+	}()
+
+	tests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{path: "/api/instance/power", want: http.StatusUnauthorized},
+		{path: "/api/provision", want: http.StatusUnauthorized},
+		{path: "/api/instance/power", token: "s3cret-token", want: http.StatusServiceUnavailable},
+		{path: "/api/provision", token: "s3cret-token", want: http.StatusLocked},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"action":"reboot"}`))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Fatalf("POST %s (token %q) status = %d, want %d", tt.path, tt.token, rec.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("POST %s without a token has no WWW-Authenticate challenge", tt.path)
+		}
+	}
+}
+
+func TestMetricsAfterCleanup(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		instances = map[string]vultrInstance{
+			"inst-a": {ID: "inst-a", Label: "paropal-a"},
+			"inst-b": {ID: "inst-b", Label: "paropal-b"},
+		}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			list := make([]vultrInstance, 0, len(instances))
+			for _, inst := range instances {
+				list = append(list, inst)
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-b":
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "try again"})
+			delete(instances, "inst-b")
+		case r.Method == http.MethodDelete:
+			delete(instances, strings.TrimPrefix(r.URL.Path, "/v2/instances/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.UTC,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+	a.vultr.requestDurations = a.metrics.collectors().vultrRequests
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(time.Minute))
+	a.completeRun(ctx, "cleanup", &a.cleanupFailures, err)
+
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE paropal_instances_deleted_total counter\nparopal_instances_deleted_total 1\n",
+		"paropal_delete_failures_total 1\n",
+		"paropal_cleanup_runs_total 1\n",
+		"paropal_provision_runs_total 0\n",
+		`paropal_vultr_request_duration_seconds_bucket{operation="delete",le="+Inf"} 2`,
+		`paropal_vultr_request_duration_seconds_count{operation="list"} `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("/metrics is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestCleanupTargetsLogsDecisionPerInstance(t *testing.T) {
+	t.Parallel()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		logger:              logger,
+		daemonID:            "d1",
+		cleanupOwnOnly:      true,
+		cleanupLogDecisions: true,
+	}
+	instances := []vultrInstance{
+		{ID: "inst-foreign", Label: "shared-db"},
+		{ID: "inst-other", Label: "paropal-02-16_07-10-00", Tags: []string{daemonTagPrefix + "d2"}},
+		{ID: "inst-own", Label: "paropal-02-17_07-10-00", Tags: []string{daemonTagPrefix + "d1"}},
+	}
+
+	targets := a.cleanupTargets(instances)
+	if len(targets) != 1 || targets[0].ID != "inst-own" {
+		t.Fatalf("cleanupTargets() = %+v, want only inst-own", targets)
+	}
+
+	wants := map[string]string{
+		"inst-foreign": `decision=spare reason="label does not start with paropal-"`,
+		"inst-other":   `decision=spare reason="missing tag paropal-daemon-d1"`,
+		"inst-own":     `decision=delete reason="label starts with paropal- and tagged paropal-daemon-d1"`,
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	for id, want := range wants {
+		found := false
+		for _, line := range lines {
+			if strings.Contains(line, "instance_id="+id+" ") {
+				found = true
+				if !strings.Contains(line, "level=INFO") || !strings.Contains(line, want) {
+					t.Fatalf("decision log for %s = %q, want info level with %s", id, line, want)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("no decision log for %s in:\n%s", id, logs.String())
+		}
+	}
+}
+
+func TestReconcileDestroySnapshotsBeforeEachDelete(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		instances = map[string]vultrInstance{
+			"inst-a": {ID: "inst-a", Label: "paropal-02-16_07-10-00"},
+			"inst-b": {ID: "inst-b", Label: "paropal-02-17_07-10-00"},
+		}
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			list := make([]vultrInstance, 0, len(instances))
+			for _, inst := range instances {
+				list = append(list, inst)
+			}
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/snapshots":
+			var req createSnapshotRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode snapshot request: %v", err)
+			}
+			calls = append(calls, "snapshot "+req.InstanceID)
+			writeJSON(w, http.StatusCreated, snapshotResponse{Snapshot: vultrSnapshot{ID: "snap-" + req.InstanceID, Status: "pending"}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			id := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
+			calls = append(calls, "delete "+id)
+			delete(instances, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                       newTestVultrClient(server),
+		logger:                      testLogger(),
+		cleanupLoc:                  time.UTC,
+		cleanupSettleDelay:          time.Millisecond,
+		cleanupBackoffMin:           time.Millisecond,
+		cleanupBackoffMax:           5 * time.Millisecond,
+		cleanupPassDeleteInterval:   time.Millisecond,
+		cleanupSnapshotBeforeDelete: true,
+		cleanupSnapshotDelay:        time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"snapshot inst-a", "delete inst-a", "snapshot inst-b", "delete inst-b"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestCleanupDeleteInstanceSkipsWhenSnapshotFails(t *testing.T) {
+	t.Parallel()
+
+	var deletes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/snapshots":
+			http.Error(w, `{"error":"snapshot quota exceeded"}`, http.StatusBadRequest)
+		case r.Method == http.MethodDelete:
+			deletes.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                       newTestVultrClient(server),
+		logger:                      testLogger(),
+		cleanupLoc:                  time.UTC,
+		cleanupSnapshotBeforeDelete: true,
+	}
+
+	instance := vultrInstance{ID: "inst-a", Label: "paropal-02-16_07-10-00"}
+	ok, err := a.cleanupDeleteInstance(context.Background(), a.vultr, "", instance, time.Now().Add(time.Minute))
+	if err != nil || ok {
+		t.Fatalf("cleanupDeleteInstance() = %v, %v; want false, nil", ok, err)
+	}
+	if got := deletes.Load(); got != 0 {
+		t.Fatalf("delete calls = %d, want 0 when the snapshot failed", got)
+	}
+	if got := testutil.ToFloat64(a.metrics.collectors().deleteFailures); got != 1 {
+		t.Fatalf("delete failures = %v, want 1", got)
+	}
+}
+
+func TestReconcileDestroySparesPinnedInstances(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		instances = map[string]vultrInstance{
+			"inst-a": {ID: "inst-a", Label: "paropal-02-16_07-10-00"},
+			"inst-p": {ID: "inst-p", Label: "paropal-pinned-build"},
+		}
+		deleted []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			list := make([]vultrInstance, 0, len(instances))
+			for _, inst := range instances {
+				list = append(list, inst)
+			}
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			id := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
+			deleted = append(deleted, id)
+			delete(instances, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		pinnedMarker:              "-pinned-",
+		cleanupLoc:                time.UTC,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"inst-a"}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted = %v, want %v", deleted, want)
+	}
+}
+
+func TestReconcileDestroyConfirmsDeletesByLookup(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		deleted   bool
+		listCalls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			// The listing lags behind the delete.
+			listCalls++
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+				{ID: "inst-1", Label: "paropal-02-16_07-10-00"},
+			}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-1":
+			if deleted {
+				http.Error(w, `{"error":"Invalid instance-id."}`, http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, getInstanceResponse{Instance: vultrInstance{ID: "inst-1", Status: "active"}})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-1":
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.UTC,
+		cleanupSettleDelay:        time.Minute,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+		cleanupConfirmDeletes:     true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if listCalls != 1 {
+		t.Fatalf("list calls = %d, want 1; a confirmed delete should skip the settle and re-list", listCalls)
+	}
+}
+
+func TestDeletesConfirmedFallsBackWhileInstanceRemains(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/instances/inst-gone":
+			http.Error(w, `{"error":"Invalid instance-id."}`, http.StatusNotFound)
+		case "/v2/instances/inst-lingering":
+			writeJSON(w, http.StatusOK, getInstanceResponse{Instance: vultrInstance{ID: "inst-lingering", Status: "active"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{logger: testLogger()}
+	client := newTestVultrClient(server)
+	if !a.deletesConfirmed(context.Background(), client, []string{"inst-gone"}) {
+		t.Fatalf("deletesConfirmed() = false, want true when every lookup is not-found")
+	}
+	if a.deletesConfirmed(context.Background(), client, []string{"inst-gone", "inst-lingering"}) {
+		t.Fatalf("deletesConfirmed() = true, want false while an instance is still present")
+	}
+}
+
+func TestReconcileDestroyOnlyDeletesPrefixedInstances(t *testing.T) {
+	t.Parallel()
+
+	type state struct {
+		mu        sync.Mutex
+		instances map[string]vultrInstance
+		deleted   []string
+	}
+
+	st := &state{
+		instances: map[string]vultrInstance{
+			"inst-a": {ID: "inst-a", Label: "paropal-02-16_07-10-00"},
+			"inst-b": {ID: "inst-b", Label: "shared-db"},
+			"inst-c": {ID: "inst-c", Label: "paropal-02-17_07-10-00"},
+			"inst-d": {ID: "inst-d", Label: "web-paropal-1"},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			list := make([]vultrInstance, 0, len(st.instances))
+			for _, inst := range st.instances {
+				list = append(list, inst)
+			}
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			id := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
+			st.deleted = append(st.deleted, id)
+			delete(st.instances, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    logger,
+		cleanupLoc:                time.UTC,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sort.Strings(st.deleted)
+	if want := []string{"inst-a", "inst-c"}; !reflect.DeepEqual(st.deleted, want) {
+		t.Fatalf("deleted = %v, want %v", st.deleted, want)
+	}
+	if _, ok := st.instances["inst-b"]; !ok {
+		t.Fatal("non-prefixed instance inst-b was deleted")
+	}
+	if out := logs.String(); !strings.Contains(out, "sparing instance without paropal label prefix") || !strings.Contains(out, "label=shared-db") {
+		t.Fatalf("expected debug log for spared instance, got:\n%s", out)
+	}
+}
+
+func TestReconcileDestroyDryRunDeletesNothing(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		deleteCalls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+				{ID: "inst-a", Label: "paropal-02-16_07-10-00"},
+				{ID: "inst-b", Label: "paropal-02-17_07-10-00"},
+			}})
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			deleteCalls++
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    logger,
+		cleanupLoc:                time.UTC,
+		cleanupDryRun:             true,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if deleteCalls != 0 {
+		t.Fatalf("dry run sent %d DELETE requests, want 0", deleteCalls)
+	}
+
+	out := logs.String()
+	if got := strings.Count(out, "cleanup dry run: would delete instance"); got != 2 {
+		t.Fatalf("would-delete log lines = %d, want 2:\n%s", got, out)
+	}
+	if !strings.Contains(out, "instance_id=inst-b") || !strings.Contains(out, "candidates=2") {
+		t.Fatalf("dry run log missing candidate details or summary:\n%s", out)
+	}
+}
+
+func TestReconcileDestroyOwnOnlyHonorsDaemonID(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		deleted []string
+		gone    = map[string]bool{}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			var list []vultrInstance
+			for _, inst := range []vultrInstance{
+				{ID: "inst-mine", Label: "paropal-02-16_07-10-00", Tags: []string{"paropal-daemon-seoul"}},
+				{ID: "inst-theirs", Label: "paropal-02-16_07-11-00", Tags: []string{"paropal-daemon-tokyo"}},
+				{ID: "inst-untagged", Label: "paropal-02-16_07-12-00"},
+			} {
+				if !gone[inst.ID] {
+					list = append(list, inst)
+				}
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			id := strings.TrimPrefix(r.URL.Path, "/v2/instances/")
+			deleted = append(deleted, id)
+			gone[id] = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.UTC,
+		daemonID:                  "seoul",
+		cleanupOwnOnly:            true,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"inst-mine"}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted = %v, want %v", deleted, want)
+	}
+}
+
+func TestReconcileDestroyDetachesBlockBeforeDeletingItsInstance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		detachCode int
+		detachBody string
+		wantLog    string
+	}{
+		{name: "detached", detachCode: http.StatusNoContent, wantLog: "detached block storage before deleting its instance"},
+		{name: "not attached is benign", detachCode: http.StatusBadRequest, detachBody: `{"error":"Block storage is not attached to an instance"}`, wantLog: "block storage already detached; continuing"},
+		{name: "other errors still delete", detachCode: http.StatusInternalServerError, detachBody: `{"error":"internal error"}`, wantLog: "failed to detach block storage before cleanup; deleting its instance anyway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu      sync.Mutex
+				calls   []string
+				deleted bool
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.Method != http.MethodGet {
+					calls = append(calls, r.Method+" "+r.URL.Path)
+				}
+
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					list := []vultrInstance{{ID: "inst-other", Label: "shared-db"}}
+					if !deleted {
+						list = append(list, vultrInstance{ID: "inst-1", Label: "paropal-02-16_07-10-00"})
+					}
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+					writeJSON(w, http.StatusOK, getBlockResponse{Block: vultrBlock{ID: provisionBlockStorageID, AttachedToInstance: "inst-1"}})
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/detach":
+					if tt.detachBody != "" {
+						http.Error(w, tt.detachBody, tt.detachCode)
+						return
+					}
+					w.WriteHeader(tt.detachCode)
+				case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-1":
+					deleted = true
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			logger, logs := capturingLogger()
+			a := &app{
+				vultr:                     newTestVultrClient(server),
+				logger:                    logger,
+				cleanupLoc:                time.UTC,
+				cleanupSettleDelay:        time.Millisecond,
+				cleanupBackoffMin:         time.Millisecond,
+				cleanupBackoffMax:         5 * time.Millisecond,
+				cleanupPassDeleteInterval: time.Millisecond,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+				t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			want := []string{
+				"POST /v2/blocks/" + provisionBlockStorageID + "/detach",
+				"DELETE /v2/instances/inst-1",
+			}
+			if !reflect.DeepEqual(calls, want) {
+				t.Fatalf("mutating calls:\n got: %#v\nwant: %#v", calls, want)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Fatalf("logs missing %q:\n%s", tt.wantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestReconcileDestroyLeavesBlockOnSparedInstance(t *testing.T) {
+	t.Parallel()
+
+	var detaches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{{ID: "inst-other", Label: "shared-db"}}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			writeJSON(w, http.StatusOK, getBlockResponse{Block: vultrBlock{ID: provisionBlockStorageID, AttachedToInstance: "inst-other"}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/detach":
+			detaches.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.UTC,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	if err := a.reconcileDestroyAllInstances(context.Background(), time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+	if got := detaches.Load(); got != 0 {
+		t.Fatalf("detach calls = %d, want 0 for a block on an instance cleanup spares", got)
+	}
+}
+
+func TestReconcileDestroyKeepsBlockAttachedWhenPendingChargesSkip(t *testing.T) {
+	t.Parallel()
+
+	var detaches, deletes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/account":
+			writeJSON(w, http.StatusOK, accountResponse{})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00"}}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			writeJSON(w, http.StatusOK, getBlockResponse{Block: vultrBlock{ID: provisionBlockStorageID, AttachedToInstance: "inst-1"}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/detach":
+			detaches.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			deletes.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                        newTestVultrClient(server),
+		logger:                       testLogger(),
+		cleanupLoc:                   time.UTC,
+		cleanupRequirePendingCharges: true,
+		cleanupSettleDelay:           time.Millisecond,
+		cleanupBackoffMin:            time.Millisecond,
+		cleanupBackoffMax:            5 * time.Millisecond,
+		cleanupPassDeleteInterval:    time.Millisecond,
+	}
+
+	if err := a.reconcileDestroyAllInstances(context.Background(), time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+	if got := deletes.Load(); got != 0 {
+		t.Fatalf("delete calls = %d, want 0 when pending charges skip the run", got)
+	}
+	if got := detaches.Load(); got != 0 {
+		t.Fatalf("detach calls = %d, want 0: the kept instance must keep its block", got)
+	}
+}
+
+func TestReconcileDeepCleanupDetachesBlockAfterDelete(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		calls   []string
+		deleted bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodGet {
+			calls = append(calls, r.Method+" "+r.URL.Path)
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			var list []vultrInstance
+			if !deleted {
+				list = []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00"}}
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-1":
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			// Attached to an instance the listing no longer shows, so only
+			// the deep cleanup after the deletes detaches it.
+			writeJSON(w, http.StatusOK, getBlockResponse{Block: vultrBlock{ID: provisionBlockStorageID, AttachedToInstance: "inst-gone"}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/detach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/reserved-ips":
+			writeJSON(w, http.StatusOK, listReservedIPsResponse{ReservedIPs: []vultrReservedIP{
+				{ID: "rip-1", Label: "paropal-ip"},
+				{ID: "rip-2", Label: "paropal-busy", InstanceID: "other"},
+				{ID: "rip-3", Label: "someone-else"},
+			}})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/reserved-ips/rip-1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.UTC,
+		cleanupDeep:               true,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"DELETE /v2/instances/inst-1",
+		"POST /v2/blocks/" + provisionBlockStorageID + "/detach",
+		"DELETE /v2/reserved-ips/rip-1",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("mutating calls:\n got: %#v\nwant: %#v", calls, want)
+	}
+}
+
+func TestReconcileRetriesAfterTransientListFailure(t *testing.T) {
+	t.Parallel()
+
+	type state struct {
+		mu                sync.Mutex
+		listCalls         int
+		failuresRemaining int
+	}
+
+	st := &state{failuresRemaining: 1}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v2/instances" {
+			http.NotFound(w, r)
+			return
+		}
+
+		st.mu.Lock()
+		st.listCalls++
+		shouldFail := st.failuresRemaining > 0
+		if shouldFail {
+			st.failuresRemaining--
+		}
+		st.mu.Unlock()
+
+		if shouldFail {
+			http.Error(w, "temporary upstream failure", http.StatusBadGateway)
+			return
+		}
+
+		resp := listInstancesResponse{Instances: nil}
+		writeJSON(w, http.StatusOK, resp)
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.listCalls < 2 {
+		t.Fatalf("expected retry after transient failure; list calls = %d", st.listCalls)
+	}
+}
+
+func TestReconcileStopsAtCutoff(t *testing.T) {
+	t.Parallel()
+
+	type state struct {
+		mu          sync.Mutex
+		listCalls   int
+		deleteCalls int
+	}
+
+	st := &state{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if r.Method == http.MethodGet && r.URL.Path == "/v2/instances" {
+			st.listCalls++
+			resp := listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-a", Label: "a"}},
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/") {
+			st.deleteCalls++
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.FixedZone("KST", 9*60*60),
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Cutoff already passed: no list/delete should be attempted.
+	a.reconcileDestroyAllInstances(ctx, time.Now().Add(-time.Second))
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.listCalls != 0 {
+		t.Fatalf("expected 0 list calls after cutoff, got %d", st.listCalls)
+	}
+	if st.deleteCalls != 0 {
+		t.Fatalf("expected 0 delete calls after cutoff, got %d", st.deleteCalls)
+	}
+}
+
+func TestReconcileSkipsPassWhenWindowRemainingBelowThreshold(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		listCalls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet && r.URL.Path == "/v2/instances" {
+			listCalls++
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-a", Label: "a"}},
+			})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupLoc:                time.FixedZone("KST", 9*60*60),
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+		cleanupMinWindowRemaining: time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// Cutoff is still ahead but closer than the configured minimum.
+	a.reconcileDestroyAllInstances(ctx, time.Now().Add(500*time.Millisecond))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if listCalls != 0 {
+		t.Fatalf("expected 0 list calls below window threshold, got %d", listCalls)
+	}
+}
+
+func TestReconcileSkipsCleanupWhenPendingChargesLow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		charges     float64
+		wantDeletes int
+	}{
+		{name: "zero charges skip cleanup", charges: 0, wantDeletes: 0},
+		{name: "charges above threshold delete", charges: 1.25, wantDeletes: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu          sync.Mutex
+				deleteCalls int
+				deleted     bool
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/account":
+					var resp accountResponse
+					resp.Account.PendingCharges = tt.charges
+					writeJSON(w, http.StatusOK, resp)
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					var list []vultrInstance
+					if !deleted {
+						list = []vultrInstance{{ID: "inst-a", Label: "paropal-a"}}
+					}
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+				case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-a":
+					deleteCalls++
+					deleted = true
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:                        newTestVultrClient(server),
+				logger:                       testLogger(),
+				cleanupSettleDelay:           time.Millisecond,
+				cleanupBackoffMin:            time.Millisecond,
+				cleanupBackoffMax:            5 * time.Millisecond,
+				cleanupPassDeleteInterval:    time.Millisecond,
+				cleanupRequirePendingCharges: true,
+				cleanupMinPendingCharges:     0,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if deleteCalls != tt.wantDeletes {
+				t.Fatalf("delete calls = %d, want %d", deleteCalls, tt.wantDeletes)
+			}
+		})
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockReinstallsAfterCreate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+			return
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			var req createInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode create request: %v", err)
+			}
+			if strings.TrimSpace(req.UserData) == "" {
+				t.Fatalf("expected non-empty user_data in create request")
+			}
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-123"},
+			})
+			return
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			var req attachBlockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode attach request: %v", err)
+			}
+			if req.InstanceID != "inst-123" {
+				t.Fatalf("attach request instance_id=%q, want %q", req.InstanceID, "inst-123")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-123/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:    newTestVultrClient(server),
+		logger:   testLogger(),
+		labelLoc: time.UTC,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var state provisionRunState
+	if err := a.ensureParopalInstanceAndBlock(ctx, &state); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+	if state.instanceID != "inst-123" {
+		t.Fatalf("state.instanceID=%q, want %q", state.instanceID, "inst-123")
+	}
+
+	mu.Lock()
+	got := append([]string(nil), calls...)
+	mu.Unlock()
+
+	want := []string{
+		"GET /v2/instances",
+		"POST /v2/instances",
+		"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
+		"POST /v2/instances/inst-123/reinstall",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected call sequence:\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestHandleChargesServesStaleValueOnFailure(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		fail  bool
+		calls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if fail {
+			http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var resp accountResponse
+		resp.Account.PendingCharges = 4.2
+		writeJSON(w, http.StatusOK, resp)
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:             newTestVultrClient(server),
+		logger:            testLogger(),
+		chargesRetries:    2,
+		chargesRetryDelay: time.Millisecond,
+	}
+	handler := a.routes()
+
+	get := func() (int, map[string]any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/charges", nil))
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode /api/charges: %v", err)
+		}
+		return rec.Code, body
+	}
+
+	if code, body := get(); code != http.StatusOK || body["pending_charges"] != 4.2 || body["stale"] != false {
+		t.Fatalf("fresh charges = %d %v, want 200 with stale=false", code, body)
+	}
+
+	mu.Lock()
+	fail = true
+	calls = 0
+	mu.Unlock()
+
+	code, body := get()
+	if code != http.StatusOK {
+		t.Fatalf("stale charges status = %d, want %d", code, http.StatusOK)
+	}
+	if body["pending_charges"] != 4.2 || body["stale"] != true {
+		t.Fatalf("stale charges body = %v, want cached 4.2 with stale=true", body)
+	}
+	if age, ok := body["age_seconds"].(float64); !ok || age < 0 || age > 5 {
+		t.Fatalf("stale charges age_seconds = %v, want a small age", body["age_seconds"])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Fatalf("upstream calls while failing = %d, want 3 (1 + 2 retries)", calls)
+	}
+}
+
+func TestHandleChargesServesCachedValueWithinTTL(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if failing.Load() {
+			http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"account": map[string]any{"pending_charges": float64(n)}})
+	}))
+	defer server.Close()
+
+	clk := &fakeClock{now: time.Date(2026, time.February, 16, 12, 0, 0, 0, time.UTC)}
+	a := &app{
+		vultr:           newTestVultrClient(server),
+		logger:          testLogger(),
+		clk:             clk,
+		chargesCacheTTL: 30 * time.Second,
+	}
+	handler := a.routes()
+
+	get := func() (*httptest.ResponseRecorder, map[string]any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/charges", nil))
+		var body map[string]any
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode /api/charges: %v", err)
+		}
+		return rec, body
+	}
+
+	get()
+	clk.advance(10 * time.Second)
+	if _, body := get(); body["pending_charges"] != float64(1) || body["stale"] != false {
+		t.Fatalf("second body = %v, want the cached 1", body)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("upstream calls after two rapid requests = %d, want 1", got)
+	}
+
+	clk.advance(30 * time.Second)
+	if _, body := get(); body["pending_charges"] != float64(2) {
+		t.Fatalf("body after expiry = %v, want a fresh 2", body)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("upstream calls after expiry = %d, want 2", got)
+	}
+
+	failing.Store(true)
+	clk.advance(time.Minute)
+	rec, body := get()
+	if body["pending_charges"] != float64(2) || body["stale"] != true {
+		t.Fatalf("body while failing = %v, want the stale 2", body)
+	}
+	if got := rec.Header().Get("Warning"); !strings.HasPrefix(got, "110 ") {
+		t.Fatalf("Warning header = %q, want a 110 stale warning", got)
+	}
+	if body["age_seconds"] != float64(60) {
+		t.Fatalf("age_seconds = %v, want 60", body["age_seconds"])
+	}
+}
+
+func TestHandleChargesFailsWithoutCachedValue(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	a := &app{vultr: newTestVultrClient(server), logger: testLogger()}
+
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/charges", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestDashboardVultrCallLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		queueTimeout time.Duration
+		wantSecond   int
+	}{
+		{name: "sheds excess requests", queueTimeout: 0, wantSecond: http.StatusServiceUnavailable},
+		{name: "queues excess requests", queueTimeout: 2 * time.Second, wantSecond: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			entered := make(chan struct{}, 2)
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				entered <- struct{}{}
+				<-release
+				writeJSON(w, http.StatusOK, accountResponse{})
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:                  newTestVultrClient(server),
+				logger:                 testLogger(),
+				dashboardMaxConcurrent: 1,
+				dashboardQueueTimeout:  tt.queueTimeout,
+			}
+			handler := a.routes()
+
+			serve := func() <-chan int {
+				done := make(chan int, 1)
+				go func() {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/charges", nil))
+					done <- rec.Code
+				}()
+				return done
+			}
+
+			first := serve()
+			<-entered // the first request now holds the only slot
+
+			second := serve()
+			if tt.queueTimeout == 0 {
+				if code := <-second; code != tt.wantSecond {
+					t.Fatalf("second request status = %d, want %d", code, tt.wantSecond)
+				}
+				close(release)
+			} else {
+				select {
+				case code := <-second:
+					t.Fatalf("second request finished with %d while the slot was held", code)
+				case <-time.After(50 * time.Millisecond):
+				}
+				close(release)
+				if code := <-second; code != tt.wantSecond {
+					t.Fatalf("second request status = %d, want %d", code, tt.wantSecond)
+				}
+			}
+
+			if code := <-first; code != http.StatusOK {
+				t.Fatalf("first request status = %d, want %d", code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestHandleForeignInstances(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v2/instances" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, listInstancesResponse{
+			Instances: []vultrInstance{
+				{ID: "inst-1", Label: "paropal-02-17_07-10-00", MainIP: "203.0.113.10", Status: "active"},
+				{ID: "inst-2", Label: "build-runner", MainIP: "203.0.113.20", Status: "active"},
+				{ID: "inst-3", Label: "", Status: "pending"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:          newTestVultrClient(server),
+		logger:         testLogger(),
+		shutdownTokens: []string{"s3cret-token"},
+	}
+	handler := a.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/instances/foreign", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/instances/foreign", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var body struct {
+		Instances []instanceSummary `json:"instances"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	var ids []string
+	for _, inst := range body.Instances {
+		ids = append(ids, inst.ID)
+	}
+	if want := []string{"inst-2", "inst-3"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("foreign instance ids = %v, want %v", ids, want)
+	}
+}
+
+func TestHandleInstanceRawReturnsFullVultrPayload(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-17_07-10-00", Status: "active"}},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-1":
+			_, _ = io.WriteString(w, `{"instance":{"id":"inst-1","label":"paropal-02-17_07-10-00","status":"active","server_status":"ok","region":"icn","vcpu_count":2,"features":["ipv6"]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:          newTestVultrClient(server),
+		logger:         testLogger(),
+		shutdownTokens: []string{"s3cret-token"},
+	}
+	handler := a.routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/instance/raw", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/instance/raw", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var body struct {
+		Instance map[string]any `json:"instance"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Instance["region"] != "icn" || body.Instance["vcpu_count"] != float64(2) || body.Instance["server_status"] != "ok" {
+		t.Fatalf("raw instance = %v, want unmodelled Vultr fields", body.Instance)
+	}
+	if features, _ := body.Instance["features"].([]any); len(features) != 1 {
+		t.Fatalf("raw instance features = %v, want [ipv6]", body.Instance["features"])
+	}
+}
+
+func TestHandleInstancePower(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPath   string
+	}{
+		{name: "start", body: `{"action":"start"}`, wantStatus: http.StatusAccepted, wantPath: "/v2/instances/inst-1/start"},
+		{name: "halt", body: `{"action":"halt"}`, wantStatus: http.StatusAccepted, wantPath: "/v2/instances/inst-1/halt"},
+		{name: "reboot", body: `{"action":"reboot"}`, wantStatus: http.StatusAccepted, wantPath: "/v2/instances/inst-1/reboot"},
+		{name: "unknown action", body: `{"action":"destroy"}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed body", body: `reboot`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu    sync.Mutex
+				posts []string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					writeJSON(w, http.StatusOK, listInstancesResponse{
+						Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-17_07-10-00", Status: "active"}},
+					})
+				case r.Method == http.MethodPost:
+					mu.Lock()
+					posts = append(posts, r.URL.Path)
+					mu.Unlock()
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:          newTestVultrClient(server),
+				logger:         testLogger(),
+				shutdownTokens: []string{"s3cret-token"},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/instance/power", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer s3cret-token")
+			rec := httptest.NewRecorder()
+			a.routes().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body=%s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			var want []string
+			if tt.wantPath != "" {
+				want = []string{tt.wantPath}
+			}
+			if !reflect.DeepEqual(posts, want) {
+				t.Fatalf("upstream POSTs = %v, want %v", posts, want)
+			}
+		})
+	}
+}
+
+func TestHandleInstancePowerRequiresAuth(t *testing.T) {
+	t.Parallel()
+
+	a := &app{logger: testLogger(), shutdownTokens: []string{"s3cret-token"}}
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/instance/power", strings.NewReader(`{"action":"reboot"}`)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandleProvisionRejectsConcurrentRuns(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/v2/instances" {
+			<-release
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-17_07-10-00", Status: "active"}},
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:          newTestVultrClient(server),
+		logger:         testLogger(),
+		cleanupLoc:     time.UTC,
+		labelLoc:       time.UTC,
+		shutdownTokens: []string{"s3cret-token"},
+	}
+	handler := a.routes()
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/provision", nil)
+		req.Header.Set("Authorization", "Bearer s3cret-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := post(); got != http.StatusAccepted {
+		t.Fatalf("first POST status = %d, want %d", got, http.StatusAccepted)
+	}
+	if got := post(); got != http.StatusConflict {
+		t.Fatalf("second POST status = %d, want %d", got, http.StatusConflict)
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !a.runs.drain(ctx) {
+		t.Fatal("manual provision run did not finish")
+	}
+	if record, ok := a.scheduler.lastRun("provision"); !ok || record.Error != "" {
+		t.Fatalf("last provision run = %+v, %v; want a successful run", record, ok)
+	}
+}
+
+func TestInstanceReadyCallback(t *testing.T) {
+	t.Parallel()
+
+	const label = "paropal-02-17_07-10-00"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, listInstancesResponse{
+			Instances: []vultrInstance{{ID: "inst-1", Label: label, Status: "active", MainIP: "203.0.113.7"}},
+		})
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:  newTestVultrClient(server),
+		logger: testLogger(),
+		clk:    &fakeClock{now: time.Date(2026, time.February, 16, 22, 30, 0, 0, time.UTC)},
+	}
+	a.ready.expect("ready-token", label)
+	handler := a.routes()
+
+	report := func(token, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/instance/ready", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := report("wrong-token", `{"ssh_port":443,"user":"linuxuser"}`); got != http.StatusUnauthorized {
+		t.Fatalf("wrong token status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := report("ready-token", `{"ssh_port":0,"user":"linuxuser"}`); got != http.StatusBadRequest {
+		t.Fatalf("missing port status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := report("ready-token", `{"ssh_port":443,"user":"linuxuser","hostname":"paropal"}`); got != http.StatusOK {
+		t.Fatalf("report status = %d, want %d", got, http.StatusOK)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/instance", nil))
+	var body struct {
+		Ready *readyReport `json:"ready"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Ready == nil {
+		t.Fatal("GET /api/instance has no ready report")
+	}
+	if body.Ready.Label != label || body.Ready.SSHPort != 443 || body.Ready.User != "linuxuser" || body.Ready.Hostname != "paropal" {
+		t.Fatalf("ready report = %+v, want port 443 and user linuxuser for %s", body.Ready, label)
+	}
+
+	withCallback, err := renderCloudConfig(provisionPrimaryUser, provisionSSHPort, readyCallback{URL: "https://daemon.example/api/instance/ready", Token: "ready-token"}, "")
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+	for _, want := range []string{"paropal-report-ready.sh", "PAROPAL_READY_URL='https://daemon.example/api/instance/ready'", "PAROPAL_READY_TOKEN='ready-token'"} {
+		if !strings.Contains(withCallback, want) {
+			t.Fatalf("cloud-config with callback is missing %q", want)
+		}
+	}
+	withoutCallback, err := renderCloudConfig(provisionPrimaryUser, provisionSSHPort, readyCallback{}, "")
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+	if strings.Contains(withoutCallback, "/etc/paropal/ready.env") {
+		t.Fatal("cloud-config without callback installs the ready report")
+	}
+}
+
+func TestPrimaryUserAndSSHKeysFromEnv(t *testing.T) {
+	a := &app{vultr: &vultrClient{}, schedule: defaultSchedule}
+	if err := applyEnvOverrides(a); err != nil {
+		t.Fatalf("applyEnvOverrides() error = %v", err)
+	}
+	if got := a.sshUser(); got != provisionPrimaryUser {
+		t.Fatalf("sshUser() = %q, want default %q", got, provisionPrimaryUser)
+	}
+	if got, want := a.provisionSSHKeyIDs(), []string{provisionSSHKeyID}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("provisionSSHKeyIDs() = %q, want default %q", got, want)
+	}
+
+	t.Setenv(primaryUserEnv, "alice")
+	t.Setenv(sshKeyIDsEnv, " key-a ,key-b,, key-c ")
+	a = &app{vultr: &vultrClient{}, schedule: defaultSchedule}
+	if err := applyEnvOverrides(a); err != nil {
+		t.Fatalf("applyEnvOverrides() error = %v", err)
+	}
+	if got := a.sshUser(); got != "alice" {
+		t.Fatalf("sshUser() = %q, want alice", got)
+	}
+	if got, want := a.provisionSSHKeyIDs(), []string{"key-a", "key-b", "key-c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("provisionSSHKeyIDs() = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"Alice", "9lives", "al ice", "alice;reboot", strings.Repeat("a", 33)} {
+		t.Setenv(primaryUserEnv, bad)
+		if err := applyEnvOverrides(&app{vultr: &vultrClient{}, schedule: defaultSchedule}); err == nil {
+			t.Fatalf("applyEnvOverrides() error = nil for %s=%q", primaryUserEnv, bad)
+		}
+	}
+}
+
+func TestRenderCloudConfigWithCustomUser(t *testing.T) {
+	t.Parallel()
+
+	rendered, err := renderCloudConfig("alice", provisionSSHPort, readyCallback{}, "")
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+	for _, want := range []string{
+		`"/usr/local/sbin/paropal-base-init.sh alice 443"`,
+		"ExecStart=/usr/local/sbin/paropal-block-init.sh alice",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("cloud-config is missing %q", want)
+		}
+	}
+	if strings.Contains(rendered, "{{") {
+		t.Fatal("cloud-config has an unrendered template action")
+	}
+}
+
+func TestRenderCloudConfigAppendsExtraFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "etc", "profile.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "etc", "motd"), []byte("welcome: team\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "etc", "profile.d", "team.sh"), []byte("export EDITOR=vim\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := renderCloudConfig(provisionPrimaryUser, provisionSSHPort, readyCallback{}, dir)
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+
+	var doc struct {
+		WriteFiles []struct {
+			Path        string `yaml:"path"`
+			Permissions string `yaml:"permissions"`
+			Encoding    string `yaml:"encoding"`
+			Content     string `yaml:"content"`
+		} `yaml:"write_files"`
+		RunCmd []any `yaml:"runcmd"`
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &doc); err != nil {
+		t.Fatalf("unmarshal cloud-config: %v", err)
+	}
+	if len(doc.RunCmd) == 0 {
+		t.Fatal("cloud-config lost its runcmd section")
+	}
+	want := map[string]struct{ perms, content string }{
+		"/etc/motd":              {"0644", "welcome: team\n"},
+		"/etc/profile.d/team.sh": {"0755", "export EDITOR=vim\n"},
+	}
+	found := 0
+	for _, f := range doc.WriteFiles {
+		w, ok := want[f.Path]
+		if !ok {
+			continue
+		}
+		found++
+		content, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			t.Fatalf("%s content is not base64: %v", f.Path, err)
+		}
+		if f.Encoding != "b64" || f.Permissions != w.perms || string(content) != w.content {
+			t.Fatalf("%s = {encoding %q, permissions %q, content %q}, want {b64, %q, %q}", f.Path, f.Encoding, f.Permissions, content, w.perms, w.content)
+		}
+	}
+	if found != len(want) {
+		t.Fatalf("found %d of %d extra files in write_files:\n%s", found, len(want), rendered)
+	}
+
+	plain, err := renderCloudConfig(provisionPrimaryUser, provisionSSHPort, readyCallback{}, "")
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+	missing, err := renderCloudConfig(provisionPrimaryUser, provisionSSHPort, readyCallback{}, filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v for a missing directory", err)
+	}
+	if missing != plain {
+		t.Fatal("a missing extra files directory changed the cloud-config")
+	}
+}
+
+func TestRenderCloudConfigResetsMarkersPerInstance(t *testing.T) {
+	t.Parallel()
+
+	rendered, err := renderCloudConfig(provisionPrimaryUser, provisionSSHPort, readyCallback{}, "")
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+	var doc struct {
+		BootCmd [][]string `yaml:"bootcmd"`
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &doc); err != nil {
+		t.Fatalf("unmarshal cloud-config: %v", err)
+	}
+
+	// A snapshot boot must run block init and the ready report again.
+	for _, cmd := range doc.BootCmd {
+		if len(cmd) < 3 || cmd[0] != "cloud-init-per" || cmd[1] != "instance" {
+			continue
+		}
+		if slices.Contains(cmd, "/var/lib/paropal/block-init.done") && slices.Contains(cmd, "/var/lib/paropal/ready-report.done") {
+			return
+		}
+	}
+	t.Fatalf("bootcmd does not clear the done markers once per instance: %v", doc.BootCmd)
+}
+
+func TestRenderCloudConfigValidatesYAML(t *testing.T) {
+	t.Parallel()
+
+	rendered, err := renderCloudConfig(provisionPrimaryUser, 2222, readyCallback{URL: "https://daemon.example/api/instance/ready", Token: "ready-token"}, "")
+	if err != nil {
+		t.Fatalf("renderCloudConfig() error = %v", err)
+	}
+	if err := validateCloudConfig(rendered); err != nil {
+		t.Fatalf("validateCloudConfig() error = %v for a good render", err)
+	}
+
+	// A value that ends the write_files block scalar early leaves the rest of
+	// the document misindented.
+	_, err = renderCloudConfig(provisionPrimaryUser, 2222, readyCallback{URL: "https://daemon.example/\nruncmd: [", Token: "ready-token"}, "")
+	if err == nil || !strings.Contains(err.Error(), "not valid YAML") {
+		t.Fatalf("renderCloudConfig() error = %v, want a YAML validation error", err)
+	}
+
+	tests := []struct {
+		name     string
+		rendered string
+		wantErr  string
+	}{
+		{name: "missing header", rendered: "package_update: true\n", wantErr: "#cloud-config"},
+		{name: "header only", rendered: "#cloud-config\n", wantErr: "empty"},
+		{name: "not a mapping", rendered: "#cloud-config\n- packages\n", wantErr: "not valid YAML"},
+		{name: "bad indentation", rendered: "#cloud-config\nwrite_files:\n  - path: /a\n content: x\n", wantErr: "not valid YAML"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCloudConfig(tt.rendered); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateCloudConfig() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleInstanceReportsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		instances []vultrInstance
+		wantLabel string
+		wantDup   any
+	}{
+		{
+			name: "single match omits duplicate count",
+			instances: []vultrInstance{
+				{ID: "inst-1", Label: "paropal-02-17_07-10-00", MainIP: "203.0.113.10", Status: "active"},
+				{ID: "inst-2", Label: "other", MainIP: "203.0.113.20", Status: "active"},
+			},
+			wantLabel: "paropal-02-17_07-10-00",
+			wantDup:   nil,
+		},
+		{
+			name: "two matches report duplicate count",
+			instances: []vultrInstance{
+				{ID: "inst-1", Label: "paropal-02-17_07-10-00", MainIP: "203.0.113.10", Status: "active"},
+				{ID: "inst-2", Label: "paropal-02-18_07-10-00", MainIP: "203.0.113.11", Status: "active"},
+			},
+			wantLabel: "paropal-02-18_07-10-00",
+			wantDup:   float64(2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusOK, listInstancesResponse{Instances: tt.instances})
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:  newTestVultrClient(server),
+				logger: testLogger(),
+			}
+
+			rec := httptest.NewRecorder()
+			a.handleInstance(rec, httptest.NewRequest(http.MethodGet, "/api/instance", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var body map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if body["label"] != tt.wantLabel {
+				t.Fatalf("label = %v, want %v", body["label"], tt.wantLabel)
+			}
+			if got := body["duplicate_count"]; got != tt.wantDup {
+				t.Fatalf("duplicate_count = %v, want %v", got, tt.wantDup)
+			}
+		})
+	}
+}
+
+func TestServeWarmsChargesCacheAfterStartup(t *testing.T) {
+	t.Parallel()
+
+	var instanceLists atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/account":
+			writeJSON(w, http.StatusOK, map[string]any{"account": map[string]any{"pending_charges": 12.5}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			instanceLists.Add(1)
+			writeJSON(w, http.StatusOK, listInstancesResponse{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	a := &app{
+		vultr:          newTestVultrClient(upstream),
+		logger:         testLogger(),
+		stopBackground: stopBackground,
+		cleanupLoc:     time.FixedZone("KST", 9*60*60),
+		labelLoc:       time.UTC,
+		warmupDelay:    10 * time.Millisecond,
+	}
+	a.server = &http.Server{Handler: a.routes()}
+
+	done := make(chan error, 1)
+	go func() { done <- a.serve(context.Background(), backgroundCtx, listener) }()
+
+	// No dashboard request is made; the warm-up alone must fill the cache.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if value, _, ok := a.charges.load(); ok {
+			if value != 12.5 {
+				t.Fatalf("cached charges = %v, want 12.5", value)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("charges cache not populated after startup")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for instanceLists.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("warm-up did not list instances")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("serve() error = %v", err)
+	}
+}
+
+func TestParseListenAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		addr        string
+		wantNetwork string
+		wantAddress string
+		wantErr     bool
+	}{
+		{addr: ":8080", wantNetwork: "tcp", wantAddress: ":8080"},
+		{addr: "127.0.0.1:9000", wantNetwork: "tcp", wantAddress: "127.0.0.1:9000"},
+		{addr: "[::1]:9000", wantNetwork: "tcp", wantAddress: "[::1]:9000"},
+		{addr: "unix:/run/paropal/daemon.sock", wantNetwork: "unix", wantAddress: "/run/paropal/daemon.sock"},
+		{addr: "unix:", wantErr: true},
+		{addr: "8080", wantErr: true},
+		{addr: "/run/paropal/daemon.sock", wantErr: true},
+	}
+	for _, tt := range tests {
+		network, address, err := parseListenAddr(tt.addr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseListenAddr(%q) = %q, %q, want an error", tt.addr, network, address)
+			}
+			continue
+		}
+		if err != nil || network != tt.wantNetwork || address != tt.wantAddress {
+			t.Errorf("parseListenAddr(%q) = %q, %q, %v, want %q, %q", tt.addr, network, address, err, tt.wantNetwork, tt.wantAddress)
+		}
+	}
+}
+
+func TestServeOverUnixSocket(t *testing.T) {
+	// Socket paths are limited to about 100 bytes, which t.TempDir can exceed.
+	dir, err := os.MkdirTemp("", "paropal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "daemon.sock")
+
+	// A socket left by a crashed daemon does not block startup.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listen("unix:" + sock)
+	if err != nil {
+		t.Fatalf("listen() over a stale socket error = %v", err)
+	}
+	if _, err := listen("unix:" + sock); err == nil {
+		t.Fatal("listen() error = nil for a socket in use")
+	}
+
+	a := &app{logger: testLogger()}
+	server := &http.Server{Handler: a.routes()}
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(listener) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://paropal/api/runs")
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/runs over unix socket = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("Serve() error = %v, want %v", err, http.ErrServerClosed)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Fatalf("socket still present after shutdown: %v", err)
+	}
+
+	if err := os.WriteFile(sock, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen("unix:" + sock); err == nil {
+		t.Fatal("listen() error = nil over a regular file")
+	}
+}
+
+func TestServeShutsDownWhenContextEnds(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:               newTestVultrClient(upstream),
+		logger:              logger,
+		stopBackground:      stopBackground,
+		schedule:            defaultSchedule,
+		cleanupLoc:          time.FixedZone("KST", 9*60*60),
+		labelLoc:            time.UTC,
+		cleanupBackoffMin:   time.Second,
+		cleanupBackoffMax:   time.Second,
+		provisionBackoffMin: time.Second,
+		provisionBackoffMax: time.Second,
+	}
+	a.server = &http.Server{Handler: a.routes()}
+
+	signalCtx, sendSignal := context.WithCancel(context.Background())
+	defer sendSignal()
+	done := make(chan error, 1)
+	go func() { done <- a.serve(signalCtx, backgroundCtx, listener) }()
+
+	healthURL := "http://" + listener.Addr().String() + "/healthz"
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get(healthURL)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server not serving: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sendSignal()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("serve() did not return after the context ended")
+	}
+
+	if backgroundCtx.Err() == nil {
+		t.Fatal("background context still live after shutdown")
+	}
+	if _, err := http.Get(healthURL); err == nil {
+		t.Fatal("server still accepting requests after shutdown")
+	}
+	for _, want := range []string{
+		"shutdown signal received",
+		"graceful shutdown complete",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("logs missing %q:\n%s", want, logs.String())
+		}
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for _, want := range []string{
+		"daily instance cleanup scheduler stopped",
+		"daily instance provision scheduler stopped",
+	} {
+		for !strings.Contains(logs.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("background scheduler did not stop; logs missing %q:\n%s", want, logs.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestServeWaitsForShutdownRequestedOverHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:               newTestVultrClient(upstream),
+		logger:              logger,
+		stopBackground:      stopBackground,
+		shutdownTokens:      []string{"s3cret-token"},
+		schedule:            defaultSchedule,
+		cleanupLoc:          time.FixedZone("KST", 9*60*60),
+		labelLoc:            time.UTC,
+		cleanupBackoffMin:   time.Second,
+		cleanupBackoffMax:   time.Second,
+		provisionBackoffMin: time.Second,
+		provisionBackoffMax: time.Second,
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	routes := a.routes()
+	a.server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/slow" {
+			routes.ServeHTTP(w, r)
+			return
+		}
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})}
+
+	done := make(chan error, 1)
+	go func() { done <- a.serve(context.Background(), backgroundCtx, listener) }()
+	base := "http://" + listener.Addr().String()
+
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	<-started
+
+	req, _ := http.NewRequest(http.MethodPost, base+"/api/shutdown", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /api/shutdown: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /api/shutdown status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+
+	// serve must keep waiting while the graceful shutdown waits on the
+	// in-flight request.
+	select {
+	case err := <-done:
+		t.Fatalf("serve() returned %v while a request was still in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("serve() did not return after the shutdown request")
+	}
+	if code := <-slow; code != http.StatusOK {
+		t.Fatalf("in-flight request status = %d, want %d", code, http.StatusOK)
+	}
+	for _, want := range []string{"shutdown requested over HTTP", "graceful shutdown complete"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("logs missing %q:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestServeManagesReadyFile(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	readyFile := filepath.Join(t.TempDir(), "ready")
+	a := &app{
+		vultr:               newTestVultrClient(upstream),
+		logger:              testLogger(),
+		stopBackground:      stopBackground,
+		cleanupLoc:          time.FixedZone("KST", 9*60*60),
+		labelLoc:            time.UTC,
+		cleanupBackoffMin:   time.Second,
+		cleanupBackoffMax:   time.Second,
+		provisionBackoffMin: time.Second,
+		provisionBackoffMax: time.Second,
+		readyFile:           readyFile,
+	}
+	a.server = &http.Server{Handler: a.routes()}
+
+	done := make(chan error, 1)
+	go func() { done <- a.serve(context.Background(), backgroundCtx, listener) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(readyFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ready file %s not written after startup", readyFile)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("serve() did not return after shutdown")
+	}
+
+	if _, err := os.Stat(readyFile); !os.IsNotExist(err) {
+		t.Fatalf("ready file still present after shutdown: %v", err)
+	}
+	if backgroundCtx.Err() == nil {
+		t.Fatalf("background context not cancelled after shutdown")
+	}
+}
+
+func TestIsFailedInstanceStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{status: "suspended", want: true},
+		{status: " Suspended ", want: true},
+		{status: "failed", want: false},
+		{status: "install_error", want: false},
+		{status: "active", want: false},
+		{status: "pending", want: false},
+		{status: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := isFailedInstanceStatus(tt.status); got != tt.want {
+				t.Fatalf("isFailedInstanceStatus(%q) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyInstance(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance *vultrInstance
+		want     instanceState
+	}{
+		{name: "missing", instance: nil, want: instanceAbsent},
+		{name: "pending", instance: &vultrInstance{Status: "pending"}, want: instancePending},
+		{name: "resizing", instance: &vultrInstance{Status: "Resizing"}, want: instancePending},
+		{name: "active", instance: &vultrInstance{Status: "active"}, want: instanceActive},
+		{name: "empty status", instance: &vultrInstance{}, want: instanceActive},
+		{name: "destroying", instance: &vultrInstance{Status: "destroying"}, want: instanceTerminating},
+		{name: "suspended", instance: &vultrInstance{Status: "suspended"}, want: instanceFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyInstance(tt.instance); got != tt.want {
+				t.Fatalf("classifyInstance() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvisionActionFor(t *testing.T) {
+	tests := []struct {
+		state         instanceState
+		replaceFailed bool
+		want          provisionAction
+	}{
+		{state: instanceAbsent, want: provisionCreate},
+		{state: instancePending, want: provisionWait},
+		{state: instanceActive, want: provisionAttach},
+		{state: instanceTerminating, want: provisionCreateReplacement},
+		{state: instanceFailed, replaceFailed: true, want: provisionDeleteAndRecreate},
+		{state: instanceFailed, replaceFailed: false, want: provisionAttach},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state.String()+"/"+strconv.FormatBool(tt.replaceFailed), func(t *testing.T) {
+			if got := provisionActionFor(tt.state, tt.replaceFailed); got != tt.want {
+				t.Fatalf("provisionActionFor(%s, %v) = %s, want %s", tt.state, tt.replaceFailed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockIgnoresPinnedInstance(t *testing.T) {
+	t.Parallel()
+
+	var creates atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+				{ID: "inst-p", Label: "paropal-pinned-build", MainIP: "203.0.113.9", Status: "active"},
+			}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			creates.Add(1)
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-new"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			var req attachBlockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode attach request: %v", err)
+			}
+			if req.InstanceID != "inst-new" {
+				t.Errorf("attach instance_id = %q, want inst-new", req.InstanceID)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-new/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+	client.pinnedMarker = "-pinned-"
+	a := &app{
+		vultr:        client,
+		logger:       testLogger(),
+		pinnedMarker: "-pinned-",
+		labelLoc:     time.UTC,
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), &provisionRunState{}); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+	if got := creates.Load(); got != 1 {
+		t.Fatalf("create calls = %d, want 1; the pinned instance must not count as the daily one", got)
+	}
+}
+
+func TestBlockAttachLiveFromEnvReachesAttachRequest(t *testing.T) {
+	for _, tt := range []struct {
+		env  string
+		want bool
+	}{
+		{env: "", want: false},
+		{env: "off", want: false},
+		{env: "yes", want: true},
+		{env: "true", want: true},
+	} {
+		t.Setenv(blockAttachLiveEnv, tt.env)
+
+		var live []bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+				writeJSON(w, http.StatusOK, listInstancesResponse{})
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+				writeJSON(w, http.StatusCreated, createInstanceResponse{
+					Instance: struct {
+						ID string `json:"id"`
+					}{ID: "inst-new"},
+				})
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+				var req attachBlockRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("decode attach request: %v", err)
+				}
+				live = append(live, req.Live)
+				w.WriteHeader(http.StatusNoContent)
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-new/reinstall":
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		a := &app{vultr: &vultrClient{}, schedule: defaultSchedule}
+		if err := applyEnvOverrides(a); err != nil {
+			t.Fatalf("applyEnvOverrides() with %s=%q error = %v", blockAttachLiveEnv, tt.env, err)
+		}
+		a.vultr = newTestVultrClient(server)
+		a.logger = testLogger()
+		a.labelLoc = time.UTC
+
+		err := a.ensureParopalInstanceAndBlock(context.Background(), &provisionRunState{})
+		server.Close()
+		if err != nil {
+			t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+		}
+		if len(live) != 1 || live[0] != tt.want {
+			t.Fatalf("%s=%q: attach live = %v, want [%v]", blockAttachLiveEnv, tt.env, live, tt.want)
+		}
+	}
+
+	t.Setenv(blockAttachLiveEnv, "sometimes")
+	if err := applyEnvOverrides(&app{vultr: &vultrClient{}, schedule: defaultSchedule}); err == nil {
+		t.Fatalf("applyEnvOverrides() error = nil for %s=sometimes", blockAttachLiveEnv)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockWaitsForPendingInstance(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+		polls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "pending"}},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-1":
+			polls++
+			status := "pending"
+			if polls > 1 {
+				status = "active"
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"instance": vultrInstance{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: status},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                       newTestVultrClient(server),
+		logger:                      testLogger(),
+		labelLoc:                    time.UTC,
+		provisionActiveTimeout:      time.Second,
+		provisionActivePollInterval: time.Millisecond,
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), nil); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	got := append([]string(nil), calls...)
+	mu.Unlock()
+
+	want := []string{
+		"GET /v2/instances",
+		"GET /v2/instances/inst-1",
+		"GET /v2/instances/inst-1",
+		"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected call sequence:\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockDryRunLogsCreateRequest(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		mutating []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			mu.Lock()
+			mutating = append(mutating, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:             newTestVultrClient(server),
+		logger:            logger,
+		labelLoc:          time.UTC,
+		provisionDryRun:   true,
+		provisionScriptID: "script-1",
+		readyCallbackURL:  "https://daemon.example/api/instance/ready",
+	}
+
+	var state provisionRunState
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), &state); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	got := append([]string(nil), mutating...)
+	mu.Unlock()
+	if len(got) != 0 {
+		t.Fatalf("dry run made mutating calls: %v", got)
+	}
+	if state.instanceID != "" {
+		t.Fatalf("state.instanceID = %q, want empty", state.instanceID)
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		"provision dry run; not creating instance",
+		"region=" + provisionRegionID,
+		"plan=" + provisionPlanID,
+		"script_id=script-1",
+		"user_data=\"<redacted ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, base64.StdEncoding.EncodeToString([]byte("#cloud-config"))[:16]) {
+		t.Fatalf("log output leaked user data:\n%s", out)
+	}
+	if state.createToken == "" || !strings.Contains(out, "create_token="+state.createToken) {
+		t.Fatalf("log output missing the create token %q:\n%s", state.createToken, out)
+	}
+	if state.readyToken == "" || state.readyToken == state.createToken || strings.Contains(out, state.readyToken) {
+		t.Fatalf("ready token %q is empty, reuses the create token, or leaked into the log:\n%s", state.readyToken, out)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockTagsDaemonID(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		tags []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			var req createInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			mu.Lock()
+			tags = req.Tags
+			mu.Unlock()
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-1/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:    newTestVultrClient(server),
+		logger:   testLogger(),
+		labelLoc: time.UTC,
+		daemonID: "seoul",
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), nil); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Contains(tags, "paropal-daemon-seoul") {
+		t.Fatalf("create tags = %v, want paropal-daemon-seoul", tags)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockKeepsReadyTokenOutOfTags(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		created createInstanceRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			mu.Lock()
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			mu.Unlock()
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-1/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:            newTestVultrClient(server),
+		logger:           testLogger(),
+		labelLoc:         time.UTC,
+		readyCallbackURL: "https://daemon.example/api/instance/ready",
+	}
+
+	var state provisionRunState
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), &state); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if state.readyToken == "" || state.readyToken == state.createToken {
+		t.Fatalf("ready token %q must be set and differ from the create token %q", state.readyToken, state.createToken)
+	}
+	for _, tag := range created.Tags {
+		if strings.Contains(tag, state.readyToken) {
+			t.Fatalf("create tags %v carry the ready token", created.Tags)
+		}
+	}
+	userData, err := base64.StdEncoding.DecodeString(created.UserData)
+	if err != nil {
+		t.Fatalf("decode user_data: %v", err)
+	}
+	if !strings.Contains(string(userData), "PAROPAL_READY_TOKEN='"+state.readyToken+"'") {
+		t.Fatalf("cloud-config does not carry the ready token:\n%s", userData)
+	}
+
+	report := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/instance/ready", strings.NewReader(`{"ssh_port":443,"user":"linuxuser"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		a.handleInstanceReady(rec, req)
+		return rec.Code
+	}
+	if got := report(state.createToken); got != http.StatusUnauthorized {
+		t.Fatalf("ready report with the create tag token = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := report(state.readyToken); got != http.StatusOK {
+		t.Fatalf("ready report with the ready token = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockUsesProvisionConfig(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		got createInstanceRequest
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			mu.Lock()
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			mu.Unlock()
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-1/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:     newTestVultrClient(server),
+		logger:    testLogger(),
+		labelLoc:  time.UTC,
+		provision: provisionConfig{Region: "icn", Plan: "vc2-4c-8gb", OSID: 2136},
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), nil); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got.Region != "icn" || got.Plan != "vc2-4c-8gb" || got.OSID != 2136 {
+		t.Fatalf("create request region/plan/os = %s/%s/%d, want icn/vc2-4c-8gb/2136", got.Region, got.Plan, got.OSID)
+	}
+}
+
+func TestSnapshotCarryOverGivesUpOnPendingSnapshotAndStillDeletes(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		instances = []vultrInstance{{ID: "inst-old", Label: "paropal-02-16_07-10-00", Status: "active"}}
+		deleted   []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: instances})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/snapshots":
+			writeJSON(w, http.StatusCreated, snapshotResponse{Snapshot: vultrSnapshot{ID: "snap-1", Status: "pending"}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/snapshots/snap-1":
+			writeJSON(w, http.StatusOK, snapshotResponse{Snapshot: vultrSnapshot{ID: "snap-1", Status: "pending"}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/"))
+			if r.URL.Path == "/v2/instances/inst-old" {
+				instances = nil
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    logger,
+		cleanupLoc:                time.UTC,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+		snapshotCarryOver:         true,
+		snapshotPollInterval:      time.Millisecond,
+		snapshotTimeout:           20 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"snapshots/snap-1", "instances/inst-old"}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted = %v, want %v", deleted, want)
+	}
+	if got := a.snapshots.get(); got.ID != "" {
+		t.Fatalf("carried snapshot = %+v, want none after the snapshot timed out", got)
+	}
+	if !strings.Contains(logs.String(), "not complete within") {
+		t.Fatalf("logs missing snapshot timeout:\n%s", logs.String())
+	}
+}
+
+func TestSnapshotBeforeCleanupWithoutInstanceIsNotAnError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{vultr: newTestVultrClient(server), logger: logger}
+
+	if err := a.snapshotBeforeCleanup(context.Background(), a.vultr, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("snapshotBeforeCleanup() error = %v, want nil with no instance", err)
+	}
+	if out := logs.String(); !strings.Contains(out, "no paropal instance to snapshot before cleanup") {
+		t.Fatalf("logs = %q, want the no-instance line", out)
+	}
+}
+
+func TestSnapshotCarryOverFromCleanupToProvision(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		instances = []vultrInstance{{ID: "inst-old", Label: "paropal-02-16_07-10-00", Status: "active", MainIP: "203.0.113.7"}}
+		polls     int
+		created   createInstanceRequest
+		reinstall bool
+		deleted   []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: instances})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/snapshots":
+			var req createSnapshotRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.InstanceID != "inst-old" {
+				t.Errorf("snapshot request = %+v, %v; want instance inst-old", req, err)
+			}
+			writeJSON(w, http.StatusCreated, snapshotResponse{Snapshot: vultrSnapshot{ID: "snap-1", Status: "pending"}})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/snapshots/snap-1":
+			polls++
+			writeJSON(w, http.StatusOK, snapshotResponse{Snapshot: vultrSnapshot{ID: "snap-1", Status: "complete"}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/"))
+			if r.URL.Path == "/v2/instances/inst-old" {
+				instances = nil
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-new"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-new/reinstall":
+			reinstall = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "snapshot.json")
+	newApp := func() *app {
+		a := &app{
+			vultr:                     newTestVultrClient(server),
+			logger:                    testLogger(),
+			cleanupLoc:                time.UTC,
+			labelLoc:                  time.UTC,
+			cleanupSettleDelay:        time.Millisecond,
+			cleanupBackoffMin:         time.Millisecond,
+			cleanupBackoffMax:         5 * time.Millisecond,
+			cleanupPassDeleteInterval: time.Millisecond,
+			snapshotCarryOver:         true,
+			snapshotPollInterval:      time.Millisecond,
+		}
+		if err := a.snapshots.load(stateFile); err != nil {
+			t.Fatalf("load snapshot state: %v", err)
+		}
+		return a
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := newApp().reconcileDestroyAllInstances(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	// A restart between the runs must not lose the snapshot.
+	var state provisionRunState
+	if err := newApp().ensureParopalInstanceAndBlock(ctx, &state); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if polls == 0 {
+		t.Fatal("cleanup did not wait for the snapshot to complete")
+	}
+	if !reflect.DeepEqual(deleted, []string{"instances/inst-old"}) {
+		t.Fatalf("deleted = %v, want only the old instance", deleted)
+	}
+	if created.SnapshotID != "snap-1" || created.OSID != 0 {
+		t.Fatalf("create request snapshot/os = %q/%d, want snap-1 and no os", created.SnapshotID, created.OSID)
+	}
+	if reinstall {
+		t.Fatal("instance booted from snapshot was reinstalled")
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockReissuesAttachThatDidNotStick(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		attachCalls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			// The first attach is accepted but silently never takes effect.
+			attachCalls++
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			block := vultrBlock{ID: provisionBlockStorageID}
+			if attachCalls >= 2 {
+				block.AttachedToInstance = "inst-1"
+			}
+			writeJSON(w, http.StatusOK, getBlockResponse{Block: block})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                newTestVultrClient(server),
+		logger:               testLogger(),
+		labelLoc:             time.UTC,
+		attachVerifyTimeout:  20 * time.Millisecond,
+		attachVerifyInterval: 5 * time.Millisecond,
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), nil); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attachCalls != 2 {
+		t.Fatalf("attach calls = %d, want 2", attachCalls)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockWaitsForSlowAttach(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		attachCalls int
+		blockPolls  int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			attachCalls++
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			// Vultr attaches asynchronously: the block reports unattached
+			// for a couple of polls before the instance shows up.
+			blockPolls++
+			block := vultrBlock{ID: provisionBlockStorageID}
+			if blockPolls > 2 {
+				block.AttachedToInstance = "inst-1"
+			}
+			writeJSON(w, http.StatusOK, getBlockResponse{Block: block})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                newTestVultrClient(server),
+		logger:               testLogger(),
+		labelLoc:             time.UTC,
+		attachVerifyTimeout:  time.Second,
+		attachVerifyInterval: time.Millisecond,
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), nil); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attachCalls != 1 {
+		t.Fatalf("attach calls = %d, want 1; a slow attach must not be re-issued", attachCalls)
+	}
+	if blockPolls != 3 {
+		t.Fatalf("block polls = %d, want 3", blockPolls)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockVerifiesAttachByDefault(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		attachedFrom int // block poll from which Vultr reports the attach; 0 never
+		wantErr      bool
+	}{
+		{name: "attach converges", attachedFrom: 3},
+		{name: "attach never converges", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu    sync.Mutex
+				polls int
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					writeJSON(w, http.StatusOK, listInstancesResponse{
+						Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"}},
+					})
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+					w.WriteHeader(http.StatusNoContent)
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+					polls++
+					block := vultrBlock{ID: provisionBlockStorageID}
+					if tt.attachedFrom > 0 && polls >= tt.attachedFrom {
+						block.AttachedToInstance = "inst-1"
+					}
+					writeJSON(w, http.StatusOK, getBlockResponse{Block: block})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			// The production defaults, with a fake clock that fires every
+			// poll timer at once.
+			clk := &fakeClock{now: time.Date(2026, time.February, 16, 7, 10, 0, 0, time.UTC), timers: make(chan *fakeTimer)}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			go func() {
+				for {
+					select {
+					case timer := <-clk.timers:
+						clk.set(clk.Now().Add(timer.d))
+						timer.c <- clk.Now()
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			a := &app{
+				vultr:                newTestVultrClient(server),
+				logger:               testLogger(),
+				labelLoc:             time.UTC,
+				clk:                  clk,
+				attachVerifyTimeout:  defaultAttachVerifyTimeout,
+				attachVerifyInterval: defaultAttachVerifyInterval,
+			}
+
+			err := a.ensureParopalInstanceAndBlock(ctx, nil)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "not attached to inst-1") {
+					t.Fatalf("ensureParopalInstanceAndBlock() error = %v, want attach verification failure", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if polls != tt.attachedFrom {
+				t.Fatalf("block polls = %d, want %d", polls, tt.attachedFrom)
+			}
+		})
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockFailsWhenReattachDoesNotStick(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			writeJSON(w, http.StatusOK, getBlockResponse{Block: vultrBlock{ID: provisionBlockStorageID}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                newTestVultrClient(server),
+		logger:               testLogger(),
+		labelLoc:             time.UTC,
+		attachVerifyTimeout:  10 * time.Millisecond,
+		attachVerifyInterval: 5 * time.Millisecond,
+	}
+
+	err := a.ensureParopalInstanceAndBlock(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "after re-issuing attach") {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v, want re-attach failure", err)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockReplacesFailedInstance(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-old", Label: "paropal-02-16_07-10-00", Status: "suspended"}},
+			})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-old":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-new"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-new/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                  newTestVultrClient(server),
+		logger:                 testLogger(),
+		labelLoc:               time.UTC,
+		provisionReplaceFailed: true,
+	}
+
+	var state provisionRunState
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), &state); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+	if state.instanceID != "inst-new" {
+		t.Fatalf("state.instanceID=%q, want %q", state.instanceID, "inst-new")
+	}
+
+	mu.Lock()
+	got := append([]string(nil), calls...)
+	mu.Unlock()
+
+	want := []string{
+		"GET /v2/instances",
+		"DELETE /v2/instances/inst-old",
+		"POST /v2/instances",
+		"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
+		"POST /v2/instances/inst-new/reinstall",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected call sequence:\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockWaitsForActiveBeforeAttach(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		statusCalls int
+		calls       []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-123"},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-123":
+			statusCalls++
+			status := "pending"
+			if statusCalls > 2 {
+				status = "active"
+			}
+			writeJSON(w, http.StatusOK, getInstanceResponse{
+				Instance: vultrInstance{ID: "inst-123", Status: status},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			if statusCalls < 3 {
+				t.Errorf("attach requested after %d status checks, want it only once the instance is active", statusCalls)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-123/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                       newTestVultrClient(server),
+		logger:                      testLogger(),
+		labelLoc:                    time.UTC,
+		provisionActiveTimeout:      time.Second,
+		provisionActivePollInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.ensureParopalInstanceAndBlock(ctx, &provisionRunState{}); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"GET /v2/instances",
+		"POST /v2/instances",
+		"GET /v2/instances/inst-123",
+		"GET /v2/instances/inst-123",
+		"GET /v2/instances/inst-123",
+		"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
+		"POST /v2/instances/inst-123/reinstall",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("unexpected call sequence:\n got: %#v\nwant: %#v", calls, want)
+	}
+}
+
+func TestEnsureReinstallsExistingInstanceInReinstallMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{
+			mode: provisionModeCreate,
+			want: []string{
+				"GET /v2/instances",
+				"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
+			},
+		},
+		{
+			mode: provisionModeReinstall,
+			want: []string{
+				"GET /v2/instances",
+				"POST /v2/instances/inst-1/reinstall",
+				"GET /v2/instances/inst-1",
+				"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var calls []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				mu.Unlock()
+
+				existing := vultrInstance{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active", PowerStatus: "running", ServerStatus: "ok"}
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{existing}})
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-1":
+					writeJSON(w, http.StatusOK, getInstanceResponse{Instance: existing})
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-1/reinstall":
+					w.WriteHeader(http.StatusAccepted)
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Block storage volume is already attached to this server"})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:                       newTestVultrClient(server),
+				logger:                      testLogger(),
+				labelLoc:                    time.UTC,
+				provisionMode:               tt.mode,
+				provisionActiveTimeout:      time.Second,
+				provisionActivePollInterval: time.Millisecond,
+			}
+			var state provisionRunState
+			if err := a.ensureParopalInstanceAndBlock(context.Background(), &state); err != nil {
+				t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+			}
+
+			mu.Lock()
+			got := append([]string(nil), calls...)
+			mu.Unlock()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("unexpected call sequence:\n got: %#v\nwant: %#v", got, tt.want)
+			}
+			if reinstalled := state.instanceID == "inst-1" && state.reinstall; reinstalled != (tt.mode == provisionModeReinstall) {
+				t.Fatalf("run state = %+v after %s mode", state, tt.mode)
+			}
+		})
+	}
+}
+
+func TestWaitForInstanceActiveFailsOnTerminatingStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, getInstanceResponse{
+			Instance: vultrInstance{ID: "inst-123", Status: "destroying"},
+		})
+	}))
+	defer server.Close()
+
+	a := &app{logger: testLogger(), provisionActivePollInterval: time.Millisecond}
+	err := a.waitForInstanceActive(context.Background(), newTestVultrClient(server), "inst-123", time.Second)
+	if err == nil || !strings.Contains(err.Error(), `entered status "destroying"`) {
+		t.Fatalf("waitForInstanceActive() error = %v, want terminating status error", err)
+	}
+}
+
+func TestWaitForInstanceActiveZeroTimeoutWaitsForContext(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := "pending"
+		if polls.Add(1) >= 3 {
+			status = "active"
+		}
+		writeJSON(w, http.StatusOK, getInstanceResponse{
+			Instance: vultrInstance{ID: "inst-123", Status: status, ServerStatus: "ok"},
+		})
+	}))
+	defer server.Close()
+
+	a := &app{logger: testLogger(), provisionActivePollInterval: time.Millisecond, provisionRequireServerOK: true}
+	if err := a.waitForInstanceActive(context.Background(), newTestVultrClient(server), "inst-123", 0); err != nil {
+		t.Fatalf("waitForInstanceActive() error = %v, want nil once the instance turns active", err)
+	}
+	if got := polls.Load(); got != 3 {
+		t.Fatalf("polls = %d, want 3", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	polls.Store(-1000)
+	if err := a.waitForInstanceActive(ctx, newTestVultrClient(server), "inst-123", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitForInstanceActive() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReconcileEnsureRetriesWhenInstanceNeverActive(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		createCalls int
+		statusCalls int
+		attachCalls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			createCalls++
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-123"},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-123":
+			statusCalls++
+			writeJSON(w, http.StatusOK, getInstanceResponse{
+				Instance: vultrInstance{ID: "inst-123", Status: "pending"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			attachCalls++
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-123/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                       newTestVultrClient(server),
+		logger:                      testLogger(),
+		labelLoc:                    time.UTC,
+		provisionBackoffMin:         time.Millisecond,
+		provisionBackoffMax:         5 * time.Millisecond,
+		provisionRequireActive:      true,
+		provisionActiveTimeout:      20 * time.Millisecond,
+		provisionActivePollInterval: 5 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	a.reconcileEnsureParopalInstance(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if createCalls != 1 {
+		t.Fatalf("expected exactly 1 create call, got %d", createCalls)
+	}
+	if attachCalls != 0 {
+		t.Fatalf("attach calls = %d, want none while the instance stays pending", attachCalls)
+	}
+	// Each attempt polls a few times within its 20ms active timeout, so more
+	// than that means provision was retried.
+	if statusCalls < 6 {
+		t.Fatalf("expected provision to be retried while instance stays pending; status calls = %d", statusCalls)
+	}
+}
+
+func TestReconcileEnsureFailsFastWhenBlockStorageIsMissing(t *testing.T) {
+	t.Parallel()
+
+	var creates, attaches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			creates.Add(1)
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			attaches.Add(1)
+			http.Error(w, `{"error":"Invalid block storage ID"}`, http.StatusNotFound)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+			http.Error(w, `{"error":"Block storage not found"}`, http.StatusNotFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		labelLoc:                  time.UTC,
+		provisionBackoffMin:       time.Minute,
+		provisionBackoffMax:       time.Minute,
+		provisionAttachBackoffMin: time.Minute,
+		provisionAttachBackoffMax: time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := a.reconcileEnsureParopalInstance(ctx)
+	if !errors.Is(err, errBlockStorageMissing) {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v, want %v", err, errBlockStorageMissing)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("reconcile took %s; a missing block should fail the run without retrying", elapsed)
+	}
+	if got := creates.Load(); got != 1 {
+		t.Fatalf("create calls = %d, want 1", got)
+	}
+	if got := attaches.Load(); got != 1 {
+		t.Fatalf("attach calls = %d, want 1", got)
+	}
+}
+
+func TestReconcileEnsureRefusesCreateAtInstanceCeiling(t *testing.T) {
+	t.Parallel()
+
+	var creates atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			// Both are on their way out, so provisioning would otherwise
+			// create a replacement.
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: []vultrInstance{
+				{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "destroying"},
+				{ID: "inst-2", Label: "paropal-02-16_07-11-00", Status: "destroying"},
+			}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			creates.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                 newTestVultrClient(server),
+		logger:                logger,
+		labelLoc:              time.UTC,
+		provisionBackoffMin:   time.Minute,
+		provisionBackoffMax:   time.Minute,
+		provisionMaxInstances: 2,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := a.reconcileEnsureParopalInstance(ctx)
+	if !errors.Is(err, errInstanceCeilingReached) {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v, want %v", err, errInstanceCeilingReached)
+	}
+	if got := creates.Load(); got != 0 {
+		t.Fatalf("create calls = %d, want 0 at the ceiling", got)
+	}
+	if out := logs.String(); !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "safety ceiling") || !strings.Contains(out, "count=2") {
+		t.Fatalf("log does not report the ceiling at error level:\n%s", out)
+	}
+}
+
+func TestEnsureRefusesCreateAtAccountInstanceCap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		instances    []vultrInstance
+		provisionMax int
+		wantCeiling  bool
+	}{
+		{
+			name:        "relabelled instance",
+			instances:   []vultrInstance{{ID: "inst-1", Label: "my-dev-box", Status: "active"}},
+			wantCeiling: true,
+		},
+		{
+			name:      "failed instance being replaced",
+			instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "suspended"}},
+		},
+		{
+			name:      "terminating instance",
+			instances: []vultrInstance{{ID: "inst-1", Label: "old-box", Status: "destroying"}},
+		},
+		{
+			name:         "pinned instance",
+			instances:    []vultrInstance{{ID: "inst-p", Label: "paropal-pinned-build", Status: "active"}},
+			provisionMax: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var creates atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: tt.instances})
+				case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-1":
+					w.WriteHeader(http.StatusNoContent)
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+					creates.Add(1)
+					writeJSON(w, http.StatusCreated, createInstanceResponse{
+						Instance: struct {
+							ID string `json:"id"`
+						}{ID: "inst-new"},
+					})
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-new":
+					writeJSON(w, http.StatusOK, getInstanceResponse{Instance: vultrInstance{ID: "inst-new", Status: "active"}})
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+					w.WriteHeader(http.StatusNoContent)
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-new/reinstall":
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			client := newTestVultrClient(server)
+			client.pinnedMarker = "-pinned-"
+			logger, logs := capturingLogger()
+			a := &app{
+				vultr:                       client,
+				logger:                      logger,
+				labelLoc:                    time.UTC,
+				pinnedMarker:                "-pinned-",
+				provisionReplaceFailed:      true,
+				provisionMaxInstances:       tt.provisionMax,
+				accountMaxInstances:         1,
+				provisionActiveTimeout:      time.Second,
+				provisionActivePollInterval: time.Millisecond,
+			}
+
+			err := a.ensureParopalInstanceAndBlock(context.Background(), &provisionRunState{})
+			if tt.wantCeiling {
+				if !errors.Is(err, errInstanceCeilingReached) {
+					t.Fatalf("ensureParopalInstanceAndBlock() error = %v, want %v", err, errInstanceCeilingReached)
+				}
+				if got := creates.Load(); got != 0 {
+					t.Fatalf("create calls = %d, want 0 at the account cap", got)
+				}
+				if out := logs.String(); !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "relabelled") || !strings.Contains(out, "my-dev-box") {
+					t.Fatalf("log does not report the account cap at error level:\n%s", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+			}
+			if got := creates.Load(); got != 1 {
+				t.Fatalf("create calls = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestReconcileEnsureSendsSameCreateTokenOnRetry(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		tokens [][]string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			var req createInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			mu.Lock()
+			tokens = append(tokens, req.Tags)
+			attempt := len(tokens)
+			mu.Unlock()
+
+			if attempt == 1 {
+				http.Error(w, `{"error":"temporary failure"}`, http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-1":
+			writeJSON(w, http.StatusOK, getInstanceResponse{Instance: vultrInstance{ID: "inst-1", Status: "active"}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-1/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:               newTestVultrClient(server),
+		logger:              testLogger(),
+		labelLoc:            time.UTC,
+		provisionBackoffMin: time.Millisecond,
+		provisionBackoffMax: 5 * time.Millisecond,
+	}
+
+	if err := a.reconcileEnsureParopalInstance(context.Background()); err != nil {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(tokens) != 2 {
+		t.Fatalf("create calls = %d, want 2", len(tokens))
+	}
+	if len(tokens[0]) != 1 || !strings.HasPrefix(tokens[0][0], createTokenTagPrefix) {
+		t.Fatalf("first create tags = %v, want one %s tag", tokens[0], createTokenTagPrefix)
+	}
+	if !reflect.DeepEqual(tokens[0], tokens[1]) {
+		t.Fatalf("retried create tags = %v, want %v", tokens[1], tokens[0])
+	}
+}
+
+func TestSSHPortFlowsIntoCloudConfigFirewallAndDashboard(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		created   *createInstanceRequest
+		ruleAdds  []vultrFirewallRule
+		ruleLists int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			var instances []vultrInstance
+			if created != nil {
+				instances = append(instances, vultrInstance{ID: "inst-1", Label: created.Label, MainIP: "203.0.113.10", Status: "active"})
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: instances})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/firewalls/fw-1/rules":
+			ruleLists++
+			writeJSON(w, http.StatusOK, listFirewallRulesResponse{
+				FirewallRules: []vultrFirewallRule{{ID: 1, IPType: "v4", Protocol: "tcp", Subnet: "0.0.0.0", Port: "22"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/firewalls/fw-1/rules":
+			var rule vultrFirewallRule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				t.Errorf("decode firewall rule: %v", err)
+			}
+			ruleAdds = append(ruleAdds, rule)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			var req createInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			created = &req
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-1"},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-1":
+			writeJSON(w, http.StatusOK, getInstanceResponse{Instance: vultrInstance{ID: "inst-1", Status: "active"}})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-1/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:               newTestVultrClient(server),
+		logger:              testLogger(),
+		labelLoc:            time.UTC,
+		provisionBackoffMin: time.Millisecond,
+		provisionBackoffMax: 5 * time.Millisecond,
+		sshPort:             2222,
+		firewallGroupID:     "fw-1",
+	}
+
+	if err := a.reconcileEnsureParopalInstance(context.Background()); err != nil {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v", err)
+	}
+
+	mu.Lock()
+	if created == nil {
+		mu.Unlock()
+		t.Fatal("no instance was created")
+	}
+	if created.FirewallGroupID != "fw-1" {
+		t.Errorf("firewall_group_id = %q, want fw-1", created.FirewallGroupID)
+	}
+	userData, err := base64.StdEncoding.DecodeString(created.UserData)
+	if err != nil {
+		t.Fatalf("decode user_data: %v", err)
+	}
+	if !strings.Contains(string(userData), "/usr/local/sbin/paropal-base-init.sh linuxuser 2222") {
+		t.Errorf("cloud-config does not pass port 2222 to base init:\n%s", userData)
+	}
+	if ruleLists != 1 || len(ruleAdds) != 1 {
+		t.Fatalf("firewall rule lists = %d, adds = %d, want 1 and 1", ruleLists, len(ruleAdds))
+	}
+	if got := ruleAdds[0]; got.IPType != "v4" || got.Protocol != "tcp" || got.Port != "2222" || got.Subnet != "0.0.0.0" || got.SubnetSize != 0 {
+		t.Errorf("created firewall rule = %+v, want tcp 2222 from 0.0.0.0/0", got)
+	}
+	mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	a.handleInstance(rec, httptest.NewRequest(http.MethodGet, "/api/instance", nil))
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body["ssh_port"] != float64(2222) {
+		t.Fatalf("ssh_port = %v, want 2222", body["ssh_port"])
+	}
+	if !strings.Contains(rootHTML, "data.ssh_port") {
+		t.Fatal("dashboard does not build the ssh hint from ssh_port")
+	}
+}
+
+func TestEnsureSSHFirewallRuleSkipsExistingRule(t *testing.T) {
+	t.Parallel()
+
+	var posts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/firewalls/fw-1/rules":
+			writeJSON(w, http.StatusOK, listFirewallRulesResponse{
+				FirewallRules: []vultrFirewallRule{{ID: 1, IPType: "v4", Protocol: "tcp", Subnet: "0.0.0.0", Port: "443"}},
+			})
+		case r.Method == http.MethodPost:
+			posts.Add(1)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{vultr: newTestVultrClient(server), logger: testLogger()}
+	if err := a.ensureSSHFirewallRule(context.Background(), a.vultr, "fw-1"); err != nil {
+		t.Fatalf("ensureSSHFirewallRule() error = %v", err)
+	}
+	if n := posts.Load(); n != 0 {
+		t.Fatalf("firewall rule creates = %d, want 0", n)
+	}
+}
+
+func TestHandleReconcileStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		attachedTo string
+		wantInSync bool
+		wantDrift  int
+	}{
+		{name: "in sync", attachedTo: "inst-1", wantInSync: true, wantDrift: 0},
+		{name: "block detached", attachedTo: "", wantInSync: false, wantDrift: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v2/instances":
+					writeJSON(w, http.StatusOK, listInstancesResponse{
+						Instances: []vultrInstance{
+							{ID: "inst-1", Label: "paropal-02-17_07-10-00", MainIP: "203.0.113.10", Status: "active"},
+							{ID: "inst-2", Label: "unrelated", MainIP: "203.0.113.20", Status: "active"},
+						},
+					})
+				case r.URL.Path == "/v2/blocks/"+provisionBlockStorageID:
+					writeJSON(w, http.StatusOK, getBlockResponse{
+						Block: vultrBlock{ID: provisionBlockStorageID, AttachedToInstance: tt.attachedTo},
+					})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:  newTestVultrClient(server),
+				logger: testLogger(),
+			}
+
+			rec := httptest.NewRecorder()
+			a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reconcile/status", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d; body=%s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			var got reconcileStatus
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.InSync != tt.wantInSync {
+				t.Fatalf("in_sync = %v, want %v (drift=%v)", got.InSync, tt.wantInSync, got.Drift)
+			}
+			if len(got.Drift) != tt.wantDrift {
+				t.Fatalf("drift = %v, want %d entries", got.Drift, tt.wantDrift)
+			}
+			if got.Observed.Instances != 1 || got.Observed.InstanceID != "inst-1" {
+				t.Fatalf("observed = %+v, want one instance inst-1", got.Observed)
+			}
+		})
+	}
+}
+
+func TestHandleSjbTarContentLength(t *testing.T) {
+	t.Parallel()
+
+	a := &app{logger: testLogger()}
+	server := httptest.NewServer(a.routes())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/static/sjb.tar.gz")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	header := resp.Header.Get("Content-Length")
+	if header != strconv.Itoa(len(body)) {
+		t.Fatalf("Content-Length = %q, body length = %d", header, len(body))
+	}
+	if len(body) != len(sjbTarGz) {
+		t.Fatalf("body length = %d, want %d", len(body), len(sjbTarGz))
+	}
+}
+
+func TestNewInstanceLabel(t *testing.T) {
+	now := time.Date(2026, time.February, 17, 7, 10, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		layout string
+		want   string
+	}{
+		{name: "default layout", layout: "", want: "paropal-02-17_07-10-05"},
+		{name: "custom layout", layout: "20060102T150405", want: "paropal-20260217T071005"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newInstanceLabel(now, time.UTC, tt.layout); got != tt.want {
+				t.Fatalf("newInstanceLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLabelTimeFormat(t *testing.T) {
+	tests := []struct {
+		layout  string
+		wantErr bool
+	}{
+		{layout: "01-02_15-04-05", wantErr: false},
+		{layout: "2006-01-02", wantErr: false},
+		{layout: "", wantErr: true},
+		{layout: "daily", wantErr: true},
+		{layout: "x9", wantErr: true},
+		{layout: "15h", wantErr: false},
+		{layout: "2006-13-45", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			err := validateLabelTimeFormat(tt.layout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateLabelTimeFormat(%q) error = %v, wantErr %v", tt.layout, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceRequestScriptIDSerialization(t *testing.T) {
+	tests := []struct {
+		name     string
+		scriptID string
+		want     bool
+	}{
+		{name: "omitted when unset", scriptID: "", want: false},
+		{name: "sent when set", scriptID: "script-1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(createInstanceRequest{Label: "paropal-x", ScriptID: tt.scriptID})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+
+			var fields map[string]any
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			got, ok := fields["script_id"]
+			if ok != tt.want {
+				t.Fatalf("script_id present = %v, want %v (json=%s)", ok, tt.want, data)
+			}
+			if ok && got != tt.scriptID {
+				t.Fatalf("script_id = %v, want %q", got, tt.scriptID)
+			}
+		})
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockSendsScriptID(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		scriptID string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			var req createInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			mu.Lock()
+			scriptID = req.ScriptID
+			mu.Unlock()
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-123"},
+			})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:             newTestVultrClient(server),
+		logger:            testLogger(),
+		labelLoc:          time.UTC,
+		provisionScriptID: "startup-script-42",
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), &provisionRunState{}); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if scriptID != "startup-script-42" {
+		t.Fatalf("create request script_id = %q, want %q", scriptID, "startup-script-42")
+	}
+}
+
+func TestProvisionUpgradesPlanAfterUsageOverThreshold(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		usedMB   int64
+		wantPlan string
+	}{
+		{name: "over threshold selects larger plan", usedMB: 3000, wantPlan: "vhp-2c-4gb-amd"},
+		{name: "under threshold keeps base plan", usedMB: 100, wantPlan: provisionPlanID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu       sync.Mutex
+				recorded bool
+				plan     string
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					var list []vultrInstance
+					if !recorded {
+						list = []vultrInstance{{ID: "inst-old", Label: "paropal-old", Status: "active"}}
+					}
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-old/bandwidth":
+					recorded = true
+					half := tt.usedMB << 19
+					_, _ = io.WriteString(w, `{"bandwidth":{"2026-02-25":{"incoming_bytes":`+strconv.FormatInt(half, 10)+`,"outgoing_bytes":`+strconv.FormatInt(half, 10)+`}}}`)
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+					var req createInstanceRequest
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Errorf("decode create request: %v", err)
+					}
+					plan = req.Plan
+					writeJSON(w, http.StatusCreated, createInstanceResponse{
+						Instance: struct {
+							ID string `json:"id"`
+						}{ID: "inst-new"},
+					})
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:                     newTestVultrClient(server),
+				logger:                    testLogger(),
+				labelLoc:                  time.UTC,
+				provisionPlanUpgrades:     []string{"vhp-2c-4gb-amd", "vhp-4c-8gb-amd"},
+				planUpgradeBandwidthBytes: 2000 << 20,
+			}
+
+			a.recordInstanceUsage(context.Background())
+			if err := a.ensureParopalInstanceAndBlock(context.Background(), &provisionRunState{}); err != nil {
+				t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if plan != tt.wantPlan {
+				t.Fatalf("create request plan = %q, want %q", plan, tt.wantPlan)
+			}
+		})
+	}
+}
+
+func TestInstanceReadyRequiresServerOK(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status, serverStatus string
+		requireServerOK      bool
+		want                 bool
+	}{
+		{status: "active", serverStatus: "locked", requireServerOK: false, want: true},
+		{status: "active", serverStatus: "locked", requireServerOK: true, want: false},
+		{status: "active", serverStatus: "installingbooting", requireServerOK: true, want: false},
+		{status: "active", serverStatus: "ok", requireServerOK: true, want: true},
+		{status: "pending", serverStatus: "ok", requireServerOK: true, want: false},
+		{status: "pending", serverStatus: "none", requireServerOK: false, want: false},
+	}
+
+	for _, tt := range tests {
+		instance := &vultrInstance{Status: tt.status, ServerStatus: tt.serverStatus}
+		if got := instanceReady(instance, tt.requireServerOK); got != tt.want {
+			t.Errorf("instanceReady(%q/%q, %v) = %v, want %v", tt.status, tt.serverStatus, tt.requireServerOK, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockWaitsForServerOKBeforeAttach(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu              sync.Mutex
+		polls           int
+		attachedAtPolls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-123"},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances/inst-123":
+			polls++
+			serverStatus := "locked"
+			if polls >= 3 {
+				serverStatus = "ok"
+			}
+			writeJSON(w, http.StatusOK, getInstanceResponse{
+				Instance: vultrInstance{ID: "inst-123", Status: "active", ServerStatus: serverStatus},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			attachedAtPolls = polls
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                       newTestVultrClient(server),
+		logger:                      testLogger(),
+		labelLoc:                    time.UTC,
+		provisionRequireServerOK:    true,
+		provisionActiveTimeout:      time.Second,
+		provisionActivePollInterval: time.Millisecond,
+	}
+
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), &provisionRunState{}); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attachedAtPolls != 3 {
+		t.Fatalf("attach happened after %d status polls, want 3 (once server_status is ok)", attachedAtPolls)
+	}
+}
+
+func TestEnsureParopalInstanceAndBlockFallsBackToNextRegion(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		regions     []string
+		attachCalls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			var req createInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode create request: %v", err)
+			}
+			regions = append(regions, req.Region)
+			if req.Region == provisionRegionID {
+				http.Error(w, `{"error":"Region is currently unavailable","status":400}`, http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-icn"},
+			})
+		case strings.HasSuffix(r.URL.Path, "/attach"):
+			attachCalls++
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                    newTestVultrClient(server),
+		logger:                   testLogger(),
+		labelLoc:                 time.UTC,
+		provisionFallbackRegions: []string{"icn", "sgp"},
+	}
+
+	state := &provisionRunState{}
+	if err := a.ensureParopalInstanceAndBlock(context.Background(), state); err != nil {
+		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{provisionRegionID, "icn"}; !reflect.DeepEqual(regions, want) {
+		t.Fatalf("create regions = %v, want %v", regions, want)
+	}
+	if state.instanceID != "inst-icn" || state.regionIndex != 1 {
+		t.Fatalf("state = %+v, want inst-icn in fallback region 1", state)
+	}
+	if attachCalls != 0 {
+		t.Fatalf("attach calls = %d, want 0 outside the primary region", attachCalls)
+	}
+}
+
+func TestReconcileEnsureBacksOffLongerDuringVultrMaintenance(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		listCalls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		listCalls++
+		mu.Unlock()
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+	client.maintenanceAfter = 2
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                 client,
+		logger:                logger,
+		labelLoc:              time.UTC,
+		provisionBackoffMin:   time.Millisecond,
+		provisionBackoffMax:   5 * time.Millisecond,
+		provisionRunTimeout:   300 * time.Millisecond,
+		maintenanceBackoffMin: 40 * time.Millisecond,
+		maintenanceBackoffMax: 80 * time.Millisecond,
+	}
+
+	err := a.reconcileEnsureParopalInstance(context.Background())
+	if !errors.Is(err, errVultrMaintenance) {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v, want errVultrMaintenance", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 1 ordinary failure, then maintenance waits of 40ms, 80ms, 80ms, ...
+	// rather than ~100 attempts on the 1-5ms regular backoff.
+	if listCalls < 3 || listCalls > 8 {
+		t.Fatalf("list calls = %d, want a handful under maintenance backoff", listCalls)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "under maintenance; backing off") || !strings.Contains(out, "retry_in=40ms") || !strings.Contains(out, "retry_in=80ms") {
+		t.Fatalf("expected growing maintenance backoff logs, got: %s", out)
+	}
+}
+
+func TestVultrClientFlagsSustained503AsMaintenance(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		status = http.StatusServiceUnavailable
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		writeJSON(w, http.StatusOK, accountResponse{})
+	}))
+	defer server.Close()
+
+	client := newTestVultrClient(server)
+	client.maintenanceAfter = 3
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		_, err := client.pendingCharges(ctx)
+		if got, want := errors.Is(err, errVultrMaintenance), i >= 3; got != want {
+			t.Fatalf("503 #%d: errors.Is(err, errVultrMaintenance) = %v, want %v (err=%v)", i, got, want, err)
+		}
+	}
+
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	if _, err := client.pendingCharges(ctx); err != nil {
+		t.Fatalf("pendingCharges() after recovery error = %v", err)
+	}
+
+	mu.Lock()
+	status = http.StatusServiceUnavailable
+	mu.Unlock()
+	if _, err := client.pendingCharges(ctx); errors.Is(err, errVultrMaintenance) {
+		t.Fatalf("first 503 after recovery flagged as maintenance: %v", err)
+	}
+}
+
+func TestReconcileEnsureUsesAttachBackoffAfterCreate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		createCalls int
+		attachCalls int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			createCalls++
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-123"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
+			attachCalls++
+			if attachCalls <= 2 {
+				http.Error(w, "instance not ready", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-123/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    logger,
+		labelLoc:                  time.UTC,
+		provisionBackoffMin:       time.Minute,
+		provisionBackoffMax:       time.Minute,
+		provisionAttachBackoffMin: time.Millisecond,
+		provisionAttachBackoffMax: 5 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	a.reconcileEnsureParopalInstance(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("reconcile took %s; attach retries should not use the create backoff", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if createCalls != 1 {
+		t.Fatalf("expected 1 create call, got %d", createCalls)
+	}
+	if attachCalls != 3 {
+		t.Fatalf("expected 3 attach calls, got %d", attachCalls)
+	}
+	if out := logs.String(); !strings.Contains(out, "instance provision attach failed") || !strings.Contains(out, "retry_in=1ms") {
+		t.Fatalf("expected attach retry log with short backoff, got: %s", out)
+	}
+}
+
+func TestReconcileEnsureFailsOverToSecondaryAccount(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu                   sync.Mutex
+		primaryCreateCalls   int
+		secondaryCreateCalls int
+		secondaryAttachCalls int
+	)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			primaryCreateCalls++
+			http.Error(w, "account is suspended", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
+			secondaryCreateCalls++
+			writeJSON(w, http.StatusCreated, createInstanceResponse{
+				Instance: struct {
+					ID string `json:"id"`
+				}{ID: "inst-secondary"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/block-secondary/attach":
+			secondaryAttachCalls++
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-secondary/reinstall":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer secondary.Close()
+
+	a := &app{
+		vultr:                   newTestVultrClient(primary),
+		secondaryVultr:          newTestVultrClient(secondary),
+		secondaryBlockStorageID: "block-secondary",
+		provisionFailoverAfter:  2,
+		logger:                  testLogger(),
+		labelLoc:                time.UTC,
+		provisionBackoffMin:     time.Millisecond,
+		provisionBackoffMax:     5 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileEnsureParopalInstance(ctx); err != nil {
+		t.Fatalf("reconcileEnsureParopalInstance() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if primaryCreateCalls != 2 {
+		t.Fatalf("primary create calls = %d, want 2", primaryCreateCalls)
+	}
+	if secondaryCreateCalls != 1 {
+		t.Fatalf("secondary create calls = %d, want 1", secondaryCreateCalls)
+	}
+	if secondaryAttachCalls != 1 {
+		t.Fatalf("secondary attach calls = %d, want 1", secondaryAttachCalls)
+	}
+}
+
+func TestHandleStatusAggregatesDashboardData(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		instances []vultrInstance
+		want      string
+	}{
+		{
+			name:      "instance present",
+			instances: []vultrInstance{{ID: "inst-1", Label: "paropal-x", MainIP: "203.0.113.10", Status: "active", PowerStatus: "running"}},
+			want:      `{"pending_charges":3.5,"charges_stale":false,"instance":{"status":"active","power_status":"running","ip":"203.0.113.10","label":"paropal-x","ssh_port":443,"ssh_user":"linuxuser"},"next_cleanup":"2026-02-17T00:10:00+09:00","next_provision":"2026-02-17T07:10:00+09:00"}`,
+		},
+		{
+			name: "instance absent",
+			want: `{"pending_charges":3.5,"charges_stale":false,"instance":null,"next_cleanup":"2026-02-17T00:10:00+09:00","next_provision":"2026-02-17T07:10:00+09:00"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/account":
+					writeJSON(w, http.StatusOK, map[string]any{"account": map[string]any{"pending_charges": 3.5}})
+				case "/v2/instances":
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: tt.instances})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			kst := time.FixedZone("KST", 9*60*60)
+			a := &app{
+				vultr:      newTestVultrClient(server),
+				logger:     testLogger(),
+				cleanupLoc: kst,
+				schedule:   defaultSchedule,
+				clk:        &fakeClock{now: time.Date(2026, time.February, 16, 12, 0, 0, 0, kst)},
+			}
+
+			rec := httptest.NewRecorder()
+			a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Fatalf("body = %s\nwant   %s", got, tt.want)
+			}
+		})
+	}
+
+	if !strings.Contains(rootHTML, "fetch('/api/status')") || strings.Contains(rootHTML, "fetch('/api/instance')") {
+		t.Fatal("dashboard does not load charges and instance from /api/status")
+	}
+}
+
+func TestVultrInstanceDecodesPowerStatus(t *testing.T) {
+	raw := `{"id":"inst-1","status":"active","power_status":"stopped","main_ip":"203.0.113.10","label":"paropal-x"}`
+
+	var instance vultrInstance
+	if err := json.Unmarshal([]byte(raw), &instance); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if instance.PowerStatus != "stopped" {
+		t.Fatalf("PowerStatus = %q, want %q", instance.PowerStatus, "stopped")
+	}
+}
+
+func TestHandleInstanceReportsPowerStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, listInstancesResponse{
+			Instances: []vultrInstance{
+				{ID: "inst-1", Label: "paropal-x", MainIP: "203.0.113.10", Status: "active", PowerStatus: "running"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:  newTestVultrClient(server),
+		logger: testLogger(),
+	}
+
+	rec := httptest.NewRecorder()
+	a.handleInstance(rec, httptest.NewRequest(http.MethodGet, "/api/instance", nil))
+
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body["power_status"] != "running" {
+		t.Fatalf("power_status = %v, want %q", body["power_status"], "running")
+	}
+}
+
+func TestRecordRunOutcomeAlertsAfterConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		events []notification
+	)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notification
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode notification: %v", err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	a := &app{
+		logger:               testLogger(),
+		alertAfterFailedRuns: 3,
+		notifier:             &notifier{url: webhook.URL, httpClient: webhook.Client()},
+	}
+
+	alerts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events)
+	}
+
+	ctx := context.Background()
+	runErr := errors.New("vultr unavailable")
+
+	a.recordRunOutcome(ctx, "cleanup", &a.cleanupFailures, runErr)
+	a.recordRunOutcome(ctx, "cleanup", &a.cleanupFailures, runErr)
+	if got := alerts(); got != 0 {
+		t.Fatalf("alerts after 2 failures = %d, want 0", got)
+	}
+
+	a.recordRunOutcome(ctx, "cleanup", &a.cleanupFailures, runErr)
+	if got := alerts(); got != 1 {
+		t.Fatalf("alerts after 3 failures = %d, want 1", got)
+	}
+
+	mu.Lock()
+	event := events[0]
+	mu.Unlock()
+	if event.Event != "scheduled_run_failures" || event.Fields["run"] != "cleanup" || event.Fields["consecutive_failures"] != float64(3) {
+		t.Fatalf("unexpected alert payload: %+v", event)
+	}
+
+	// A success resets the streak, so two more failures stay below the threshold.
+	a.recordRunOutcome(ctx, "cleanup", &a.cleanupFailures, nil)
+	a.recordRunOutcome(ctx, "cleanup", &a.cleanupFailures, runErr)
+	a.recordRunOutcome(ctx, "cleanup", &a.cleanupFailures, runErr)
+	if got := alerts(); got != 1 {
+		t.Fatalf("alerts after reset and 2 failures = %d, want 1", got)
+	}
+
+	// Streaks are tracked per scheduler.
+	a.recordRunOutcome(ctx, "provision", &a.provisionFailures, runErr)
+	if got := alerts(); got != 1 {
+		t.Fatalf("provision failure triggered cleanup streak alert; alerts = %d", got)
+	}
+}
+
+func TestReconcileSettleDelayGrowsWhileCountIsStable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		cDeleted bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			// inst-a and inst-b accept deletes but never go away.
+			list := []vultrInstance{{ID: "inst-a"}, {ID: "inst-b"}}
+			if !cDeleted {
+				list = append(list, vultrInstance{ID: "inst-c"})
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			if r.URL.Path == "/v2/instances/inst-c" {
+				cDeleted = true
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	logger, logs := capturingLogger()
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    logger,
+		cleanupLoc:                time.UTC,
+		cleanupAllInstances:       true,
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupSettleDelayMax:     4 * time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	a.reconcileDestroyAllInstances(ctx, time.Now().Add(150*time.Millisecond))
+
+	var delays []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if !strings.Contains(line, "waiting for deletes to settle") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if value, ok := strings.CutPrefix(field, "settle_delay="); ok {
+				delays = append(delays, value)
+			}
+		}
+	}
+
+	want := []string{"1ms", "1ms", "2ms", "4ms", "4ms"}
+	if len(delays) < len(want) || !reflect.DeepEqual(delays[:len(want)], want) {
+		t.Fatalf("settle delays = %v, want prefix %v", delays, want)
+	}
+}
+
+func TestReconcileDestroyAllRequiresAcknowledgment(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		requireAck   bool
+		allInstances bool
+		wantErr      error
+		wantDeleted  []string
+	}{
+		{name: "unacknowledged destroy-all aborts", requireAck: true, allInstances: true, wantErr: errDestroyAllNotAcknowledged},
+		{name: "acknowledged destroy-all proceeds", requireAck: false, allInstances: true, wantDeleted: []string{"inst-other", "inst-paropal"}},
+		{name: "prefix scope needs no acknowledgment", requireAck: true, wantDeleted: []string{"inst-paropal"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu      sync.Mutex
+				deleted []string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					var list []vultrInstance
+					for _, inst := range []vultrInstance{{ID: "inst-other", Label: "build-runner"}, {ID: "inst-paropal", Label: "paropal-a"}} {
+						if !slices.Contains(deleted, inst.ID) {
+							list = append(list, inst)
+						}
+					}
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+				case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+					deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/instances/"))
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			a := &app{
+				vultr:                       newTestVultrClient(server),
+				logger:                      testLogger(),
+				cleanupLoc:                  time.UTC,
+				cleanupSettleDelay:          time.Millisecond,
+				cleanupBackoffMin:           time.Millisecond,
+				cleanupBackoffMax:           5 * time.Millisecond,
+				cleanupPassDeleteInterval:   time.Millisecond,
+				cleanupRequireDestroyAllAck: tt.requireAck,
+				cleanupAllInstances:         tt.allInstances,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("reconcileDestroyAllInstances() error = %v, want %v", err, tt.wantErr)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			sort.Strings(deleted)
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Fatalf("deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestReconcileSeparateVerifyPollsWithoutRedeleting(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu          sync.Mutex
+		deleteCalls int
+		listCalls   int
+		deletedAt   int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			listCalls++
+			var list []vultrInstance
+			// Deleted instances linger for a few more listings, as they do upstream.
+			if deletedAt == 0 || listCalls < deletedAt+3 {
+				list = []vultrInstance{{ID: "inst-a", Label: "paropal-a"}, {ID: "inst-b", Label: "paropal-b"}}
+			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+			deleteCalls++
+			if deletedAt == 0 {
+				deletedAt = listCalls
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a := &app{
+		vultr:                     newTestVultrClient(server),
+		logger:                    testLogger(),
+		cleanupSettleDelay:        time.Millisecond,
+		cleanupBackoffMin:         time.Millisecond,
+		cleanupBackoffMax:         5 * time.Millisecond,
+		cleanupPassDeleteInterval: time.Millisecond,
+		cleanupSeparateVerify:     true,
+		cleanupVerifyInterval:     time.Millisecond,
+		cleanupVerifyIntervalMax:  2 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatalf("reconcileDestroyAllInstances() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if deleteCalls != 2 {
+		t.Fatalf("delete calls = %d, want 2", deleteCalls)
+	}
+	if listCalls != 4 {
+		t.Fatalf("list calls = %d, want 4", listCalls)
+	}
+}
+
+func TestShutdownDrainsInFlightReconcile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		finishRun  bool
+		wantDrains bool
+	}{
+		{name: "waits for reconcile to finish", finishRun: true, wantDrains: true},
+		{name: "cancels reconcile at timeout", finishRun: false, wantDrains: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			backgroundCtx, stopBackground := context.WithCancel(context.Background())
+			defer stopBackground()
+
+			a := &app{
+				logger:         testLogger(),
+				server:         &http.Server{},
+				stopBackground: stopBackground,
+				shutdownDrain:  true,
+			}
+
+			if !a.runs.begin() {
+				t.Fatal("runs.begin() = false before shutdown")
+			}
+
+			finished := make(chan struct{})
+			go func() {
+				if tt.finishRun {
+					time.Sleep(30 * time.Millisecond)
+				} else {
+					<-backgroundCtx.Done()
+				}
+				close(finished)
+			}()
+
+			done := make(chan struct{})
+			go func() {
+				a.shutdown(200 * time.Millisecond)
+				close(done)
+			}()
+
+			if tt.finishRun {
+				<-finished
+				if backgroundCtx.Err() != nil {
+					t.Fatal("background context cancelled before reconcile finished")
+				}
+				a.runs.end()
+			}
+
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("shutdown did not return")
+			}
+			if backgroundCtx.Err() == nil {
+				t.Fatal("background context not cancelled after shutdown")
+			}
+			if !tt.wantDrains {
+				<-finished
+			}
+			if a.runs.begin() {
+				t.Fatal("runs.begin() = true after shutdown started draining")
+			}
+		})
+	}
+}
+
+func TestShutdownDrainLeavesServerItsOwnTimeout(t *testing.T) {
+	t.Parallel()
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	started := make(chan struct{})
+
+	logger, logs := capturingLogger()
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			// The request finishes only once the drain has timed out and
+			// background work is stopped.
+			<-backgroundCtx.Done()
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	a := &app{
+		logger:         logger,
+		server:         server,
+		stopBackground: stopBackground,
+		shutdownDrain:  true,
+	}
+	if !a.runs.begin() {
+		t.Fatal("runs.begin() = false before shutdown")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go server.Serve(listener)
+
+	got := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			got <- 0
+			return
+		}
+		resp.Body.Close()
+		got <- resp.StatusCode
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		a.shutdown(100 * time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+	if code := <-got; code != http.StatusOK {
+		t.Fatalf("in-flight request status = %d, want %d", code, http.StatusOK)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "shutdown timeout reached while draining reconcile") {
+		t.Fatalf("logs = %q, want the drain to time out", out)
+	}
+	if strings.Contains(out, "forcing server close") || !strings.Contains(out, "graceful shutdown complete") {
+		t.Fatalf("logs = %q, want a graceful server shutdown after the drain timed out", out)
+	}
+	a.runs.end()
+}
+
+func TestShutdownForcesCloseOnLingeringConnection(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+
+	logger, logs := capturingLogger()
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			close(started)
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}),
+	}
+	a := &app{logger: logger, server: server}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/download")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		a.shutdown(50 * time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("Serve() error = %v, want %v", err, http.ErrServerClosed)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("lingering response completed; want connection closed")
+	}
+	if !strings.Contains(logs.String(), "forcing server close") {
+		t.Fatalf("logs = %q, want forced close escalation", logs.String())
+	}
+}
+
+func TestComputeDDay(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("KST", 9*60*60)
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantDays  int
+		wantLabel string
+	}{
+		{name: "days before target", now: time.Date(2026, 2, 23, 9, 0, 0, 0, loc), wantDays: 3, wantLabel: "D-3"},
+		{name: "late evening counts the calendar day", now: time.Date(2026, 2, 25, 23, 59, 0, 0, loc), wantDays: 1, wantLabel: "D-1"},
+		{name: "target day", now: time.Date(2026, 2, 26, 0, 0, 0, 0, loc), wantDays: 0, wantLabel: "D-Day"},
+		{name: "utc clock already on target day in kst", now: time.Date(2026, 2, 25, 15, 30, 0, 0, time.UTC), wantDays: 0, wantLabel: "D-Day"},
+		{name: "past deadline", now: time.Date(2026, 3, 1, 12, 0, 0, 0, loc), wantDays: -3, wantLabel: "D+3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := computeDDay(tt.now, "2026-02-26", loc)
+			if err != nil {
+				t.Fatalf("computeDDay() error = %v", err)
+			}
+			if got.Target != "2026-02-26" || got.DaysRemaining != tt.wantDays || got.Label != tt.wantLabel {
+				t.Fatalf("computeDDay() = %+v, want days %d label %q", got, tt.wantDays, tt.wantLabel)
+			}
+		})
+	}
+
+	if _, err := computeDDay(time.Now(), "26/02/2026", loc); err == nil {
+		t.Fatal("computeDDay() with malformed target error = nil, want error")
+	}
+}
+
+func TestReadyzProbesVultr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+	}{
+		{name: "healthy upstream", status: http.StatusOK, wantStatus: http.StatusOK},
+		{name: "failing upstream", status: http.StatusInternalServerError, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var probes atomic.Int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				probes.Add(1)
+				if r.URL.Path != "/v2/account" {
+					http.NotFound(w, r)
+					return
+				}
+				if tt.status != http.StatusOK {
+					writeJSON(w, tt.status, map[string]string{"error": "internal error"})
+					return
+				}
+				writeJSON(w, http.StatusOK, accountResponse{})
+			}))
+			defer upstream.Close()
+
+			a := &app{vultr: newTestVultrClient(upstream), logger: testLogger()}
+			handler := a.routes()
+			for range 2 {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("GET /readyz status = %d, want %d", rec.Code, tt.wantStatus)
+				}
+
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("GET /healthz status = %d, want %d", rec.Code, http.StatusOK)
+				}
+			}
+
+			// A recent success is reused; failures are probed every time.
+			wantProbes := int32(2)
+			if tt.status == http.StatusOK {
+				wantProbes = 1
+			}
+			if got := probes.Load(); got != wantProbes {
+				t.Fatalf("upstream probes = %d, want %d", got, wantProbes)
+			}
+		})
+	}
+}
+
+func TestHandleCloudConfigReturnsRenderedYAML(t *testing.T) {
+	t.Parallel()
+
+	a := &app{
+		logger:           testLogger(),
+		shutdownTokens:   []string{"s3cret-token"},
+		sshPort:          2222,
+		readyCallbackURL: "https://daemon.example/api/instance/ready",
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/cloud-config", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("Content-Type = %q, want text/plain", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"#cloud-config",
+		"paropal-base-init.sh " + provisionPrimaryUser + " 2222",
+		"PAROPAL_READY_URL='https://daemon.example/api/instance/ready'",
+		"PAROPAL_READY_TOKEN='<ready-token>'",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("cloud-config is missing %q:\n%s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/cloud-config", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status without token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if strings.Contains(rec.Body.String(), provisionPrimaryUser) {
+		t.Fatal("unauthenticated response leaks the cloud-config")
+	}
+}
+
+func TestHandleConfigOmitsSecrets(t *testing.T) {
+	t.Parallel()
+
+	const (
+		apiKey       = "vultr-primary-key-123"
+		secondaryKey = "vultr-secondary-key-456"
+		webhookURL   = "https://hooks.example/T000/secret-path"
+	)
+	a := &app{
+		vultr:           &vultrClient{apiKey: apiKey},
+		secondaryVultr:  &vultrClient{apiKey: secondaryKey},
+		logger:          testLogger(),
+		shutdownTokens:  []string{"s3cret-token"},
+		schedule:        defaultSchedule,
+		cleanupLoc:      time.UTC,
+		labelLoc:        time.UTC,
+		cleanupDryRun:   true,
+		sshPort:         2222,
+		firewallGroupID: "fw-1",
+		notifier:        &notifier{url: webhookURL},
+	}
+	handler := a.routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	raw := rec.Body.String()
+	for _, secret := range []string{apiKey, secondaryKey, "s3cret-token", webhookURL, "secret-path"} {
+		if strings.Contains(raw, secret) {
+			t.Fatalf("config response contains secret %q: %s", secret, raw)
+		}
+	}
+
+	var got exportedConfig
+	if err := json.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Schedule.CleanupAt != "00:10" || got.Schedule.CleanupWindow != "00:00-07:00" || got.TimeZone != "UTC" {
+		t.Fatalf("schedule = %+v timezone = %q, want the default schedule in UTC", got.Schedule, got.TimeZone)
+	}
+	if !got.Cleanup.DryRun || got.Provision.SSHPort != 2222 || got.Provision.FirewallGroupID != "fw-1" || !got.Provision.SecondaryAccount {
+		t.Fatalf("config = %+v, want dry run, ssh port 2222, firewall fw-1 and a secondary account", got)
+	}
+	if got.Secrets.VultrAPIKey != secretFingerprint(apiKey) || !reflect.DeepEqual(got.Secrets.ShutdownTokens, []string{secretFingerprint("s3cret-token")}) {
+		t.Fatalf("secrets = %+v, want fingerprints", got.Secrets)
+	}
+	if got.Secrets.VultrAPIKey == got.Secrets.SecondaryVultrAPIKey {
+		t.Fatal("different API keys share a fingerprint")
+	}
+	if got.Notify.WebhookFingerprint != secretFingerprint(webhookURL) {
+		t.Fatalf("webhook fingerprint = %q, want %q", got.Notify.WebhookFingerprint, secretFingerprint(webhookURL))
+	}
+}
+
+func TestNewLoggerHonoursFormatAndLevel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format, level string
+		wantJSON      bool
+		wantDebug     bool
+	}{
+		{format: "", level: "", wantJSON: false, wantDebug: false},
+		{format: "text", level: "debug", wantJSON: false, wantDebug: true},
+		{format: "JSON", level: "info", wantJSON: true, wantDebug: false},
+		{format: "json", level: "debug", wantJSON: true, wantDebug: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, tt.format, tt.level)
+			if err != nil {
+				t.Fatalf("newLogger() error = %v", err)
+			}
+			if _, isJSON := logger.Handler().(*slog.JSONHandler); isJSON != tt.wantJSON {
+				t.Fatalf("handler = %T, want JSON %v", logger.Handler(), tt.wantJSON)
+			}
+
+			logger.Debug("debug detail")
+			if got := strings.Contains(buf.String(), "debug detail"); got != tt.wantDebug {
+				t.Fatalf("debug emitted = %v, want %v (output %q)", got, tt.wantDebug, buf.String())
+			}
+			logger.Info("run started")
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if last := lines[len(lines)-1]; json.Valid([]byte(last)) != tt.wantJSON {
+				t.Fatalf("last line %q, want JSON %v", last, tt.wantJSON)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("newLogger() error = %v", err)
+	}
+	logger.Info("quiet")
+	logger.Error("loud")
+	if out := buf.String(); strings.Contains(out, "quiet") || !strings.Contains(out, "loud") {
+		t.Fatalf("warn level output = %q", out)
+	}
+
+	if _, err := newLogger(io.Discard, "logfmt", ""); err == nil {
+		t.Fatal("newLogger() error = nil for an unknown format")
+	}
+	if _, err := newLogger(io.Discard, "", "trace"); err == nil {
+		t.Fatal("newLogger() error = nil for an unknown level")
+	}
+}
+
+func TestRefuseWhileDrainingRejectsAPIRequests(t *testing.T) {
+	t.Parallel()
+
+	a := &app{
+		vultr:  &vultrClient{},
+		logger: testLogger(),
+	}
+	handler := a.refuseWhileDraining(a.routes())
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/api/runs"); rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/runs before draining = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	a.draining.Store(true)
+	for _, path := range []string{"/api/runs", "/api/charges"} {
+		rec := get(path)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("GET %s while draining = %d, want %d", path, rec.Code, http.StatusServiceUnavailable)
+		}
+		if got, want := rec.Header().Get("Retry-After"), strconv.Itoa(int(shutdownTimeout.Seconds())); got != want {
+			t.Fatalf("GET %s Retry-After = %q, want %q", path, got, want)
+		}
+	}
+	for _, path := range []string{"/", "/healthz"} {
+		if rec := get(path); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s while draining = %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+	if rec := get("/readyz"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "draining") {
+		t.Fatalf("GET /readyz while draining = %d %s, want 503 draining", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLogRequestsRecordsStatusAndRequestID(t *testing.T) {
+	t.Parallel()
+
+	logger, logs := capturingLogger()
+	a := &app{logger: logger}
+	var seenID string
+	handler := a.logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID = requestIDFromContext(r.Context())
+		writeJSON(w, http.StatusTeapot, map[string]string{"error": "short and stout"})
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/provision", nil))
+
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+	id := rec.Header().Get(requestIDHeader)
+	if len(id) != 8 {
+		t.Fatalf("%s = %q, want an 8-character ID", requestIDHeader, id)
+	}
+	if seenID != id {
+		t.Fatalf("request ID in context = %q, want %q", seenID, id)
+	}
+	out := logs.String()
+	for _, want := range []string{
+		"msg=\"http request\"",
+		"request_id=" + id,
+		"method=POST",
+		"path=/api/provision",
+		"status=418",
+		fmt.Sprintf("bytes=%d", rec.Body.Len()),
+		"elapsed=",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("access log %q missing %q", out, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if next := rec.Header().Get(requestIDHeader); next == "" || next == id {
+		t.Fatalf("second request ID = %q, want a fresh one", next)
+	}
+	if !strings.Contains(logs.String(), "level=DEBUG msg=\"http request\"") {
+		t.Fatalf("health check not logged at debug: %q", logs.String())
+	}
+}
+
+func TestHandleLogsReturnsBufferedRecordsNewestFirst(t *testing.T) {
+	t.Parallel()
+
+	ring := newLogRing(3)
+	logger := withLogBuffer(testLogger(), ring)
+	a := &app{
+		logger:         logger,
+		shutdownTokens: []string{"s3cret-token"},
+		logs:           ring,
+	}
+
+	logger.Debug("not buffered below info")
+	logger.Info("first")
+	logger.Info("second", "instance_id", "inst-1")
+	logger.With("account", "primary").WithGroup("run").Warn("third", "kind", "cleanup")
+	logger.Error("fourth", "error", errors.New("boom"), "wait", 1500*time.Millisecond)
+
+	handler := a.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/logs", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/logs", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var body struct {
+		Logs []logEntry `json:"logs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	var messages []string
+	for _, entry := range body.Logs {
+		messages = append(messages, entry.Message)
+	}
+	if want := []string{"fourth", "third", "second"}; !reflect.DeepEqual(messages, want) {
+		t.Fatalf("messages = %v, want %v", messages, want)
+	}
+	if got := body.Logs[0]; got.Level != "ERROR" || got.Attrs["error"] != "boom" || got.Attrs["wait"] != "1.5s" {
+		t.Fatalf("newest entry = %+v, want ERROR with error=boom wait=1.5s", got)
+	}
+	if got := body.Logs[1].Attrs; got["account"] != "primary" || got["run.kind"] != "cleanup" {
+		t.Fatalf("grouped entry attrs = %v, want account and run.kind", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/logs?limit=1", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body.Logs = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode limited body: %v", err)
+	}
+	if len(body.Logs) != 1 || body.Logs[0].Message != "fourth" {
+		t.Fatalf("limited logs = %+v, want only the newest", body.Logs)
+	}
+}
+
+func TestHealthzReportsLastVultrSuccessAge(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp accountResponse
+		resp.Account.PendingCharges = 1.5
+		writeJSON(w, http.StatusOK, resp)
+	}))
+	defer upstream.Close()
+
+	a := &app{
+		vultr:  newTestVultrClient(upstream),
+		logger: testLogger(),
+	}
+
+	get := func() healthStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /healthz status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var status healthStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode /healthz: %v", err)
+		}
+		return status
+	}
+
+	if status := get(); status.LastVultrSuccess != nil || status.LastVultrSuccessAgeSeconds != nil {
+		t.Fatalf("healthz before any call = %+v, want no last success", status)
+	}
+
+	before := time.Now()
+	if _, err := a.vultr.pendingCharges(context.Background()); err != nil {
+		t.Fatalf("pendingCharges() error = %v", err)
+	}
+	if last := a.vultr.lastSuccessAt(); last.Before(before) {
+		t.Fatalf("lastSuccessAt() = %v, want at or after %v", last, before)
+	}
+
+	status := get()
+	if status.LastVultrSuccessAgeSeconds == nil || *status.LastVultrSuccessAgeSeconds < 0 || *status.LastVultrSuccessAgeSeconds > 5 {
+		t.Fatalf("healthz age = %v, want a small non-negative age", status.LastVultrSuccessAgeSeconds)
+	}
+}
+
+func TestSchedulerStateConcurrentReadsAndRunUpdates(t *testing.T) {
+	t.Parallel()
+
+	a := &app{logger: testLogger()}
+	handler := a.routes()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			now := time.Now()
+			a.scheduler.startRun("cleanup", now, now)
+			var err error
+			if i%2 == 1 {
+				err = errCleanupWindowClosed
+			}
+			a.scheduler.finishRun("cleanup", time.Now(), err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET /api/runs status = %d, want %d", rec.Code, http.StatusOK)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	record, ok := a.scheduler.lastRun("cleanup")
+	if !ok {
+		t.Fatal("lastRun(cleanup) missing after runs")
+	}
+	if record.Error != errCleanupWindowClosed.Error() || record.FinishedAt.Before(record.StartedAt) {
+		t.Fatalf("lastRun(cleanup) = %+v, want last failed run", record)
+	}
+	if snap := a.scheduler.snapshot(); len(snap.Active) != 0 || len(snap.LastRuns) != 1 {
+		t.Fatalf("snapshot() = %+v, want no active runs and one last run", snap)
+	}
+}
+
+func TestCleanupNotificationModes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		mode       string
+		wantEvents []string
+	}{
+		{name: "per-event", mode: notifyModeEvent, wantEvents: []string{"instance_deleted", "instance_deleted"}},
+		{name: "per-run", mode: notifyModeRun, wantEvents: []string{"run_summary"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				mu      sync.Mutex
+				events  []notification
+				deleted = map[string]bool{}
+			)
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var event notification
+				if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+					t.Errorf("decode notification: %v", err)
+				}
+				mu.Lock()
+				events = append(events, event)
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer webhook.Close()
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+					var list []vultrInstance
+					for _, id := range []string{"inst-a", "inst-b"} {
+						if !deleted[id] {
+							list = append(list, vultrInstance{ID: id, Label: "paropal-" + id})
+						}
+					}
+					writeJSON(w, http.StatusOK, listInstancesResponse{Instances: list})
+				case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/"):
+					deleted[strings.TrimPrefix(r.URL.Path, "/v2/instances/")] = true
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer upstream.Close()
+
+			a := &app{
+				vultr:                     newTestVultrClient(upstream),
+				logger:                    testLogger(),
+				notifier:                  &notifier{url: webhook.URL, httpClient: webhook.Client()},
+				notifyMode:                tt.mode,
+				cleanupSettleDelay:        time.Millisecond,
+				cleanupBackoffMin:         time.Millisecond,
+				cleanupBackoffMax:         5 * time.Millisecond,
+				cleanupPassDeleteInterval: time.Millisecond,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			now := time.Now()
+			a.scheduler.startRun("cleanup", now, now)
+			err := a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+			a.completeRun(ctx, "cleanup", &a.cleanupFailures, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			var got []string
+			for _, event := range events {
+				got = append(got, event.Event)
+			}
+			if !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Fatalf("webhook events = %v, want %v", got, tt.wantEvents)
+			}
+			if tt.mode != notifyModeRun {
+				return
+			}
+
+			fields := events[0].Fields
+			if fields["deleted"] != float64(2) || fields["created"] != float64(0) || fields["failed"] != float64(0) {
+				t.Fatalf("summary counts = %v, want 2 deleted and nothing else", fields)
+			}
+			if id, _ := fields["run_id"].(string); !strings.HasPrefix(id, "cleanup-") {
+				t.Fatalf("summary run_id = %v, want cleanup- prefix", fields["run_id"])
+			}
+			if _, ok := fields["duration_seconds"].(float64); !ok {
+				t.Fatalf("summary duration_seconds = %v, want a number", fields["duration_seconds"])
+			}
+		})
+	}
+}
+
+func TestLifetimeCountersSurviveRestart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "counters.json")
+
+	var first lifetimeCounters
+	if err := first.load(path); err != nil {
+		t.Fatalf("load() on missing file error = %v", err)
+	}
+	if got := first.snapshot(); got != (counterValues{}) {
+		t.Fatalf("fresh counters = %+v, want zero", got)
+	}
+	for _, delta := range []struct{ created, deleted int64 }{{1, 0}, {0, 2}, {1, 1}} {
+		if err := first.add(delta.created, delta.deleted); err != nil {
+			t.Fatalf("add() error = %v", err)
+		}
+	}
+
+	// A new process starts from what the previous one saved.
+	var restarted lifetimeCounters
+	if err := restarted.load(path); err != nil {
+		t.Fatalf("load() after restart error = %v", err)
+	}
+	want := counterValues{InstancesCreated: 2, InstancesDeleted: 3}
+	if got := restarted.snapshot(); got != want {
+		t.Fatalf("counters after restart = %+v, want %+v", got, want)
+	}
+
+	if err := restarted.add(1, 0); err != nil {
+		t.Fatalf("add() after restart error = %v", err)
+	}
+	var again lifetimeCounters
+	if err := again.load(path); err != nil {
+		t.Fatalf("load() second restart error = %v", err)
+	}
+	if got := again.snapshot(); got.InstancesCreated != 3 {
+		t.Fatalf("created after second restart = %d, want 3", got.InstancesCreated)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("counters dir has %d entries, want only the counters file", len(entries))
+	}
+}
+
+func TestRunHistorySurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	start := time.Date(2026, 2, 16, 0, 10, 0, 0, time.UTC)
+
+	var first runHistory
+	if err := first.load(path); err != nil {
+		t.Fatalf("load() on missing file error = %v", err)
+	}
+	for i := range runHistoryLimit + 5 {
+		record := newRunRecord("cleanup", start.Add(time.Duration(i)*time.Hour))
+		record.Deleted = i
+		if i%2 == 1 {
+			record.Error = "boom"
+		}
+		if err := first.add(record); err != nil {
+			t.Fatalf("add() error = %v", err)
+		}
+	}
+
+	// A new process starts from what the previous one saved.
+	var restarted runHistory
+	if err := restarted.load(path); err != nil {
+		t.Fatalf("load() after restart error = %v", err)
+	}
+	all := restarted.recent(0)
+	if len(all) != runHistoryLimit {
+		t.Fatalf("history holds %d records, want the last %d", len(all), runHistoryLimit)
+	}
+	if newest := all[0]; newest.Deleted != runHistoryLimit+4 || newest.Error != "" || !newest.StartedAt.Equal(start.Add(time.Duration(runHistoryLimit+4)*time.Hour)) {
+		t.Fatalf("newest record = %+v", newest)
+	}
+	if oldest := all[len(all)-1]; oldest.Deleted != 5 || oldest.Error != "boom" {
+		t.Fatalf("oldest record = %+v, want the sixth run", oldest)
+	}
 
-	if len(st.instances) != 0 {
-		t.Fatalf("reconcileDestroyAllInstances() left %d instances; want 0", len(st.instances))
+	a := &app{logger: testLogger()}
+	if err := a.history.load(path); err != nil {
+		t.Fatalf("load() error = %v", err)
 	}
-	if st.deleteCalls != 2 {
-		t.Fatalf("expected 2 delete calls, got %d", st.deleteCalls)
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?limit=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
 	}
-	if st.listCalls < 2 {
-		t.Fatalf("expected at least 2 list calls, got %d", st.listCalls)
+	var body struct {
+		Runs []runRecord `json:"runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Runs) != 2 || body.Runs[0].Deleted != runHistoryLimit+4 || body.Runs[1].Deleted != runHistoryLimit+3 {
+		t.Fatalf("GET /api/history?limit=2 = %+v", body.Runs)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("state dir has %d entries, want only the state file", len(entries))
 	}
 }
 
-func TestReconcileRetriesAfterTransientListFailure(t *testing.T) {
+func TestRunHistoryRecoversFromCorruptFile(t *testing.T) {
 	t.Parallel()
 
-	type state struct {
-		mu                sync.Mutex
-		listCalls         int
-		failuresRemaining int
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`[{"id":"cleanup-1","kind":"clean`), 0o644); err != nil {
+		t.Fatal(err)
 	}
 
-	st := &state{failuresRemaining: 1}
+	var history runHistory
+	if err := history.load(path); err == nil {
+		t.Fatal("load() error = nil for a truncated file")
+	}
+	if got := history.recent(0); len(got) != 0 {
+		t.Fatalf("history after corrupt load = %+v, want empty", got)
+	}
 
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet || r.URL.Path != "/v2/instances" {
-			http.NotFound(w, r)
-			return
-		}
+	record := newRunRecord("provision", time.Date(2026, 2, 16, 7, 10, 0, 0, time.UTC))
+	record.Created = 1
+	if err := history.add(record); err != nil {
+		t.Fatalf("add() after corrupt load error = %v", err)
+	}
 
-		st.mu.Lock()
-		st.listCalls++
-		shouldFail := st.failuresRemaining > 0
-		if shouldFail {
-			st.failuresRemaining--
-		}
-		st.mu.Unlock()
+	var restarted runHistory
+	if err := restarted.load(path); err != nil {
+		t.Fatalf("load() after rewrite error = %v", err)
+	}
+	if got := restarted.recent(0); len(got) != 1 || got[0].ID != record.ID || got[0].Created != 1 {
+		t.Fatalf("history after rewrite = %+v, want just %s", got, record.ID)
+	}
+}
 
-		if shouldFail {
-			http.Error(w, "temporary upstream failure", http.StatusBadGateway)
-			return
-		}
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan *fakeTimer
+}
 
-		resp := listInstancesResponse{Instances: nil}
-		writeJSON(w, http.StatusOK, resp)
-	}))
-	defer server.Close()
+type fakeTimer struct {
+	c chan time.Time
+	d time.Duration
+}
 
-	a := &app{
-		vultr:                     newTestVultrClient(server),
-		logger:                    testLogger(),
-		cleanupSettleDelay:        time.Millisecond,
-		cleanupBackoffMin:         time.Millisecond,
-		cleanupBackoffMax:         5 * time.Millisecond,
-		cleanupPassDeleteInterval: time.Millisecond,
-	}
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+func (t *fakeTimer) Stop() bool { return true }
 
-	a.reconcileDestroyAllInstances(ctx, time.Now().Add(2*time.Second))
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
 
-	st.mu.Lock()
-	defer st.mu.Unlock()
-	if st.listCalls < 2 {
-		t.Fatalf("expected retry after transient failure; list calls = %d", st.listCalls)
-	}
+func (c *fakeClock) NewTimer(d time.Duration) clockTimer {
+	t := &fakeTimer{c: make(chan time.Time, 1), d: d}
+	c.timers <- t
+	return t
 }
 
-func TestReconcileStopsAtCutoff(t *testing.T) {
-	t.Parallel()
+func (c *fakeClock) set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
 
-	type state struct {
-		mu          sync.Mutex
-		listCalls   int
-		deleteCalls int
-	}
+// advance moves the clock forward by d and returns the new time.
+func (c *fakeClock) advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
 
-	st := &state{}
+func TestRunDailyProvisionSurvivesClockJumps(t *testing.T) {
+	t.Parallel()
 
+	var lists atomic.Int32
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		st.mu.Lock()
-		defer st.mu.Unlock()
-		if r.Method == http.MethodGet && r.URL.Path == "/v2/instances" {
-			st.listCalls++
-			resp := listInstancesResponse{
-				Instances: []vultrInstance{{ID: "inst-a", Label: "a"}},
-			}
-			writeJSON(w, http.StatusOK, resp)
-			return
-		}
-		if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v2/instances/") {
-			st.deleteCalls++
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
+			lists.Add(1)
+			writeJSON(w, http.StatusOK, listInstancesResponse{
+				Instances: []vultrInstance{{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"}},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
 			w.WriteHeader(http.StatusNoContent)
-			return
+		default:
+			http.NotFound(w, r)
 		}
-		http.NotFound(w, r)
 	}))
 	defer server.Close()
 
+	kst := time.FixedZone("KST", 9*60*60)
+	clk := &fakeClock{
+		now:    time.Date(2026, time.February, 16, 6, 0, 0, 0, kst),
+		timers: make(chan *fakeTimer, 1),
+	}
 	a := &app{
-		vultr:                     newTestVultrClient(server),
-		logger:                    testLogger(),
-		cleanupLoc:                time.FixedZone("KST", 9*60*60),
-		cleanupSettleDelay:        time.Millisecond,
-		cleanupBackoffMin:         time.Millisecond,
-		cleanupBackoffMax:         5 * time.Millisecond,
-		cleanupPassDeleteInterval: time.Millisecond,
+		vultr:                    newTestVultrClient(server),
+		logger:                   testLogger(),
+		cleanupLoc:               kst,
+		schedule:                 defaultSchedule,
+		labelLoc:                 time.UTC,
+		clk:                      clk,
+		schedulerRecheckInterval: time.Minute,
 	}
+	a.scheduler.drift = a.metrics.collectors().schedulerDrift
 
-	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
-	defer cancel()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.runDailyProvision(ctx)
+		close(done)
+	}()
 
-	// Cutoff already passed: no list/delete should be attempted.
-	a.reconcileDestroyAllInstances(ctx, time.Now().Add(-time.Second))
+	nextTimer := func() *fakeTimer {
+		t.Helper()
+		select {
+		case timer := <-clk.timers:
+			return timer
+		case <-time.After(5 * time.Second):
+			t.Fatal("scheduler did not arm a timer")
+			return nil
+		}
+	}
 
-	st.mu.Lock()
-	defer st.mu.Unlock()
-	if st.listCalls != 0 {
-		t.Fatalf("expected 0 list calls after cutoff, got %d", st.listCalls)
+	timer := nextTimer()
+	if timer.d != time.Minute {
+		t.Fatalf("first wait = %s, want recheck interval %s", timer.d, time.Minute)
 	}
-	if st.deleteCalls != 0 {
-		t.Fatalf("expected 0 delete calls after cutoff, got %d", st.deleteCalls)
+
+	// A backward step must not fire the run early.
+	clk.set(time.Date(2026, time.February, 16, 5, 0, 0, 0, kst))
+	timer.c <- time.Time{}
+	timer = nextTimer()
+	if got := lists.Load(); got != 0 {
+		t.Fatalf("provision ran after backward clock jump (%d list calls)", got)
+	}
+
+	// A forward step past the scheduled time fires on the next recheck.
+	clk.set(time.Date(2026, time.February, 16, 7, 15, 0, 0, kst))
+	timer.c <- time.Time{}
+	nextTimer()
+
+	if got := lists.Load(); got != 1 {
+		t.Fatalf("list calls after forward clock jump = %d, want 1", got)
 	}
+	record, ok := a.scheduler.lastRun("provision")
+	if !ok {
+		t.Fatal("no provision run recorded after forward clock jump")
+	}
+	if want := time.Date(2026, time.February, 16, 7, 10, 0, 0, kst); !record.ScheduledAt.Equal(want) {
+		t.Fatalf("scheduled_at = %s, want %s", record.ScheduledAt, want)
+	}
+	if record.DriftSeconds != 300 {
+		t.Fatalf("drift_seconds = %v, want 300 (started 5m late)", record.DriftSeconds)
+	}
+	if got := testutil.ToFloat64(a.metrics.collectors().schedulerDrift.WithLabelValues("provision")); got != 300 {
+		t.Fatalf("paropal_scheduler_drift_seconds{kind=\"provision\"} = %v, want 300", got)
+	}
+
+	cancel()
+	<-done
 }
 
-func TestEnsureParopalInstanceAndBlockReinstallsAfterCreate(t *testing.T) {
+func TestRunDailyCleanupCompletesOnFakeClock(t *testing.T) {
 	t.Parallel()
 
 	var (
-		mu    sync.Mutex
-		calls []string
+		mu      sync.Mutex
+		deleted []string
 	)
-
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		mu.Lock()
-		calls = append(calls, r.Method+" "+r.URL.Path)
-		mu.Unlock()
-
+		defer mu.Unlock()
 		switch {
 		case r.Method == http.MethodGet && r.URL.Path == "/v2/instances":
-			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: nil})
-			return
-		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances":
-			var req createInstanceRequest
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				t.Fatalf("decode create request: %v", err)
-			}
-			if strings.TrimSpace(req.UserData) == "" {
-				t.Fatalf("expected non-empty user_data in create request")
-			}
-			writeJSON(w, http.StatusCreated, createInstanceResponse{
-				Instance: struct {
-					ID string `json:"id"`
-				}{ID: "inst-123"},
-			})
-			return
-		case r.Method == http.MethodPost && r.URL.Path == "/v2/blocks/"+provisionBlockStorageID+"/attach":
-			var req attachBlockRequest
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				t.Fatalf("decode attach request: %v", err)
-			}
-			if req.InstanceID != "inst-123" {
-				t.Fatalf("attach request instance_id=%q, want %q", req.InstanceID, "inst-123")
+			var instances []vultrInstance
+			if len(deleted) == 0 {
+				instances = append(instances, vultrInstance{ID: "inst-1", Label: "paropal-02-16_07-10-00", Status: "active"})
 			}
+			writeJSON(w, http.StatusOK, listInstancesResponse{Instances: instances})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/instances/inst-1":
+			deleted = append(deleted, "inst-1")
 			w.WriteHeader(http.StatusNoContent)
-			return
-		case r.Method == http.MethodPost && r.URL.Path == "/v2/instances/inst-123/reinstall":
-			w.WriteHeader(http.StatusNoContent)
-			return
 		default:
 			http.NotFound(w, r)
 		}
 	}))
 	defer server.Close()
 
+	kst := time.FixedZone("KST", 9*60*60)
+	clk := &fakeClock{
+		now:    time.Date(2026, time.February, 16, 23, 50, 0, 0, kst),
+		timers: make(chan *fakeTimer, 1),
+	}
 	a := &app{
-		vultr:    newTestVultrClient(server),
-		logger:   testLogger(),
-		labelLoc: time.UTC,
+		vultr:              newTestVultrClient(server),
+		logger:             testLogger(),
+		cleanupLoc:         kst,
+		schedule:           defaultSchedule,
+		clk:                clk,
+		cleanupSettleDelay: 20 * time.Second,
+		cleanupBackoffMin:  15 * time.Second,
+		cleanupBackoffMax:  5 * time.Minute,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.runDailyCleanup(ctx)
+		close(done)
+	}()
 
-	var state provisionRunState
-	if err := a.ensureParopalInstanceAndBlock(ctx, &state); err != nil {
-		t.Fatalf("ensureParopalInstanceAndBlock() error = %v", err)
-	}
-	if state.instanceID != "inst-123" {
-		t.Fatalf("state.instanceID=%q, want %q", state.instanceID, "inst-123")
+	// Fire every timer the scheduler and the cleanup run arm by moving the
+	// clock forward by exactly its duration, so nothing really sleeps.
+	var waited time.Duration
+	deadline := time.After(5 * time.Second)
+	for {
+		if _, ok := a.scheduler.lastRun("cleanup"); ok {
+			break
+		}
+		select {
+		case timer := <-clk.timers:
+			waited += timer.d
+			timer.c <- clk.advance(timer.d)
+		case <-deadline:
+			t.Fatalf("cleanup run did not finish; fake time advanced %s", waited)
+		}
 	}
+	cancel()
+	<-done
 
+	record, _ := a.scheduler.lastRun("cleanup")
+	if record.Error != "" {
+		t.Fatalf("cleanup run error = %q", record.Error)
+	}
+	if want := time.Date(2026, time.February, 17, 0, 10, 0, 0, kst); !record.ScheduledAt.Equal(want) {
+		t.Fatalf("scheduled_at = %s, want %s", record.ScheduledAt, want)
+	}
+	if record.DriftSeconds != 0 {
+		t.Fatalf("drift_seconds = %v, want 0 on a fake clock", record.DriftSeconds)
+	}
+	// 20 minutes of scheduler rechecks plus the 20s settle delay.
+	if got, want := record.FinishedAt.Sub(time.Date(2026, time.February, 16, 23, 50, 0, 0, kst)), 20*time.Minute+20*time.Second; got != want {
+		t.Fatalf("fake time at finish = +%s, want +%s", got, want)
+	}
 	mu.Lock()
-	got := append([]string(nil), calls...)
-	mu.Unlock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(deleted, []string{"inst-1"}) {
+		t.Fatalf("deleted = %v, want [inst-1]", deleted)
+	}
+}
 
-	want := []string{
-		"GET /v2/instances",
-		"POST /v2/instances",
-		"POST /v2/blocks/" + provisionBlockStorageID + "/attach",
-		"POST /v2/instances/inst-123/reinstall",
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    timeOfDay
+		wantErr string
+	}{
+		{raw: "00:10", want: timeOfDay{Hour: 0, Minute: 10}},
+		{raw: "7:10", want: timeOfDay{Hour: 7, Minute: 10}},
+		{raw: " 23:59 ", want: timeOfDay{Hour: 23, Minute: 59}},
+		{raw: "", wantErr: "empty value"},
+		{raw: "0710", wantErr: "missing the colon"},
+		{raw: "24:00", wantErr: "hour 24 is out of range"},
+		{raw: "07:60", wantErr: "minute 60 is out of range"},
+		{raw: "07:5", wantErr: "two-digit minute"},
+		{raw: "123:00", wantErr: "two-digit hour"},
+		{raw: ":30", wantErr: "two-digit hour"},
+		{raw: "ab:00", wantErr: `hour "ab" is not a number`},
+		{raw: "07:-1", wantErr: `minute "-1" is not a number`},
 	}
-	if !reflect.DeepEqual(got, want) {
-		t.Fatalf("unexpected call sequence:\n got: %#v\nwant: %#v", got, want)
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseTimeOfDay("PAROPAL_TEST_TIME", tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "PAROPAL_TEST_TIME") {
+					t.Fatalf("parseTimeOfDay(%q) error = %v, want field name and %q", tt.raw, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimeOfDay(%q) error = %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseTimeOfDay(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    timeWindow
+		wantErr string
+	}{
+		{raw: "00:00-07:00", want: timeWindow{Start: timeOfDay{0, 0}, End: timeOfDay{7, 0}}},
+		{raw: "1:30 - 5:45", want: timeWindow{Start: timeOfDay{1, 30}, End: timeOfDay{5, 45}}},
+		{raw: "00:00", wantErr: "missing the '-'"},
+		{raw: "0000-07:00", wantErr: "PAROPAL_TEST_WINDOW start"},
+		{raw: "00:00-25:00", wantErr: "PAROPAL_TEST_WINDOW end: hour 25 is out of range"},
+		{raw: "07:00-00:00", wantErr: "end 00:00 is not after start 07:00"},
+		{raw: "03:00-03:00", wantErr: "end 03:00 is not after start 03:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseWindow("PAROPAL_TEST_WINDOW", tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseWindow(%q) error = %v, want %q", tt.raw, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWindow(%q) error = %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseWindow(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
 	}
 }
 
@@ -617,7 +8070,7 @@ func TestSleepWithContextCancellation(t *testing.T) {
 	cancel()
 
 	start := time.Now()
-	ok := sleepWithContext(ctx, time.Second)
+	ok := (&app{}).sleepWithContext(ctx, time.Second)
 	elapsed := time.Since(start)
 
 	if ok {
@@ -628,6 +8081,72 @@ func TestSleepWithContextCancellation(t *testing.T) {
 	}
 }
 
+func TestAcquirePIDFileWritesAndRemoves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paropal.pid")
+
+	release, err := acquirePIDFile(path)
+	if err != nil {
+		t.Fatalf("acquirePIDFile() error = %v", err)
+	}
+
+	pid, ok := readPIDFile(path)
+	if !ok || pid != os.Getpid() {
+		t.Fatalf("pid file holds %d (ok=%v), want %d", pid, ok, os.Getpid())
+	}
+
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("pid file still present after release: %v", err)
+	}
+}
+
+func TestAcquirePIDFileRefusesLiveProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paropal.pid")
+	livePID := os.Getppid()
+	if err := os.WriteFile(path, []byte(strconv.Itoa(livePID)+"\n"), 0o644); err != nil {
+		t.Fatalf("write pid file: %v", err)
+	}
+
+	if _, err := acquirePIDFile(path); err == nil {
+		t.Fatalf("acquirePIDFile() succeeded while pid %d is alive", livePID)
+	}
+
+	pid, _ := readPIDFile(path)
+	if pid != livePID {
+		t.Fatalf("pid file was overwritten: got %d, want %d", pid, livePID)
+	}
+}
+
+func TestAcquirePIDFileTakesOverStaleFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "dead process", content: "2147483646\n"},
+		{name: "garbage", content: "not-a-pid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "paropal.pid")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("write pid file: %v", err)
+			}
+
+			release, err := acquirePIDFile(path)
+			if err != nil {
+				t.Fatalf("acquirePIDFile() error = %v", err)
+			}
+			defer release()
+
+			pid, ok := readPIDFile(path)
+			if !ok || pid != os.Getpid() {
+				t.Fatalf("pid file holds %d (ok=%v), want %d", pid, ok, os.Getpid())
+			}
+		})
+	}
+}
+
 func newTestVultrClient(server *httptest.Server) *vultrClient {
 	return &vultrClient{
 		apiKey:     "test-key",
@@ -639,3 +8158,26 @@ func newTestVultrClient(server *httptest.Server) *vultrClient {
 func testLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
+
+// logCapture collects log output so tests can assert on emitted records.
+type logCapture struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *logCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *logCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
+
+func capturingLogger() (*slog.Logger, *logCapture) {
+	capture := &logCapture{}
+	return slog.New(slog.NewTextHandler(capture, &slog.HandlerOptions{Level: slog.LevelDebug})), capture
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const ddayDateLayout = "2006-01-02"
+
+// ddayStatus is the countdown to the configured target date.
+type ddayStatus struct {
+	Target        string `json:"target"`
+	DaysRemaining int    `json:"days_remaining"`
+	Label         string `json:"label"`
+}
+
+// computeDDay counts calendar days from now to target in loc. The target day
+// itself is D-Day; later days count upwards as D+N with negative
+// days_remaining.
+func computeDDay(now time.Time, target string, loc *time.Location) (ddayStatus, error) {
+	targetDate, err := time.ParseInLocation(ddayDateLayout, target, loc)
+	if err != nil {
+		return ddayStatus{}, fmt.Errorf("parse d-day target %q: %w", target, err)
+	}
+
+	localNow := now.In(loc)
+	today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, loc)
+	// Round to absorb 23h/25h days across DST transitions.
+	days := int(targetDate.Sub(today).Round(24*time.Hour) / (24 * time.Hour))
+
+	label := "D-Day"
+	switch {
+	case days > 0:
+		label = fmt.Sprintf("D-%d", days)
+	case days < 0:
+		label = fmt.Sprintf("D+%d", -days)
+	}
+
+	return ddayStatus{
+		Target:        targetDate.Format(ddayDateLayout),
+		DaysRemaining: days,
+		Label:         label,
+	}, nil
+}
+
+func (a *app) handleDDay(w http.ResponseWriter, r *http.Request) {
+	target := a.ddayTarget
+	if target == "" {
+		target = defaultDDayTarget
+	}
+
+	status, err := computeDDay(time.Now(), target, a.cleanupLoc)
+	if err != nil {
+		a.logger.Error("failed to compute d-day", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "invalid d-day target",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
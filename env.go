@@ -3,9 +3,16 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func newVultrClientFromEnv() (*vultrClient, error) {
@@ -14,20 +21,793 @@ func newVultrClientFromEnv() (*vultrClient, error) {
 		return nil, errors.New("VULTR_API_KEY environment variable is required")
 	}
 
+	// Each call carries its own deadline from defaultVultrTimeouts, so the
+	// http.Client itself has none.
 	return &vultrClient{
-		apiKey:  apiKey,
-		baseURL: vultrBaseURL,
-		httpClient: &http.Client{
-			Timeout: requestTimeout,
-		},
+		apiKey:                 apiKey,
+		baseURL:                vultrBaseURL,
+		httpClient:             &http.Client{},
+		rateLimitWarnRemaining: defaultRateLimitWarnRemaining,
+		maintenanceAfter:       defaultMaintenanceAfter,
+		maxRetries:             defaultVultrMaxRetries,
+		retryBackoff:           defaultVultrRetryBackoff,
 	}, nil
 }
 
-func shutdownTokenFromEnv() (string, error) {
-	token := strings.TrimSpace(os.Getenv(shutdownTokenEnv))
-	if token == "" {
-		return "", fmt.Errorf("%s environment variable is required", shutdownTokenEnv)
+// loadProvisionConfigFromEnv resolves the create specs, falling back to the
+// compiled-in region, plan and OS for anything unset.
+func loadProvisionConfigFromEnv() (provisionConfig, error) {
+	cfg := provisionConfig{
+		Region: provisionRegionID,
+		Plan:   provisionPlanID,
+		OSID:   provisionOSID,
+	}
+	if region := strings.TrimSpace(os.Getenv(provisionRegionEnv)); region != "" {
+		cfg.Region = region
+	}
+	if plan := strings.TrimSpace(os.Getenv(provisionPlanEnv)); plan != "" {
+		cfg.Plan = plan
+	}
+	if raw := strings.TrimSpace(os.Getenv(provisionOSIDEnv)); raw != "" {
+		osID, err := strconv.Atoi(raw)
+		if err != nil {
+			return provisionConfig{}, fmt.Errorf("%s must be a numeric Vultr OS id, got %q", provisionOSIDEnv, raw)
+		}
+		if osID <= 0 {
+			return provisionConfig{}, fmt.Errorf("%s must be positive, got %d", provisionOSIDEnv, osID)
+		}
+		cfg.OSID = osID
+	}
+	return cfg, nil
+}
+
+// shutdownTokenFromEnv reads the accepted bearer tokens. The variable may hold
+// a comma-separated list so tokens can be rotated without downtime.
+func shutdownTokenFromEnv() ([]string, error) {
+	tokens := listFromEnv(shutdownTokenEnv)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s environment variable is required", shutdownTokenEnv)
+	}
+
+	return tokens, nil
+}
+
+// loggerFromEnv builds the daemon's logger from PAROPAL_LOG_FORMAT and
+// PAROPAL_LOG_LEVEL.
+func loggerFromEnv(w io.Writer) (*slog.Logger, error) {
+	return newLogger(w, os.Getenv(logFormatEnv), os.Getenv(logLevelEnv))
+}
+
+// newLogger returns a text or JSON logger writing to w that drops records
+// below level. Empty format and level mean text and info.
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{}
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "", "info":
+		opts.Level = slog.LevelInfo
+	case "debug":
+		opts.Level = slog.LevelDebug
+	case "warn":
+		opts.Level = slog.LevelWarn
+	case "error":
+		opts.Level = slog.LevelError
+	default:
+		return nil, fmt.Errorf("%s must be debug, info, warn or error", logLevelEnv)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("%s must be text or json", logFormatEnv)
+	}
+}
+
+// applyEnvOverrides replaces the compiled-in defaults on a with any optional
+// settings present in the environment.
+func applyEnvOverrides(a *app) error {
+	minWindowRemaining, err := durationFromEnv(cleanupMinWindowRemainingEnv, a.cleanupMinWindowRemaining)
+	if err != nil {
+		return err
+	}
+	a.cleanupMinWindowRemaining = minWindowRemaining
+
+	cleanupMultiplier, err := backoffMultiplierFromEnv(cleanupBackoffMultiplierEnv, a.cleanupBackoffMultiplier)
+	if err != nil {
+		return err
+	}
+	a.cleanupBackoffMultiplier = cleanupMultiplier
+
+	provisionMultiplier, err := backoffMultiplierFromEnv(provisionBackoffMultiplierEnv, a.provisionBackoffMultiplier)
+	if err != nil {
+		return err
+	}
+	a.provisionBackoffMultiplier = provisionMultiplier
+
+	jitter, err := boolFromEnv(backoffJitterEnv, a.backoffJitter)
+	if err != nil {
+		return err
+	}
+	a.backoffJitter = jitter
+
+	logDecisions, err := boolFromEnv(cleanupLogDecisionsEnv, a.cleanupLogDecisions)
+	if err != nil {
+		return err
+	}
+	a.cleanupLogDecisions = logDecisions
+
+	logBufferSize, err := intFromEnv(logBufferSizeEnv, a.logBufferSize)
+	if err != nil {
+		return err
+	}
+	if logBufferSize > maxLogBufferSize {
+		return fmt.Errorf("%s must be at most %d", logBufferSizeEnv, maxLogBufferSize)
+	}
+	a.logBufferSize = logBufferSize
+
+	warnRemaining, err := intFromEnv(rateLimitWarnRemainingEnv, a.vultr.rateLimitWarnRemaining)
+	if err != nil {
+		return err
+	}
+	a.vultr.rateLimitWarnRemaining = warnRemaining
+
+	a.readyFile = strings.TrimSpace(os.Getenv(readyFileEnv))
+
+	replaceFailed, err := boolFromEnv(provisionReplaceFailedEnv, a.provisionReplaceFailed)
+	if err != nil {
+		return err
+	}
+	a.provisionReplaceFailed = replaceFailed
+
+	attachLive, err := boolFromEnv(blockAttachLiveEnv, a.blockAttachLive)
+	if err != nil {
+		return err
+	}
+	a.blockAttachLive = attachLive
+
+	attachVerifyTimeout, err := durationFromEnv(attachVerifyTimeoutEnv, a.attachVerifyTimeout)
+	if err != nil {
+		return err
+	}
+	a.attachVerifyTimeout = attachVerifyTimeout
+
+	attachVerifyInterval, err := durationFromEnv(attachVerifyIntervalEnv, a.attachVerifyInterval)
+	if err != nil {
+		return err
+	}
+	a.attachVerifyInterval = attachVerifyInterval
+
+	provision, err := loadProvisionConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	a.provision = provision
+
+	dryRun, err := boolFromEnv(provisionDryRunEnv, a.provisionDryRun)
+	if err != nil {
+		return err
+	}
+	a.provisionDryRun = dryRun
+
+	requireActive, err := boolFromEnv(provisionRequireActiveEnv, a.provisionRequireActive)
+	if err != nil {
+		return err
+	}
+	a.provisionRequireActive = requireActive
+
+	activeTimeout, err := durationFromEnv(provisionActiveTimeoutEnv, a.provisionActiveTimeout)
+	if err != nil {
+		return err
+	}
+	a.provisionActiveTimeout = activeTimeout
+
+	if layout := os.Getenv(labelTimeFormatEnv); strings.TrimSpace(layout) != "" {
+		if err := validateLabelTimeFormat(layout); err != nil {
+			return fmt.Errorf("%s: %w", labelTimeFormatEnv, err)
+		}
+		a.labelTimeFormat = layout
+	}
+
+	requireServerOK, err := boolFromEnv(provisionRequireServerOKEnv, a.provisionRequireServerOK)
+	if err != nil {
+		return err
+	}
+	a.provisionRequireServerOK = requireServerOK
+
+	a.provisionScriptID = strings.TrimSpace(os.Getenv(provisionScriptIDEnv))
+
+	maxInstances, err := intFromEnv(provisionMaxInstancesEnv, a.provisionMaxInstances)
+	if err != nil {
+		return err
+	}
+	a.provisionMaxInstances = maxInstances
+
+	accountMax, err := intFromEnv(accountMaxInstancesEnv, a.accountMaxInstances)
+	if err != nil {
+		return err
+	}
+	a.accountMaxInstances = accountMax
+
+	sshPort, err := intFromEnv(sshPortEnv, a.sshPort)
+	if err != nil {
+		return err
+	}
+	if sshPort > 65535 {
+		return fmt.Errorf("%s must be at most 65535", sshPortEnv)
+	}
+	a.sshPort = sshPort
+	a.firewallGroupID = strings.TrimSpace(os.Getenv(firewallGroupIDEnv))
+
+	if user := strings.TrimSpace(os.Getenv(primaryUserEnv)); user != "" {
+		if !validUnixUser(user) {
+			return fmt.Errorf("%s must be a lowercase Unix user name", primaryUserEnv)
+		}
+		a.primaryUser = user
+	}
+	if keys := listFromEnv(sshKeyIDsEnv); len(keys) > 0 {
+		a.sshKeyIDs = keys
+	}
+	a.extraFilesDir = strings.TrimSpace(os.Getenv(extraFilesEnv))
+
+	if upgrades := listFromEnv(provisionPlanUpgradesEnv); len(upgrades) > 0 {
+		a.provisionPlanUpgrades = upgrades
+	}
+	if regions := listFromEnv(provisionFallbackRegionsEnv); len(regions) > 0 {
+		a.provisionFallbackRegions = regions
+	}
+
+	upgradeBytes, err := intFromEnv(planUpgradeBandwidthBytesEnv, int(a.planUpgradeBandwidthBytes))
+	if err != nil {
+		return err
+	}
+	a.planUpgradeBandwidthBytes = int64(upgradeBytes)
+
+	attachBackoffMin, err := durationFromEnv(provisionAttachBackoffMinEnv, a.provisionAttachBackoffMin)
+	if err != nil {
+		return err
+	}
+	attachBackoffMax, err := durationFromEnv(provisionAttachBackoffMaxEnv, a.provisionAttachBackoffMax)
+	if err != nil {
+		return err
+	}
+	if attachBackoffMax < attachBackoffMin {
+		return fmt.Errorf("%s must not be less than %s", provisionAttachBackoffMaxEnv, provisionAttachBackoffMinEnv)
+	}
+	a.provisionAttachBackoffMin = attachBackoffMin
+	a.provisionAttachBackoffMax = attachBackoffMax
+
+	requireCharges, err := boolFromEnv(cleanupRequirePendingChargesEnv, a.cleanupRequirePendingCharges)
+	if err != nil {
+		return err
+	}
+	a.cleanupRequirePendingCharges = requireCharges
+
+	minCharges, err := floatFromEnv(cleanupMinPendingChargesEnv, a.cleanupMinPendingCharges)
+	if err != nil {
+		return err
+	}
+	a.cleanupMinPendingCharges = minCharges
+
+	usePartialList, err := boolFromEnv(cleanupUsePartialListEnv, a.cleanupUsePartialList)
+	if err != nil {
+		return err
+	}
+	a.cleanupUsePartialList = usePartialList
+
+	runTimeout, err := durationFromEnv(provisionRunTimeoutEnv, a.provisionRunTimeout)
+	if err != nil {
+		return err
+	}
+	a.provisionRunTimeout = runTimeout
+
+	alertAfter, err := intFromEnv(alertAfterFailedRunsEnv, a.alertAfterFailedRuns)
+	if err != nil {
+		return err
+	}
+	a.alertAfterFailedRuns = alertAfter
+
+	settleMax, err := durationFromEnv(cleanupSettleDelayMaxEnv, a.cleanupSettleDelayMax)
+	if err != nil {
+		return err
+	}
+	a.cleanupSettleDelayMax = settleMax
+
+	deleteConcurrency, err := intFromEnv(cleanupDeleteConcurrencyEnv, a.cleanupDeleteConcurrency)
+	if err != nil {
+		return err
+	}
+	a.cleanupDeleteConcurrency = deleteConcurrency
+
+	pruneMaxAge, err := durationFromEnv(pruneMaxAgeEnv, a.pruneMaxAge)
+	if err != nil {
+		return err
+	}
+	a.pruneMaxAge = pruneMaxAge
+
+	pruneInterval, err := durationFromEnv(pruneIntervalEnv, a.pruneInterval)
+	if err != nil {
+		return err
+	}
+	a.pruneInterval = pruneInterval
+
+	warmupDelay, err := durationFromEnv(warmupDelayEnv, a.warmupDelay)
+	if err != nil {
+		return err
+	}
+	a.warmupDelay = warmupDelay
+
+	dashboardMax, err := intFromEnv(dashboardMaxConcurrentEnv, a.dashboardMaxConcurrent)
+	if err != nil {
+		return err
+	}
+	a.dashboardMaxConcurrent = dashboardMax
+
+	dashboardWait, err := durationFromEnv(dashboardQueueTimeoutEnv, a.dashboardQueueTimeout)
+	if err != nil {
+		return err
+	}
+	a.dashboardQueueTimeout = dashboardWait
+
+	chargesRetries, err := intFromEnv(chargesRetriesEnv, a.chargesRetries)
+	if err != nil {
+		return err
+	}
+	a.chargesRetries = chargesRetries
+
+	chargesRetryDelay, err := durationFromEnv(chargesRetryDelayEnv, a.chargesRetryDelay)
+	if err != nil {
+		return err
+	}
+	a.chargesRetryDelay = chargesRetryDelay
+
+	chargesCacheTTL, err := durationFromEnv(chargesCacheTTLEnv, a.chargesCacheTTL)
+	if err != nil {
+		return err
+	}
+	a.chargesCacheTTL = chargesCacheTTL
+
+	cleanupDryRun, err := boolFromEnv(cleanupDryRunEnv, a.cleanupDryRun)
+	if err != nil {
+		return err
+	}
+	a.cleanupDryRun = cleanupDryRun
+
+	a.daemonID = strings.TrimSpace(os.Getenv(daemonIDEnv))
+	ownOnly, err := boolFromEnv(cleanupOwnOnlyEnv, a.cleanupOwnOnly)
+	if err != nil {
+		return err
+	}
+	if ownOnly && a.daemonID == "" {
+		return fmt.Errorf("%s requires %s", cleanupOwnOnlyEnv, daemonIDEnv)
+	}
+	a.cleanupOwnOnly = ownOnly
+
+	deep, err := boolFromEnv(cleanupDeepEnv, a.cleanupDeep)
+	if err != nil {
+		return err
+	}
+	a.cleanupDeep = deep
+
+	switch scope := strings.ToLower(strings.TrimSpace(os.Getenv(cleanupScopeEnv))); scope {
+	case "", "prefix":
+		a.cleanupAllInstances = false
+	case "all":
+		a.cleanupAllInstances = true
+	default:
+		return fmt.Errorf("%s must be \"prefix\" or \"all\"", cleanupScopeEnv)
+	}
+	if strings.EqualFold(strings.TrimSpace(os.Getenv(destroyAllAckEnv)), "yes") {
+		a.cleanupRequireDestroyAllAck = false
+	}
+
+	separateVerify, err := boolFromEnv(cleanupSeparateVerifyEnv, a.cleanupSeparateVerify)
+	if err != nil {
+		return err
+	}
+	a.cleanupSeparateVerify = separateVerify
+
+	confirmDeletes, err := boolFromEnv(cleanupConfirmDeletesEnv, a.cleanupConfirmDeletes)
+	if err != nil {
+		return err
+	}
+	a.cleanupConfirmDeletes = confirmDeletes
+
+	verifyInterval, err := durationFromEnv(cleanupVerifyIntervalEnv, a.cleanupVerifyInterval)
+	if err != nil {
+		return err
+	}
+	verifyIntervalMax, err := durationFromEnv(cleanupVerifyIntervalMaxEnv, a.cleanupVerifyIntervalMax)
+	if err != nil {
+		return err
+	}
+	if verifyIntervalMax < verifyInterval {
+		return fmt.Errorf("%s must not be less than %s", cleanupVerifyIntervalMaxEnv, cleanupVerifyIntervalEnv)
+	}
+	a.cleanupVerifyInterval = verifyInterval
+	a.cleanupVerifyIntervalMax = verifyIntervalMax
+
+	drain, err := boolFromEnv(shutdownDrainEnv, a.shutdownDrain)
+	if err != nil {
+		return err
+	}
+	a.shutdownDrain = drain
+
+	maintenanceAfter, err := intFromEnv(maintenanceAfterEnv, a.vultr.maintenanceAfter)
+	if err != nil {
+		return err
+	}
+	a.vultr.maintenanceAfter = maintenanceAfter
+
+	maxRetries, err := intFromEnv(vultrMaxRetriesEnv, a.vultr.maxRetries)
+	if err != nil {
+		return err
+	}
+	a.vultr.maxRetries = maxRetries
+	retryBackoff, err := durationFromEnv(vultrRetryBackoffEnv, a.vultr.retryBackoff)
+	if err != nil {
+		return err
+	}
+	a.vultr.retryBackoff = retryBackoff
+
+	maintenanceMin, err := durationFromEnv(maintenanceBackoffMinEnv, a.maintenanceBackoffMin)
+	if err != nil {
+		return err
+	}
+	maintenanceMax, err := durationFromEnv(maintenanceBackoffMaxEnv, a.maintenanceBackoffMax)
+	if err != nil {
+		return err
+	}
+	if maintenanceMax < maintenanceMin {
+		return fmt.Errorf("%s must not be less than %s", maintenanceBackoffMaxEnv, maintenanceBackoffMinEnv)
+	}
+	a.maintenanceBackoffMin = maintenanceMin
+	a.maintenanceBackoffMax = maintenanceMax
+
+	timeouts, err := vultrTimeoutsFromEnv(vultrTimeoutsEnv)
+	if err != nil {
+		return err
+	}
+	a.vultr.timeouts = timeouts
+
+	if apiKey := strings.TrimSpace(os.Getenv(secondaryAPIKeyEnv)); apiKey != "" {
+		secondary := &vultrClient{
+			apiKey:                 apiKey,
+			baseURL:                vultrBaseURL,
+			httpClient:             &http.Client{},
+			logger:                 a.logger,
+			rateLimitWarnRemaining: a.vultr.rateLimitWarnRemaining,
+			maintenanceAfter:       a.vultr.maintenanceAfter,
+			timeouts:               a.vultr.timeouts,
+			maxRetries:             a.vultr.maxRetries,
+			retryBackoff:           a.vultr.retryBackoff,
+		}
+		a.secondaryVultr = secondary
+	}
+	a.secondaryBlockStorageID = strings.TrimSpace(os.Getenv(secondaryBlockStorageIDEnv))
+
+	readOnly, err := boolFromEnv(readOnlyEnv, a.readOnly)
+	if err != nil {
+		return err
+	}
+	a.readOnly = readOnly
+	a.vultr.readOnly = readOnly
+	if a.secondaryVultr != nil {
+		a.secondaryVultr.readOnly = readOnly
+	}
+
+	if marker := strings.TrimSpace(os.Getenv(pinnedMarkerEnv)); marker != "" {
+		if strings.Contains(labelPrefix, marker) {
+			return fmt.Errorf("%s %q would pin every %s instance", pinnedMarkerEnv, marker, labelPrefix)
+		}
+		a.pinnedMarker = marker
+		a.vultr.pinnedMarker = marker
+		if a.secondaryVultr != nil {
+			a.secondaryVultr.pinnedMarker = marker
+		}
+	}
+
+	failoverAfter, err := intFromEnv(provisionFailoverAfterEnv, a.provisionFailoverAfter)
+	if err != nil {
+		return err
+	}
+	a.provisionFailoverAfter = failoverAfter
+
+	if target := strings.TrimSpace(os.Getenv(ddayTargetEnv)); target != "" {
+		if _, err := time.Parse(ddayDateLayout, target); err != nil {
+			return fmt.Errorf("%s must be a YYYY-MM-DD date: %w", ddayTargetEnv, err)
+		}
+		a.ddayTarget = target
+	}
+
+	if header := strings.TrimSpace(os.Getenv(authHeaderEnv)); header != "" {
+		if strings.ContainsAny(header, " \t:") {
+			return fmt.Errorf("%s must be a header name", authHeaderEnv)
+		}
+		if header = http.CanonicalHeaderKey(header); header != "Authorization" {
+			a.authHeader = header
+		}
+	}
+
+	adminCIDRs, err := prefixesFromEnv(adminCIDRsEnv)
+	if err != nil {
+		return err
+	}
+	a.adminCIDRs = adminCIDRs
+
+	trustProxy, err := boolFromEnv(trustProxyEnv, a.trustProxy)
+	if err != nil {
+		return err
+	}
+	a.trustProxy = trustProxy
+
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv(provisionModeEnv))); mode {
+	case "", provisionModeCreate:
+	case provisionModeReinstall:
+		a.provisionMode = mode
+	default:
+		return fmt.Errorf("%s must be %q or %q", provisionModeEnv, provisionModeCreate, provisionModeReinstall)
+	}
+
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv(notifyModeEnv))); mode {
+	case "":
+	case notifyModeEvent, notifyModeRun:
+		a.notifyMode = mode
+	default:
+		return fmt.Errorf("%s must be %q or %q", notifyModeEnv, notifyModeEvent, notifyModeRun)
+	}
+
+	if webhookURL := strings.TrimSpace(os.Getenv(webhookURLEnv)); webhookURL != "" {
+		parsed, err := url.Parse(webhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an http(s) URL", webhookURLEnv)
+		}
+		a.notifier = &notifier{
+			url:        webhookURL,
+			httpClient: &http.Client{Timeout: requestTimeout},
+		}
+	}
+
+	carryOver, err := boolFromEnv(snapshotCarryOverEnv, a.snapshotCarryOver)
+	if err != nil {
+		return err
+	}
+	if carryOver && strings.TrimSpace(os.Getenv(snapshotStateFileEnv)) == "" {
+		return fmt.Errorf("%s requires %s", snapshotCarryOverEnv, snapshotStateFileEnv)
+	}
+	a.snapshotCarryOver = carryOver
+
+	snapshotTimeout, err := durationFromEnv(snapshotTimeoutEnv, a.snapshotTimeout)
+	if err != nil {
+		return err
+	}
+	a.snapshotTimeout = snapshotTimeout
+
+	snapshotBeforeDelete, err := boolFromEnv(cleanupSnapshotBeforeDeleteEnv, a.cleanupSnapshotBeforeDelete)
+	if err != nil {
+		return err
+	}
+	a.cleanupSnapshotBeforeDelete = snapshotBeforeDelete
+
+	schedule, err := scheduleFromEnv(a.schedule)
+	if err != nil {
+		return err
+	}
+	a.schedule = schedule
+
+	if callbackURL := strings.TrimSpace(os.Getenv(readyCallbackURLEnv)); callbackURL != "" {
+		parsed, err := url.Parse(callbackURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.ContainsAny(callbackURL, "'\n") {
+			return fmt.Errorf("%s must be an http(s) URL", readyCallbackURLEnv)
+		}
+		a.readyCallbackURL = callbackURL
+	}
+
+	return nil
+}
+
+// scheduleFromEnv reads the daily run times and the cleanup window, keeping
+// fallback's values for anything unset. The window must not wrap midnight, and
+// the cleanup time has to fall inside it, or every scheduled cleanup would be
+// skipped.
+func scheduleFromEnv(fallback dailySchedule) (dailySchedule, error) {
+	schedule := fallback
+	var err error
+	if schedule.cleanupAt, err = timeOfDayFromEnv(cleanupTimeEnv, fallback.cleanupAt); err != nil {
+		return dailySchedule{}, err
+	}
+	if schedule.provisionAt, err = timeOfDayFromEnv(provisionTimeEnv, fallback.provisionAt); err != nil {
+		return dailySchedule{}, err
+	}
+	if schedule.window.Start, err = timeOfDayFromEnv(cleanupWindowStartEnv, fallback.window.Start); err != nil {
+		return dailySchedule{}, err
+	}
+	if schedule.window.End, err = timeOfDayFromEnv(cleanupWindowEndEnv, fallback.window.End); err != nil {
+		return dailySchedule{}, err
+	}
+
+	window := schedule.window
+	if window.End.minutes() <= window.Start.minutes() {
+		return dailySchedule{}, fmt.Errorf("%s %s is not after %s %s", cleanupWindowEndEnv, window.End, cleanupWindowStartEnv, window.Start)
+	}
+	if at := schedule.cleanupAt; at.minutes() < window.Start.minutes() || at.minutes() >= window.End.minutes() {
+		return dailySchedule{}, fmt.Errorf("%s: %s is outside the cleanup window %s", cleanupTimeEnv, at, window)
+	}
+	return schedule, nil
+}
+
+// locationFromEnv loads the IANA time zone named by the environment variable,
+// or fallback when it is unset.
+func locationFromEnv(name, fallback string) (*time.Location, error) {
+	zone := strings.TrimSpace(os.Getenv(name))
+	if zone == "" {
+		zone = fallback
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unknown time zone %q (want an IANA name such as Asia/Seoul): %w", name, zone, err)
+	}
+	return loc, nil
+}
+
+func timeOfDayFromEnv(name string, fallback timeOfDay) (timeOfDay, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+	return parseTimeOfDay(name, raw)
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 30s or 5m: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+
+	return d, nil
+}
+
+func boolFromEnv(name string, fallback bool) (bool, error) {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv(name)))
+	switch raw {
+	case "":
+		return fallback, nil
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%s must be a boolean (true/false, yes/no, on/off, 1/0), got %q", name, raw)
+}
+
+// listFromEnv splits a comma-separated variable, dropping empty entries.
+func listFromEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// validUnixUser reports whether name is safe to create with useradd and to
+// splice into sshd_config and the cloud-config: a lowercase letter or
+// underscore, then up to 31 lowercase letters, digits, underscores or dashes.
+func validUnixUser(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for i, ch := range name {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch == '_':
+		case i > 0 && (ch >= '0' && ch <= '9' || ch == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// prefixesFromEnv parses a comma-separated list of CIDRs such as
+// "203.0.113.0/24,2001:db8::/32".
+func prefixesFromEnv(name string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range listFromEnv(name) {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s entry %q must be a CIDR: %w", name, entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// vultrTimeoutsFromEnv parses a comma-separated list of op=duration pairs,
+// e.g. "list=5s,create=90s". Operations must be ones defaultVultrTimeouts
+// knows about.
+func vultrTimeoutsFromEnv(name string) (map[string]time.Duration, error) {
+	entries := listFromEnv(name)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	timeouts := make(map[string]time.Duration, len(entries))
+	for _, entry := range entries {
+		op, raw, ok := strings.Cut(entry, "=")
+		op = strings.ToLower(strings.TrimSpace(op))
+		if !ok {
+			return nil, fmt.Errorf("%s entry %q must be op=duration", name, entry)
+		}
+		if _, known := defaultVultrTimeouts[op]; !known {
+			return nil, fmt.Errorf("%s has unknown operation %q", name, op)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s %s must be a duration: %w", name, op, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%s %s must be positive", name, op)
+		}
+		timeouts[op] = d
+	}
+	return timeouts, nil
+}
+
+func intFromEnv(name string, fallback int) (int, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", name, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+
+	return n, nil
+}
+
+func floatFromEnv(name string, fallback float64) (float64, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s must be a number, got %q", name, raw)
+	}
+
+	return f, nil
+}
+
+func backoffMultiplierFromEnv(name string, fallback float64) (float64, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+
+	multiplier, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", name, err)
+	}
+	if !(multiplier > 1) || math.IsInf(multiplier, 0) {
+		return 0, fmt.Errorf("%s must be greater than 1, got %s", name, raw)
 	}
 
-	return token, nil
+	return multiplier, nil
 }
@@ -28,6 +28,8 @@ const rootHTML = `<!doctype html>
       <dl>
         <dt>Status</dt>
         <dd id="instance-status">Loading...</dd>
+        <dt>Power</dt>
+        <dd id="instance-power">Loading...</dd>
         <dt>Label</dt>
         <dd id="instance-label">Loading...</dd>
         <dt>SSH</dt>
@@ -55,32 +57,15 @@ const rootHTML = `<!doctype html>
 
   <script>
     (function () {
-      var ddayEl = document.getElementById('dday');
-      var target = new Date('2026-02-26T00:00:00');
-
-      function renderDday() {
-        var now = new Date();
-        var diffMs = target.getTime() - now.getTime();
-        if (isNaN(diffMs)) {
-          ddayEl.textContent = 'Invalid date';
-          return;
-        }
-
-        if (diffMs <= 0) {
-          ddayEl.textContent = 'D-Day';
-          return;
-        }
-
-        var days = Math.ceil(diffMs / 86400000);
-        ddayEl.textContent = 'D-' + days;
+      function renderDday(data) {
+        var el = document.getElementById('dday');
+        el.textContent = data && data.label ? data.label : 'Unavailable';
       }
 
-      renderDday();
-
       function renderCharges(data) {
         var el = document.getElementById('pending-charges');
         if (data && typeof data.pending_charges === 'number') {
-          el.textContent = data.pending_charges.toFixed(2);
+          el.textContent = data.pending_charges.toFixed(2) + (data.charges_stale ? ' (stale)' : '');
         } else {
           el.textContent = 'Unavailable';
         }
@@ -88,9 +73,12 @@ const rootHTML = `<!doctype html>
 
       function renderInstance(data) {
         var statusEl = document.getElementById('instance-status');
+        var powerEl = document.getElementById('instance-power');
         var labelEl = document.getElementById('instance-label');
         var sshEl = document.getElementById('instance-ssh');
 
+        powerEl.textContent = data && data.power_status ? data.power_status : 'Unavailable';
+
         if (!data || !data.status || !data.ip) {
           statusEl.textContent = 'Unavailable';
           labelEl.textContent = data && data.label ? data.label : 'Unavailable';
@@ -100,18 +88,24 @@ const rootHTML = `<!doctype html>
 
         statusEl.textContent = data.status;
         labelEl.textContent = data.label || 'Unavailable';
-        sshEl.textContent = 'ssh -p 443 linuxuser@' + data.ip;
+        sshEl.textContent = 'ssh -p ' + (data.ssh_port || 443) + ' ' + (data.ssh_user || 'linuxuser') + '@' + data.ip;
       }
 
-      fetch('/api/charges')
+      fetch('/api/dday')
         .then(function (resp) { return resp.ok ? resp.json() : Promise.reject(resp); })
-        .then(renderCharges)
-        .catch(function () { renderCharges(null); });
+        .then(renderDday)
+        .catch(function () { renderDday(null); });
 
-      fetch('/api/instance')
+      fetch('/api/status')
         .then(function (resp) { return resp.ok ? resp.json() : Promise.reject(resp); })
-        .then(renderInstance)
-        .catch(function () { renderInstance(null); });
+        .then(function (data) {
+          renderCharges(data);
+          renderInstance(data.instance);
+        })
+        .catch(function () {
+          renderCharges(null);
+          renderInstance(null);
+        });
     })();
   </script>
 </body>
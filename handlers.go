@@ -2,27 +2,74 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 )
 
+func (a *app) routes() *http.ServeMux {
+	// Handlers that call Vultr share one concurrency limit.
+	vultrLimited := a.vultrCallLimiter()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", a.handleRoot)
+	mux.HandleFunc("GET /static/sjb.tar.gz", a.handleSjbTar)
+	mux.HandleFunc("GET /healthz", a.handleHealthz)
+	mux.HandleFunc("GET /readyz", a.handleReadyz)
+	mux.HandleFunc("GET /metrics", a.handleMetrics)
+	mux.HandleFunc("GET /api/charges", vultrLimited(a.handleCharges))
+	mux.HandleFunc("GET /api/cloud-config", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", a.handleCloudConfig)))
+	mux.HandleFunc("GET /api/config", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", a.handleConfig)))
+	mux.HandleFunc("GET /api/dday", a.handleDDay)
+	mux.HandleFunc("GET /api/history", a.handleHistory)
+	mux.HandleFunc("GET /api/instance", vultrLimited(a.handleInstance))
+	mux.HandleFunc("GET /api/instance/raw", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", vultrLimited(a.handleInstanceRaw))))
+	mux.HandleFunc("GET /api/instances/foreign", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", vultrLimited(a.handleForeignInstances))))
+	mux.HandleFunc("GET /api/logs", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", a.handleLogs)))
+	mux.HandleFunc("POST /api/instance/power", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", vultrLimited(a.refuseWhenReadOnly(a.handleInstancePower)))))
+	mux.HandleFunc("POST /api/provision", a.restrictToAdminCIDRs(a.withBearer("daemon-admin", a.refuseWhenReadOnly(a.handleProvision))))
+	mux.HandleFunc("POST /api/instance/ready", a.handleInstanceReady)
+	mux.HandleFunc("GET /api/reconcile/status", vultrLimited(a.handleReconcileStatus))
+	mux.HandleFunc("GET /api/runs", a.handleRuns)
+	mux.HandleFunc("GET /api/status", vultrLimited(a.handleStatus))
+	mux.HandleFunc("POST /api/shutdown", a.restrictToAdminCIDRs(a.withBearer("daemon-shutdown", a.handleShutdown)))
+	mux.HandleFunc("GET /api/window/next", a.handleNextWindow)
+	return mux
+}
+
 func (a *app) handleCharges(w http.ResponseWriter, r *http.Request) {
-	charges, err := a.vultr.pendingCharges(r.Context())
+	charges, err := a.fetchCharges(r.Context())
 	if err != nil {
 		a.logger.Error("failed to fetch pending charges", "error", err)
+		if cached, sample, ok := a.charges.load(); ok {
+			w.Header().Set("Warning", `110 - "Response is Stale"`)
+			writeJSON(w, http.StatusOK, map[string]any{
+				"pending_charges": cached,
+				"stale":           true,
+				"age_seconds":     a.clock().Now().Sub(sample).Seconds(),
+			})
+			return
+		}
 		writeJSON(w, http.StatusBadGateway, map[string]string{
 			"error": "failed to fetch pending charges from Vultr",
 		})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]float64{
+	writeJSON(w, http.StatusOK, map[string]any{
 		"pending_charges": charges,
+		"stale":           false,
 	})
 }
 
 func (a *app) handleInstance(w http.ResponseWriter, r *http.Request) {
-	instance, err := a.vultr.firstInstanceWithLabelPrefix(r.Context(), labelPrefix)
+	matches, err := a.vultr.instancesWithLabelPrefix(r.Context(), labelPrefix)
+	var instance *vultrInstance
+	if err == nil {
+		instance, err = bestInstance(matches)
+	}
 	if err != nil {
 		if errors.Is(err, errInstanceNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{
@@ -38,22 +85,191 @@ func (a *app) handleInstance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{
-		"status": instance.Status,
-		"ip":     instance.MainIP,
-		"label":  instance.Label,
+	payload := map[string]any{
+		"status":       instance.Status,
+		"power_status": instance.PowerStatus,
+		"ip":           instance.MainIP,
+		"label":        instance.Label,
+		"ssh_port":     a.sshListenPort(),
+		"ssh_user":     a.sshUser(),
+	}
+	if report, ok := a.ready.lastFor(instance.Label); ok {
+		payload["ready"] = report
+	}
+	if len(matches) > 1 {
+		// Surface duplicates so the operator notices a dedup problem.
+		payload["duplicate_count"] = len(matches)
+		a.logger.Warn("multiple instances match label prefix",
+			"prefix", labelPrefix,
+			"count", len(matches),
+			"selected_instance_id", instance.ID,
+		)
+	}
+
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// handleInstanceRaw returns Vultr's unmodified record for the current instance.
+func (a *app) handleInstanceRaw(w http.ResponseWriter, r *http.Request) {
+	matches, err := a.vultr.instancesWithLabelPrefix(r.Context(), labelPrefix)
+	var instance *vultrInstance
+	if err == nil {
+		instance, err = bestInstance(matches)
+	}
+	var raw map[string]any
+	if err == nil {
+		raw, err = a.vultr.getInstanceRaw(r.Context(), instance.ID)
+	}
+	if err != nil {
+		if errors.Is(err, errInstanceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{
+				"error": "no instance found with label prefix paropal-",
+			})
+			return
+		}
+
+		a.logger.Error("failed to fetch raw instance", "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error": "failed to fetch instance from Vultr",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"instance": raw,
 	})
 }
 
-func (a *app) handleShutdown(w http.ResponseWriter, r *http.Request) {
-	if !authorizedBearerToken(r.Header.Get("Authorization"), a.shutdownToken) {
-		w.Header().Set("WWW-Authenticate", `Bearer realm="daemon-shutdown"`)
-		writeJSON(w, http.StatusUnauthorized, map[string]string{
-			"error": "unauthorized",
+// handleForeignInstances lists instances that do not carry the paropal label
+// prefix, so operators can see what else shares the account.
+func (a *app) handleForeignInstances(w http.ResponseWriter, r *http.Request) {
+	instances, err := a.vultr.listAllInstances(r.Context())
+	if err != nil {
+		a.logger.Error("failed to list instances", "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error": "failed to fetch instances from Vultr",
+		})
+		return
+	}
+
+	foreign := make([]instanceSummary, 0, len(instances))
+	for _, instance := range instances {
+		if strings.HasPrefix(instance.Label, labelPrefix) {
+			continue
+		}
+		foreign = append(foreign, summarizeInstance(instance))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"instances": foreign,
+	})
+}
+
+// handleInstancePower starts, halts or reboots the current paropal instance
+// without destroying it.
+func (a *app) handleInstancePower(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "request body must be JSON with an action",
+		})
+		return
+	}
+
+	actions := map[string]func(context.Context, string) error{
+		"start":  a.vultr.startInstance,
+		"halt":   a.vultr.haltInstance,
+		"reboot": a.vultr.rebootInstance,
+	}
+	action, ok := actions[request.Action]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "action must be one of start, halt, reboot",
+		})
+		return
+	}
+
+	matches, err := a.vultr.instancesWithLabelPrefix(r.Context(), labelPrefix)
+	var instance *vultrInstance
+	if err == nil {
+		instance, err = bestInstance(matches)
+	}
+	if err == nil {
+		err = action(r.Context(), instance.ID)
+	}
+	if err != nil {
+		if errors.Is(err, errInstanceNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{
+				"error": "no instance found with label prefix paropal-",
+			})
+			return
+		}
+
+		a.logger.Error("failed to change instance power state", "action", request.Action, "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error": "failed to " + request.Action + " instance on Vultr",
 		})
 		return
 	}
 
+	a.logger.Warn("instance power action requested", "action", request.Action, "instance_id", instance.ID, "label", instance.Label)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status":      "requested",
+		"action":      request.Action,
+		"instance_id": instance.ID,
+	})
+}
+
+// handleProvision starts one provision reconcile in the background, the same
+// one the configured provision schedule runs. Only one provision may be in
+// flight.
+func (a *app) handleProvision(w http.ResponseWriter, r *http.Request) {
+	if !a.provisionInFlight.CompareAndSwap(false, true) {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error": "a provision run is already in progress",
+		})
+		return
+	}
+	if !a.runs.begin() {
+		a.provisionInFlight.Store(false)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"error": "shutdown in progress",
+		})
+		return
+	}
+
+	ctx := a.backgroundCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := a.clock().Now()
+	a.logger.Warn("starting manual instance provision run", "started_kst", now.In(a.cleanupLoc).Format(time.RFC3339))
+	a.scheduler.startRun("provision", now, now)
+	go func() {
+		defer a.runs.end()
+		defer a.provisionInFlight.Store(false)
+		err := a.reconcileEnsureParopalInstance(ctx)
+		a.completeRun(ctx, "provision", &a.provisionFailures, err)
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status": "provision started",
+	})
+}
+
+func summarizeInstance(instance vultrInstance) instanceSummary {
+	return instanceSummary{
+		ID:          instance.ID,
+		Status:      instance.Status,
+		PowerStatus: instance.PowerStatus,
+		IP:          instance.MainIP,
+		Label:       instance.Label,
+	}
+}
+
+func (a *app) handleShutdown(w http.ResponseWriter, r *http.Request) {
 	if a.server == nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{
 			"error": "server is not initialized",
@@ -65,18 +281,9 @@ func (a *app) handleShutdown(w http.ResponseWriter, r *http.Request) {
 		"status": "shutting down",
 	})
 
-	go func() {
-		if a.stopBackground != nil {
-			a.stopBackground()
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-		defer cancel()
-
-		if err := a.server.Shutdown(ctx); err != nil {
-			a.logger.Error("graceful shutdown failed", "error", err)
-		} else {
-			a.logger.Info("graceful shutdown complete")
-		}
-	}()
+	if a.requestShutdown != nil {
+		a.requestShutdown(errShutdownRequested)
+		return
+	}
+	go a.shutdown(shutdownTimeout)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// healthStatus reports liveness along with how stale the daemon's view of
+// Vultr is, so monitoring can catch silent upstream connectivity loss.
+type healthStatus struct {
+	Status                     string   `json:"status"`
+	LastVultrSuccess           *string  `json:"last_vultr_success"`
+	LastVultrSuccessAgeSeconds *float64 `json:"last_vultr_success_age_seconds"`
+}
+
+func (a *app) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	status := healthStatus{Status: "ok"}
+
+	if last := a.vultr.lastSuccessAt(); !last.IsZero() {
+		at := last.UTC().Format(time.RFC3339)
+		age := time.Since(last).Seconds()
+		status.LastVultrSuccess = &at
+		status.LastVultrSuccessAgeSeconds = &age
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleReadyz reports whether the daemon can reach Vultr. Any successful
+// Vultr response within readyCacheTTL counts, so frequent probes do not each
+// hit the API; otherwise it probes /account with a short timeout. Once
+// shutdown starts it reports draining so load balancers move away.
+func (a *app) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if a.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+	if last := a.vultr.lastSuccessAt(); !last.IsZero() && time.Since(last) < readyCacheTTL {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyProbeTimeout)
+	defer cancel()
+	if _, err := a.vultr.pendingCharges(ctx); err != nil {
+		a.logger.Warn("readiness probe failed", "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": "unavailable",
+			"error":  "vultr api is unreachable",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// runHistory keeps the most recent finished runs, oldest first. With a path
+// set they are loaded at startup and rewritten after every run, so the
+// history survives restarts. The zero value keeps history in memory only.
+type runHistory struct {
+	mu      sync.Mutex
+	path    string
+	records []runRecord
+}
+
+// load reads the history previously saved at path and persists to it from
+// then on. A missing file starts an empty history. An unreadable one does
+// too, and the error is returned so the caller can report it; the next run
+// overwrites the file.
+func (h *runHistory) load(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.path = path
+	h.records = nil
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read state file: %w", err)
+	}
+	var records []runRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("decode state file: %w", err)
+	}
+	h.records = trimHistory(records)
+	return nil
+}
+
+// add appends record, dropping the oldest beyond runHistoryLimit, and saves
+// the history if a path is set.
+func (h *runHistory) add(record runRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = trimHistory(append(h.records, record))
+	if h.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(h.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode run history: %w", err)
+	}
+	if err := writeFileAtomic(h.path, data); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+	return nil
+}
+
+// recent returns up to limit records, newest first. A limit of 0 returns
+// them all.
+func (h *runHistory) recent(limit int) []runRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := len(h.records)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	out := make([]runRecord, 0, n)
+	for i := len(h.records) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, h.records[i])
+	}
+	return out
+}
+
+func trimHistory(records []runRecord) []runRecord {
+	if len(records) > runHistoryLimit {
+		records = records[len(records)-runHistoryLimit:]
+	}
+	return records
+}
+
+// recordHistory adds a finished run to the history, logging rather than
+// failing the caller when it cannot be persisted.
+func (a *app) recordHistory(record runRecord) {
+	if err := a.history.add(record); err != nil {
+		a.logger.Error("failed to persist run history", "error", err)
+	}
+}
+
+// handleHistory returns the most recent finished runs, newest first. The
+// optional limit query parameter caps how many are returned.
+func (a *app) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"runs": a.history.recent(limit),
+	})
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func authorizedBearerToken(authHeader, expectedToken string) bool {
@@ -13,14 +17,124 @@ func authorizedBearerToken(authHeader, expectedToken string) bool {
 		return false
 	}
 
-	presentedToken := parts[1]
-	if len(presentedToken) != len(expectedToken) {
+	return tokenMatches(parts[1], expectedToken)
+}
+
+// authorizedAgainstAny is authorizedBearerToken for a set of accepted
+// tokens, so a new token can be rolled out before the old one is removed.
+// Every token is checked, without stopping at the first match.
+func authorizedAgainstAny(authHeader string, expectedTokens []string) bool {
+	matched := false
+	for _, expected := range expectedTokens {
+		if authorizedBearerToken(authHeader, expected) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// tokenMatchesAny compares the presented token with every expected one in
+// constant time, without stopping at the first match.
+func tokenMatchesAny(presentedToken string, expectedTokens []string) bool {
+	matched := false
+	for _, expected := range expectedTokens {
+		if tokenMatches(presentedToken, expected) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// tokenMatches compares a presented token with the expected one in constant
+// time.
+func tokenMatches(presentedToken, expectedToken string) bool {
+	if presentedToken == "" || len(presentedToken) != len(expectedToken) {
 		return false
 	}
 
 	return subtle.ConstantTimeCompare([]byte(presentedToken), []byte(expectedToken)) == 1
 }
 
+// requireBearer checks the request against the shutdown tokens and writes a 401
+// challenge for realm when it does not match. With authHeader set, the raw
+// token is also accepted in that header for gateways that rewrite
+// Authorization.
+func (a *app) requireBearer(w http.ResponseWriter, r *http.Request, realm string) bool {
+	if authorizedAgainstAny(r.Header.Get("Authorization"), a.shutdownTokens) {
+		return true
+	}
+	if a.authHeader != "" && tokenMatchesAny(strings.TrimSpace(r.Header.Get(a.authHeader)), a.shutdownTokens) {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+	writeJSON(w, http.StatusUnauthorized, map[string]string{
+		"error": "unauthorized",
+	})
+	return false
+}
+
+// withBearer wraps an authenticated handler so requireBearer runs before it.
+// It sits outside the read-only and Vultr-limiter wrappers, so an
+// unauthenticated caller gets 401 without learning the read-only state or
+// taking a limiter slot.
+func (a *app) withBearer(realm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.requireBearer(w, r, realm) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// vultrCallLimiter returns a wrapper that caps how many requests may be
+// inside Vultr-backed handlers at once. Requests over the limit wait up to
+// dashboardQueueTimeout for a slot and otherwise get a 503. With no limit
+// configured the wrapper is a no-op.
+func (a *app) vultrCallLimiter() func(http.HandlerFunc) http.HandlerFunc {
+	if a.dashboardMaxConcurrent <= 0 {
+		return func(h http.HandlerFunc) http.HandlerFunc { return h }
+	}
+
+	slots := make(chan struct{}, a.dashboardMaxConcurrent)
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !acquireSlot(r.Context(), slots, a.dashboardQueueTimeout) {
+				a.logger.Warn("shedding dashboard request: too many concurrent vultr calls", "path", r.URL.Path)
+				w.Header().Set("Retry-After", "1")
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+					"error": "too many concurrent requests",
+				})
+				return
+			}
+			defer func() { <-slots }()
+			h(w, r)
+		}
+	}
+}
+
+func acquireSlot(ctx context.Context, slots chan struct{}, wait time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -29,3 +143,83 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// restrictToAdminCIDRs wraps an authenticated handler so it answers 403 to
+// clients outside the configured admin CIDRs. The check runs before the
+// bearer token is looked at, so rejected clients learn nothing about it.
+func (a *app) restrictToAdminCIDRs(next http.HandlerFunc) http.HandlerFunc {
+	if len(a.adminCIDRs) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := a.clientAddr(r)
+		if !ok || !addrInPrefixes(addr, a.adminCIDRs) {
+			a.logger.Warn("refusing request from outside admin CIDRs", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "forwarded_for", r.Header.Get("X-Forwarded-For"))
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": "forbidden",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// clientAddr returns the address the request came from. Behind a trusted
+// proxy that is the last X-Forwarded-For entry, the one the proxy appended
+// itself; earlier entries are client-supplied and never trusted.
+func (a *app) clientAddr(r *http.Request) (netip.Addr, bool) {
+	if a.trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[len(hops)-1]))
+			return addr.Unmap(), err == nil
+		}
+	}
+
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
+
+func addrInPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseWhileDraining answers every /api/ request with 503 and a Retry-After
+// once shutdown has started, so clients back off until the restarted daemon
+// is up instead of racing the drain. Pages and probes are still served.
+func (a *app) refuseWhileDraining(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(shutdownTimeout.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.draining.Load() && strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Retry-After", retryAfter)
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+				"error": "daemon is shutting down",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refuseWhenReadOnly wraps a handler that changes Vultr state so it answers
+// 423 Locked while read-only mode is on.
+func (a *app) refuseWhenReadOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.readOnly {
+			a.logger.Warn("refusing mutating request in read-only mode", "method", r.Method, "path", r.URL.Path)
+			writeJSON(w, http.StatusLocked, map[string]string{
+				"error": "daemon is in read-only mode",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
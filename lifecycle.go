@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errShutdownRequested is the cause serve's context is cancelled with when
+// POST /api/shutdown asks the daemon to stop.
+var errShutdownRequested = errors.New("shutdown requested over HTTP")
+
+// serve starts the background schedulers and serves HTTP on listener until the
+// server is shut down, either through POST /api/shutdown or by ctx ending
+// (SIGINT/SIGTERM in main). Either way the shutdown runs to completion
+// before serve returns. The readiness file, when configured, exists only
+// while the daemon is serving.
+func (a *app) serve(ctx, backgroundCtx context.Context, listener net.Listener) error {
+	ctx, requestShutdown := context.WithCancelCause(ctx)
+	defer requestShutdown(nil)
+	a.requestShutdown = requestShutdown
+
+	go a.runDailyCleanup(backgroundCtx)
+	go a.runDailyProvision(backgroundCtx)
+	go a.runAgePrune(backgroundCtx)
+	go a.runWarmup(backgroundCtx)
+
+	if err := writeReadyFile(a.readyFile); err != nil {
+		a.logger.Error("failed to write readiness file", "path", a.readyFile, "error", err)
+	} else if a.readyFile != "" {
+		a.logger.Info("readiness file written", "path", a.readyFile)
+	}
+
+	served := make(chan struct{})
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		select {
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), errShutdownRequested) {
+				a.logger.Warn("shutdown requested over HTTP; shutting down")
+			} else {
+				a.logger.Warn("shutdown signal received; shutting down")
+			}
+			a.shutdown(shutdownTimeout)
+		case <-served:
+		}
+	}()
+
+	err := a.server.Serve(listener)
+	close(served)
+	<-shutdownDone
+	if a.stopBackground != nil {
+		a.stopBackground()
+	}
+	removeReadyFile(a.readyFile)
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// parseListenAddr splits a listen address into a network and address for
+// net.Listen. "unix:/path/to.sock" selects a Unix domain socket; anything
+// else is a TCP host:port such as ":8080" or "127.0.0.1:8080".
+func parseListenAddr(addr string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return "", "", fmt.Errorf("listen address %q has no socket path", addr)
+		}
+		return "unix", path, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", fmt.Errorf("listen address %q: %w", addr, err)
+	}
+	return "tcp", addr, nil
+}
+
+// listen opens the listener for addr. A Unix socket left behind by a daemon
+// that did not shut down cleanly is removed first, but one that still
+// accepts connections is left alone and reported as in use. The socket file
+// is removed again when the listener closes at shutdown.
+func listen(addr string) (net.Listener, error) {
+	network, address, err := parseListenAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// shutdown stops background work and then the HTTP server. With
+// shutdownDrain set, an in-flight scheduled reconcile is first given up to
+// timeout to finish before its context is cancelled. The HTTP server then
+// gets its own timeout, so a drain that uses its whole budget does not
+// force connections closed; those still open when it expires are closed
+// forcibly.
+func (a *app) shutdown(timeout time.Duration) {
+	a.draining.Store(true)
+
+	if a.shutdownDrain {
+		drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		drained := a.runs.drain(drainCtx)
+		cancel()
+		if drained {
+			a.logger.Info("in-flight reconcile drained before shutdown")
+		} else {
+			a.logger.Warn("shutdown timeout reached while draining reconcile; cancelling it")
+		}
+	}
+
+	if a.stopBackground != nil {
+		a.stopBackground()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		// Connections that outlive the timeout (a slow download, a stuck client)
+		// would otherwise keep the process up; close them outright.
+		a.logger.Warn("graceful shutdown failed; forcing server close", "error", err, "timeout", timeout.String())
+		if err := a.server.Close(); err != nil {
+			a.logger.Error("forced server close failed", "error", err)
+		} else {
+			a.logger.Info("server closed after forced shutdown")
+		}
+		return
+	}
+	a.logger.Info("graceful shutdown complete")
+}
+
+// reconcileRuns tracks in-flight scheduled reconciles so shutdown can wait
+// for them. Once draining starts no new run may begin.
+type reconcileRuns struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+}
+
+// begin registers a run, reporting false if shutdown is already draining.
+func (r *reconcileRuns) begin() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		return false
+	}
+	r.wg.Add(1)
+	return true
+}
+
+func (r *reconcileRuns) end() {
+	r.wg.Done()
+}
+
+// drain blocks new runs and waits for active ones, reporting whether they
+// all finished before ctx was done.
+func (r *reconcileRuns) drain(ctx context.Context) bool {
+	r.mu.Lock()
+	r.draining = true
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func writeReadyFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0o644); err != nil {
+		return fmt.Errorf("write readiness file: %w", err)
+	}
+	return nil
+}
+
+func removeReadyFile(path string) {
+	if path == "" {
+		return
+	}
+	os.Remove(path)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logEntry is one log record as served by GET /api/logs.
+type logEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// logRing keeps the most recent log records in memory, overwriting the oldest
+// once it holds size entries.
+type logRing struct {
+	mu      sync.Mutex
+	entries []logEntry
+	next    int
+	full    bool
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{entries: make([]logEntry, size)}
+}
+
+func (r *logRing) add(entry logEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// recent returns up to limit entries, newest first. A limit of zero or less
+// returns everything buffered.
+func (r *logRing) recent(limit int) []logEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	out := make([]logEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return out
+}
+
+// logRingHandler is the slog.Handler that records into a logRing. Attributes
+// inside groups are flattened to dotted keys.
+type logRingHandler struct {
+	ring   *logRing
+	level  slog.Leveler
+	attrs  map[string]any
+	prefix string
+}
+
+func (h *logRingHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logRingHandler) Handle(_ context.Context, record slog.Record) error {
+	attrs := make(map[string]any, len(h.attrs)+record.NumAttrs())
+	for k, v := range h.attrs {
+		attrs[k] = v
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addLogAttr(attrs, h.prefix, attr)
+		return true
+	})
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+
+	h.ring.add(logEntry{
+		Time:    record.Time,
+		Level:   record.Level.String(),
+		Message: record.Message,
+		Attrs:   attrs,
+	})
+	return nil
+}
+
+func (h *logRingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = make(map[string]any, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		next.attrs[k] = v
+	}
+	for _, attr := range attrs {
+		addLogAttr(next.attrs, h.prefix, attr)
+	}
+	return &next
+}
+
+func (h *logRingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.prefix = h.prefix + name + "."
+	return &next
+}
+
+// addLogAttr stores attr under prefix in attrs, in a form that encodes to
+// readable JSON: errors, durations and other Stringers become strings.
+func addLogAttr(attrs map[string]any, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			addLogAttr(attrs, groupPrefix, member)
+		}
+		return
+	case slog.KindDuration:
+		attrs[prefix+attr.Key] = attr.Value.Duration().String()
+		return
+	case slog.KindAny:
+		switch v := attr.Value.Any().(type) {
+		case error:
+			attrs[prefix+attr.Key] = v.Error()
+			return
+		case fmt.Stringer:
+			attrs[prefix+attr.Key] = v.String()
+			return
+		}
+	}
+	attrs[prefix+attr.Key] = attr.Value.Any()
+}
+
+// teeHandler sends every record to each of its handlers that is enabled for
+// the record's level.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := make(teeHandler, len(t))
+	for i, h := range t {
+		next[i] = h.WithAttrs(attrs)
+	}
+	return next
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	next := make(teeHandler, len(t))
+	for i, h := range t {
+		next[i] = h.WithGroup(name)
+	}
+	return next
+}
+
+// withLogBuffer returns a logger that writes to logger's handler and also
+// records into ring at info level and above.
+func withLogBuffer(logger *slog.Logger, ring *logRing) *slog.Logger {
+	return slog.New(teeHandler{
+		logger.Handler(),
+		&logRingHandler{ring: ring, level: slog.LevelInfo},
+	})
+}
+
+// handleLogs returns the most recent buffered log records, newest first. The
+// optional limit query parameter caps how many are returned.
+func (a *app) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if a.logs == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error": "log buffer is disabled; set " + logBufferSizeEnv,
+		})
+		return
+	}
+
+	limit := 0
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"logs": a.logs.recent(limit),
+	})
+}
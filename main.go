@@ -2,78 +2,174 @@ package main
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	if len(os.Args) > 1 && os.Args[1] == "schedule" {
+		if err := runScheduleCommand(os.Args[2:], os.Stdout, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	logger, err := loggerFromEnv(os.Stdout)
+	if err != nil {
+		slog.New(slog.NewTextHandler(os.Stderr, nil)).Error("failed to initialize logger", "error", err)
+		os.Exit(1)
+	}
 
 	client, err := newVultrClientFromEnv()
 	if err != nil {
 		logger.Error("failed to initialize vultr client", "error", err)
 		os.Exit(1)
 	}
+	client.logger = logger
 
-	shutdownToken, err := shutdownTokenFromEnv()
+	shutdownTokens, err := shutdownTokenFromEnv()
 	if err != nil {
 		logger.Error("failed to initialize shutdown auth", "error", err)
 		os.Exit(1)
 	}
 
-	cleanupLoc, err := time.LoadLocation(cleanupTimeZone)
+	cleanupLoc, err := locationFromEnv(timeZoneEnv, cleanupTimeZone)
 	if err != nil {
-		logger.Error("failed to load cleanup timezone", "timezone", cleanupTimeZone, "error", err)
+		logger.Error("failed to load cleanup timezone", "error", err)
 		os.Exit(1)
 	}
 
-	labelLoc, err := time.LoadLocation(labelTimeZone)
+	labelLoc, err := locationFromEnv(labelTimeZoneEnv, labelTimeZone)
 	if err != nil {
-		logger.Error("failed to load label timezone", "timezone", labelTimeZone, "error", err)
+		logger.Error("failed to load label timezone", "error", err)
 		os.Exit(1)
 	}
 
 	backgroundCtx, stopBackground := context.WithCancel(context.Background())
 
 	a := &app{
-		vultr:                     client,
-		logger:                    logger,
-		shutdownToken:             shutdownToken,
-		stopBackground:            stopBackground,
-		cleanupLoc:                cleanupLoc,
-		labelLoc:                  labelLoc,
-		cleanupSettleDelay:        defaultCleanupSettleDelay,
-		cleanupBackoffMin:         defaultCleanupBackoffMin,
-		cleanupBackoffMax:         defaultCleanupBackoffMax,
-		cleanupPassDeleteInterval: defaultCleanupPassDeleteInterval,
-		provisionBackoffMin:       defaultProvisionBackoffMin,
-		provisionBackoffMax:       defaultProvisionBackoffMax,
-	}
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /", a.handleRoot)
-	mux.HandleFunc("GET /static/sjb.tar.gz", a.handleSjbTar)
-	mux.HandleFunc("GET /api/charges", a.handleCharges)
-	mux.HandleFunc("GET /api/instance", a.handleInstance)
-	mux.HandleFunc("POST /api/shutdown", a.handleShutdown)
+		vultr:                       client,
+		logger:                      logger,
+		shutdownTokens:              shutdownTokens,
+		backgroundCtx:               backgroundCtx,
+		stopBackground:              stopBackground,
+		schedule:                    defaultSchedule,
+		cleanupLoc:                  cleanupLoc,
+		labelLoc:                    labelLoc,
+		labelTimeFormat:             defaultLabelTimeFormat,
+		maintenanceBackoffMin:       defaultMaintenanceBackoffMin,
+		maintenanceBackoffMax:       defaultMaintenanceBackoffMax,
+		chargesRetries:              defaultChargesRetries,
+		chargesRetryDelay:           defaultChargesRetryDelay,
+		chargesCacheTTL:             defaultChargesCacheTTL,
+		ddayTarget:                  defaultDDayTarget,
+		cleanupSettleDelay:          defaultCleanupSettleDelay,
+		cleanupBackoffMin:           defaultCleanupBackoffMin,
+		cleanupBackoffMax:           defaultCleanupBackoffMax,
+		cleanupPassDeleteInterval:   defaultCleanupPassDeleteInterval,
+		cleanupSnapshotDelay:        defaultCleanupSnapshotDelay,
+		cleanupMinWindowRemaining:   defaultCleanupMinWindowRemaining,
+		cleanupRequireDestroyAllAck: true,
+		accountMaxInstances:         defaultAccountMaxInstances,
+		cleanupBackoffMultiplier:    defaultBackoffMultiplier,
+		cleanupVerifyInterval:       defaultCleanupVerifyInterval,
+		cleanupVerifyIntervalMax:    defaultCleanupVerifyIntervalMax,
+		provisionBackoffMin:         defaultProvisionBackoffMin,
+		provisionBackoffMax:         defaultProvisionBackoffMax,
+		provisionAttachBackoffMin:   defaultProvisionAttachBackoffMin,
+		provisionAttachBackoffMax:   defaultProvisionAttachBackoffMax,
+		provisionBackoffMultiplier:  defaultBackoffMultiplier,
+		provisionActiveTimeout:      defaultProvisionActiveTimeout,
+		provisionActivePollInterval: defaultProvisionActivePollInterval,
+		attachVerifyTimeout:         defaultAttachVerifyTimeout,
+		alertAfterFailedRuns:        defaultAlertAfterFailedRuns,
+		provisionFailoverAfter:      defaultProvisionFailoverAfter,
+	}
+
+	if err := applyEnvOverrides(a); err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if a.logBufferSize > 0 {
+		a.logs = newLogRing(a.logBufferSize)
+		logger = withLogBuffer(logger, a.logs)
+		a.logger = logger
+		client.logger = logger
+		if a.secondaryVultr != nil {
+			a.secondaryVultr.logger = logger
+		}
+	}
+
+	a.vultr.requestDurations = a.metrics.collectors().vultrRequests
+	if a.secondaryVultr != nil {
+		a.secondaryVultr.requestDurations = a.metrics.collectors().vultrRequests
+	}
+	a.scheduler.drift = a.metrics.collectors().schedulerDrift
+
+	if a.cleanupAllInstances && a.cleanupRequireDestroyAllAck {
+		logger.Warn("account-wide cleanup is not acknowledged; scheduled cleanups will be refused",
+			"acknowledge_with", destroyAllAckEnv+"=yes",
+			"or_limit_with", cleanupScopeEnv+"=prefix",
+		)
+	}
 
+	countersFile := strings.TrimSpace(os.Getenv(countersFileEnv))
+	if err := a.counters.load(countersFile); err != nil {
+		logger.Error("failed to load lifetime counters", "path", countersFile, "error", err)
+		os.Exit(1)
+	}
+
+	stateFile := strings.TrimSpace(os.Getenv(stateFileEnv))
+	if err := a.history.load(stateFile); err != nil {
+		logger.Warn("ignoring unreadable run history; starting a new one", "path", stateFile, "error", err)
+	}
+
+	if a.snapshotCarryOver {
+		snapshotFile := strings.TrimSpace(os.Getenv(snapshotStateFileEnv))
+		if err := a.snapshots.load(snapshotFile); err != nil {
+			logger.Error("failed to load snapshot state", "path", snapshotFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	pidFile := strings.TrimSpace(os.Getenv(pidFileEnv))
+	releasePIDFile, err := acquirePIDFile(pidFile)
+	if err != nil {
+		logger.Error("failed to acquire pid file", "path", pidFile, "error", err)
+		os.Exit(1)
+	}
+
+	addr := listenAddr
+	if raw := strings.TrimSpace(os.Getenv(listenAddrEnv)); raw != "" {
+		addr = raw
+	}
 	server := &http.Server{
-		Addr:              listenAddr,
-		Handler:           mux,
+		Handler:           a.logRequests(a.refuseWhileDraining(a.routes())),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 	a.server = server
 
-	go a.runDailyCleanup(backgroundCtx)
-	go a.runDailyProvision(backgroundCtx)
+	listener, err := listen(addr)
+	if err != nil {
+		releasePIDFile()
+		logger.Error("failed to listen", "addr", addr, "error", err)
+		os.Exit(1)
+	}
 
-	logger.Info("starting daemon", "addr", listenAddr)
-	err = server.ListenAndServe()
-	stopBackground()
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+	logger.Info("starting daemon", "addr", addr)
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = a.serve(signalCtx, backgroundCtx, listener)
+	stopSignals()
+	releasePIDFile()
+	if err != nil {
 		logger.Error("server stopped with error", "error", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// daemonMetrics holds the process-lifetime metrics served at /metrics. The
+// zero value is ready to use: the collectors and their registry are created
+// on first use.
+type daemonMetrics struct {
+	once sync.Once
+	c    *metricCollectors
+}
+
+type metricCollectors struct {
+	registry          *prometheus.Registry
+	cleanupRuns       prometheus.Counter
+	instancesDeleted  prometheus.Counter
+	deleteFailures    prometheus.Counter
+	provisionRuns     prometheus.Counter
+	provisionFailures prometheus.Counter
+	// vultrRequests is labelled by operation (see vultrOperation).
+	vultrRequests *prometheus.HistogramVec
+	// schedulerDrift is labelled by run kind (cleanup, provision).
+	schedulerDrift *prometheus.GaugeVec
+}
+
+// collectors returns the metrics, registering them on the first call.
+func (m *daemonMetrics) collectors() *metricCollectors {
+	m.once.Do(func() {
+		c := &metricCollectors{
+			registry: prometheus.NewRegistry(),
+			cleanupRuns: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "paropal_cleanup_runs_total",
+				Help: "Completed cleanup runs.",
+			}),
+			instancesDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "paropal_instances_deleted_total",
+				Help: "Instances deleted by cleanup or age prune.",
+			}),
+			deleteFailures: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "paropal_delete_failures_total",
+				Help: "Cleanup delete calls that failed.",
+			}),
+			provisionRuns: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "paropal_provision_runs_total",
+				Help: "Completed provision runs.",
+			}),
+			provisionFailures: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "paropal_provision_failures_total",
+				Help: "Provision runs that ended in an error.",
+			}),
+			vultrRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "paropal_vultr_request_duration_seconds",
+				Help:    "Duration of Vultr API requests by operation.",
+				Buckets: prometheus.DefBuckets,
+			}, []string{"operation"}),
+			schedulerDrift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "paropal_scheduler_drift_seconds",
+				Help: "How late the most recent run of each kind started.",
+			}, []string{"kind"}),
+		}
+		c.registry.MustRegister(
+			c.cleanupRuns,
+			c.instancesDeleted,
+			c.deleteFailures,
+			c.provisionRuns,
+			c.provisionFailures,
+			c.vultrRequests,
+			c.schedulerDrift,
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		m.c = c
+	})
+	return m.c
+}
+
+// handleMetrics serves the registry in the Prometheus exposition format.
+func (a *app) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	registry := a.metrics.collectors().registry
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
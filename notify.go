@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// notifier posts JSON events to an operator-configured webhook.
+type notifier struct {
+	url        string
+	httpClient *http.Client
+}
+
+type notification struct {
+	Event   string         `json:"event"`
+	Message string         `json:"message"`
+	Time    time.Time      `json:"time"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+func (n *notifier) send(ctx context.Context, event notification) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// notify sends an event to the webhook if one is configured. Delivery failures
+// are logged and otherwise ignored.
+func (a *app) notify(ctx context.Context, event, message string, fields map[string]any) {
+	if a.notifier == nil {
+		return
+	}
+
+	// Deliver even if the run's context has just been cancelled.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout)
+	defer cancel()
+
+	err := a.notifier.send(sendCtx, notification{
+		Event:   event,
+		Message: message,
+		Time:    time.Now(),
+		Fields:  fields,
+	})
+	if err != nil {
+		a.logger.Error("failed to deliver notification", "event", event, "error", err)
+	}
+}
+
+// notifyInstance sends a per-instance event. In per-run mode these are folded
+// into the end-of-run summary instead.
+func (a *app) notifyInstance(ctx context.Context, event, message string, fields map[string]any) {
+	if a.notifyMode == notifyModeRun {
+		return
+	}
+	a.notify(ctx, event, message, fields)
+}
+
+// completeRun records the end of a scheduled run: its last-run record, its
+// failure streak and, in per-run mode, the summary webhook.
+func (a *app) completeRun(ctx context.Context, kind string, streak *failureStreak, err error) {
+	record := a.scheduler.finishRun(kind, a.clock().Now(), err)
+	a.recordHistory(record)
+	switch kind {
+	case "cleanup":
+		a.metrics.collectors().cleanupRuns.Inc()
+	case "provision":
+		a.metrics.collectors().provisionRuns.Inc()
+		if err != nil {
+			a.metrics.collectors().provisionFailures.Inc()
+		}
+	}
+	a.recordRunOutcome(ctx, kind, streak, err)
+	if a.notifyMode != notifyModeRun {
+		return
+	}
+
+	outcome := "succeeded"
+	if err != nil {
+		outcome = "failed"
+	}
+	fields := map[string]any{
+		"run_id":           record.ID,
+		"run":              kind,
+		"created":          record.Created,
+		"deleted":          record.Deleted,
+		"failed":           record.Failed,
+		"duration_seconds": record.FinishedAt.Sub(record.StartedAt).Seconds(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	a.notify(ctx, "run_summary", fmt.Sprintf("%s run %s %s", kind, record.ID, outcome), fields)
+}
+
+// failureStreak counts consecutive failed scheduled runs.
+type failureStreak struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (f *failureStreak) record(failed bool) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if failed {
+		f.count++
+	} else {
+		f.count = 0
+	}
+	return f.count
+}
+
+// recordRunOutcome updates the scheduler's failure streak and alerts once it
+// reaches alertAfterFailedRuns. Runs interrupted by shutdown are not counted.
+func (a *app) recordRunOutcome(ctx context.Context, kind string, streak *failureStreak, err error) {
+	if err != nil && (errors.Is(err, context.Canceled) || ctx.Err() != nil) {
+		return
+	}
+
+	failures := streak.record(err != nil)
+	if err == nil {
+		return
+	}
+
+	a.logger.Warn("scheduled run failed", "run", kind, "consecutive_failures", failures, "error", err)
+	if a.alertAfterFailedRuns <= 0 || failures < a.alertAfterFailedRuns {
+		return
+	}
+
+	a.logger.Error("scheduled runs failing repeatedly",
+		"run", kind,
+		"consecutive_failures", failures,
+		"threshold", a.alertAfterFailedRuns,
+		"error", err,
+	)
+	a.notify(ctx, "scheduled_run_failures", fmt.Sprintf("%s has failed %d runs in a row", kind, failures), map[string]any{
+		"run":                  kind,
+		"consecutive_failures": failures,
+		"error":                err.Error(),
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// acquirePIDFile records the current process ID at path, refusing to start if
+// another live process already holds it. Stale files left behind by a process
+// that no longer exists are taken over. An empty path disables the PID file.
+func acquirePIDFile(path string) (release func(), err error) {
+	if path == "" {
+		return func() {}, nil
+	}
+
+	if pid, ok := readPIDFile(path); ok && pid != os.Getpid() && processAlive(pid) {
+		return nil, fmt.Errorf("pid file %s is held by running process %d", path, pid)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale pid file: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create pid file: %w", err)
+	}
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("write pid file: %w", err)
+	}
+
+	return func() {
+		// Only remove the file if it still names this process.
+		if pid, ok := readPIDFile(path); ok && pid == os.Getpid() {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+func readPIDFile(path string) (int, bool) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+
+	return pid, true
+}
+
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = proc.Signal(syscall.Signal(0))
+	if err == nil {
+		return true
+	}
+	// The process exists but belongs to another user.
+	return errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// planLadder tracks how far up the configured plan upgrades provisioning has
+// moved. Each day the outgoing instance exceeds the usage threshold, the next
+// provision uses the next larger plan; the ladder never steps back down on
+// its own.
+type planLadder struct {
+	mu    sync.Mutex
+	level int
+}
+
+func (l *planLadder) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+// bump moves one step up, stopping at top, and reports the new level.
+func (l *planLadder) bump(top int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level < top {
+		l.level++
+	}
+	return l.level
+}
+
+// provisionPlan returns the plan the next instance should be created with.
+func (a *app) provisionPlan() string {
+	level := a.plans.current()
+	if level == 0 || level > len(a.provisionPlanUpgrades) {
+		return a.provision.plan()
+	}
+	return a.provisionPlanUpgrades[level-1]
+}
+
+// recordInstanceUsage checks the bandwidth of the instances about to be
+// destroyed and moves provisioning to a larger plan when any of them went over
+// planUpgradeBandwidthBytes. It is a no-op unless upgrades are configured.
+func (a *app) recordInstanceUsage(ctx context.Context) {
+	if len(a.provisionPlanUpgrades) == 0 || a.planUpgradeBandwidthBytes <= 0 {
+		return
+	}
+
+	instances, err := a.vultr.instancesWithLabelPrefix(ctx, labelPrefix)
+	if err != nil {
+		a.logger.Warn("could not list instances to record usage", "error", err)
+		return
+	}
+
+	var peak int64
+	for _, instance := range instances {
+		used, err := a.vultr.instanceBandwidth(ctx, instance.ID)
+		if err != nil {
+			a.logger.Warn("could not fetch instance bandwidth", "instance_id", instance.ID, "error", err)
+			continue
+		}
+		peak = max(peak, used)
+	}
+
+	if peak <= a.planUpgradeBandwidthBytes {
+		a.logger.Info("instance usage within plan threshold",
+			"bandwidth_bytes", peak,
+			"threshold_bytes", a.planUpgradeBandwidthBytes,
+			"next_plan", a.provisionPlan(),
+		)
+		return
+	}
+
+	previous := a.provisionPlan()
+	a.plans.bump(len(a.provisionPlanUpgrades))
+	a.logger.Warn("instance exceeded usage threshold; upgrading next provision plan",
+		"bandwidth_bytes", peak,
+		"threshold_bytes", a.planUpgradeBandwidthBytes,
+		"previous_plan", previous,
+		"next_plan", a.provisionPlan(),
+	)
+}
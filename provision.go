@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,49 +15,93 @@ type provisionRunState struct {
 	instanceID string
 	label      string
 	reinstall  bool
+	// secondary is set once the run has failed over to the secondary account.
+	secondary bool
+	// regionIndex counts how many regions the run has moved past; 0 is
+	// the configured region, then each of provisionFallbackRegions in turn.
+	regionIndex int
+	// createToken identifies the run's logical create and stays the same
+	// across its retries. It is sent as a tag, so it is not a secret.
+	createToken string
+	// readyToken is the secret the created instance presents when it
+	// reports ready. It stays the same across the run's retries and only
+	// travels in the cloud-config.
+	readyToken string
+	// fromSnapshot is set when the instance was created from the carried-over
+	// snapshot; reinstalling it would throw that snapshot away.
+	fromSnapshot bool
+}
+
+// provisionAccount is the Vultr account a provision attempt runs against.
+type provisionAccount struct {
+	name           string
+	client         *vultrClient
+	blockStorageID string
+}
+
+func (a *app) provisionAccountFor(state *provisionRunState) provisionAccount {
+	if state != nil && state.secondary && a.secondaryVultr != nil {
+		return provisionAccount{name: "secondary", client: a.secondaryVultr, blockStorageID: a.secondaryBlockStorageID}
+	}
+	account := provisionAccount{name: "primary", client: a.vultr, blockStorageID: provisionBlockStorageID}
+	if state != nil && state.regionIndex > 0 {
+		// Block storage lives in the primary region and cannot follow a fallback.
+		account.blockStorageID = ""
+	}
+	return account
 }
 
 func (a *app) runDailyProvision(ctx context.Context) {
-	now := time.Now()
-	next := firstProvisionRunTimeKST(now, a.cleanupLoc)
+	now := a.clock().Now()
+	next := firstProvisionRunTimeKST(now, a.cleanupLoc, a.schedule.provisionAt)
 	a.logger.Info("daily instance provision scheduler started",
-		"timezone", cleanupTimeZone,
+		"timezone", a.cleanupLoc.String(),
 		"startup_kst", now.In(a.cleanupLoc).Format(time.RFC3339),
 		"next_run_kst", next.In(a.cleanupLoc).Format(time.RFC3339),
 	)
 
 	for {
-		wait := time.Until(next)
-		if wait < 0 {
-			wait = 0
-		}
-
-		timer := time.NewTimer(wait)
-		select {
-		case <-ctx.Done():
-			timer.Stop()
+		if !a.waitUntil(ctx, next) {
 			a.logger.Info("daily instance provision scheduler stopped")
 			return
-		case <-timer.C:
-			started := time.Now()
-			a.logger.Warn("starting scheduled instance provision run",
-				"scheduled_kst", next.In(a.cleanupLoc).Format(time.RFC3339),
-				"started_kst", started.In(a.cleanupLoc).Format(time.RFC3339),
-			)
-			a.reconcileEnsureParopalInstance(ctx)
-			next = nextProvisionTimeKST(time.Now(), a.cleanupLoc)
 		}
+
+		if !a.runs.begin() {
+			a.logger.Info("skipping scheduled provision run: shutdown in progress")
+			next = nextProvisionTimeKST(a.clock().Now(), a.cleanupLoc, a.schedule.provisionAt)
+			continue
+		}
+		if !a.provisionInFlight.CompareAndSwap(false, true) {
+			a.runs.end()
+			a.logger.Warn("skipping scheduled provision run: a manual provision is in flight")
+			next = nextProvisionTimeKST(a.clock().Now(), a.cleanupLoc, a.schedule.provisionAt)
+			continue
+		}
+		started := a.clock().Now()
+		a.logger.Warn("starting scheduled instance provision run",
+			"scheduled_kst", next.In(a.cleanupLoc).Format(time.RFC3339),
+			"started_kst", started.In(a.cleanupLoc).Format(time.RFC3339),
+			"drift", started.Sub(next).String(),
+		)
+		a.scheduler.startRun("provision", next, started)
+		err := a.reconcileEnsureParopalInstance(ctx)
+		a.completeRun(ctx, "provision", &a.provisionFailures, err)
+		a.provisionInFlight.Store(false)
+		a.runs.end()
+		next = nextProvisionTimeKST(a.clock().Now(), a.cleanupLoc, a.schedule.provisionAt)
 	}
 }
 
-func nextProvisionTimeKST(now time.Time, loc *time.Location) time.Time {
+// nextProvisionTimeKST returns the first daily provision at time of day at
+// that comes after now.
+func nextProvisionTimeKST(now time.Time, loc *time.Location, at timeOfDay) time.Time {
 	localNow := now.In(loc)
 	scheduled := time.Date(
 		localNow.Year(),
 		localNow.Month(),
 		localNow.Day(),
-		createHourKST,
-		createMinuteKST,
+		at.Hour,
+		at.Minute,
 		0,
 		0,
 		loc,
@@ -68,14 +114,16 @@ func nextProvisionTimeKST(now time.Time, loc *time.Location) time.Time {
 	return scheduled
 }
 
-func firstProvisionRunTimeKST(now time.Time, loc *time.Location) time.Time {
+// firstProvisionRunTimeKST is when the provision scheduler first runs after a
+// start at now: today's run time if it is still ahead, otherwise right away.
+func firstProvisionRunTimeKST(now time.Time, loc *time.Location, at timeOfDay) time.Time {
 	localNow := now.In(loc)
 	scheduledToday := time.Date(
 		localNow.Year(),
 		localNow.Month(),
 		localNow.Day(),
-		createHourKST,
-		createMinuteKST,
+		at.Hour,
+		at.Minute,
 		0,
 		0,
 		loc,
@@ -89,55 +137,155 @@ func firstProvisionRunTimeKST(now time.Time, loc *time.Location) time.Time {
 	return now
 }
 
-func (a *app) reconcileEnsureParopalInstance(ctx context.Context) {
+// reconcileEnsureParopalInstance retries provisioning until it succeeds, the
+// context ends, or the optional provisionRunTimeout budget is spent. It returns
+// the last provisioning error when the budget runs out.
+func (a *app) reconcileEnsureParopalInstance(ctx context.Context) error {
+	if a.readOnly {
+		a.logger.Warn("read-only mode; skipping provision reconciliation")
+		return nil
+	}
+
+	parent := ctx
+	if a.provisionRunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.provisionRunTimeout)
+		defer cancel()
+	}
+
 	backoff := a.provisionBackoffMin
+	var attachBackoff, maintenanceBackoff time.Duration
 	var state provisionRunState
+	var lastErr error
+	primaryFailures := 0
+
+	stopped := func() error {
+		if err := parent.Err(); err != nil {
+			return err
+		}
+		if lastErr == nil {
+			return ctx.Err()
+		}
+		a.logger.Error("instance provision run budget exhausted", "budget", a.provisionRunTimeout.String(), "error", lastErr)
+		return fmt.Errorf("provision run budget of %s exhausted: %w", a.provisionRunTimeout, lastErr)
+	}
 
 	for {
-		if err := ctx.Err(); err != nil {
-			return
+		if ctx.Err() != nil {
+			return stopped()
 		}
 
 		err := a.ensureParopalInstanceAndBlock(ctx, &state)
 		if err == nil {
-			return
+			return nil
 		}
+		lastErr = err
+		a.scheduler.addToRun("provision", 0, 0, 1)
 
-		a.logger.Error("instance provision failed", "error", err, "retry_in", backoff.String())
-		if !sleepWithContext(ctx, backoff) {
-			return
+		if errors.Is(err, errBlockStorageMissing) {
+			a.logger.Error("instance provision cannot attach missing block storage; giving up", "error", err)
+			return err
+		}
+		if errors.Is(err, errInstanceCeilingReached) {
+			a.notify(ctx, "provision_ceiling", "provisioning refused: too many paropal instances already exist", map[string]any{
+				"max_instances":         a.provisionMaxInstances,
+				"account_max_instances": a.accountMaxInstances,
+				"error":                 err.Error(),
+			})
+			return err
+		}
+
+		// Fail over only while nothing exists yet on the primary account; a created
+		// instance is always finished where it lives.
+		if a.secondaryVultr != nil && !state.secondary && state.instanceID == "" {
+			primaryFailures++
+			if primaryFailures >= max(a.provisionFailoverAfter, 1) {
+				a.logger.Error("primary account keeps failing to provision; failing over to secondary account",
+					"consecutive_failures", primaryFailures,
+					"error", err,
+				)
+				a.notify(ctx, "provision_failover", "provisioning failed over to the secondary Vultr account", map[string]any{
+					"consecutive_failures": primaryFailures,
+					"error":                err.Error(),
+				})
+				state = provisionRunState{secondary: true}
+				backoff = a.provisionBackoffMin
+				continue
+			}
 		}
-		backoff = nextBackoff(backoff, a.provisionBackoffMax)
+
+		// A Vultr maintenance window is waited out on its own backoff, whatever
+		// step failed; any other error resets it.
+		if wait, ok := a.maintenanceWait(err, &maintenanceBackoff); ok {
+			if !a.sleepWithContext(ctx, wait) {
+				return stopped()
+			}
+			continue
+		}
+		maintenanceBackoff = 0
+
+		// Once the instance exists only attach/reinstall is retried; those failures are
+		// usually short-lived readiness issues, so they get their own shorter backoff.
+		if state.instanceID != "" && a.provisionAttachBackoffMin > 0 {
+			if attachBackoff == 0 {
+				attachBackoff = a.provisionAttachBackoffMin
+			}
+			wait := rateLimitWait(err, a.backoffDelay(a.provisionAttachBackoffMin, attachBackoff))
+			a.logger.Error("instance provision attach failed", "error", err, "instance_id", state.instanceID, "retry_in", wait.String())
+			if !a.sleepWithContext(ctx, wait) {
+				return stopped()
+			}
+			attachBackoff = nextBackoffScaled(attachBackoff, a.provisionAttachBackoffMax, a.provisionBackoffMultiplier)
+			continue
+		}
+
+		wait := rateLimitWait(err, a.backoffDelay(a.provisionBackoffMin, backoff))
+		a.logger.Error("instance provision failed", "error", err, "retry_in", wait.String())
+		if !a.sleepWithContext(ctx, wait) {
+			return stopped()
+		}
+		backoff = nextBackoffScaled(backoff, a.provisionBackoffMax, a.provisionBackoffMultiplier)
 	}
 }
 
 func (a *app) ensureParopalInstanceAndBlock(ctx context.Context, state *provisionRunState) error {
+	account := a.provisionAccountFor(state)
+
 	// If we already created an instance in this run, don't create another one just because list endpoints are lagging.
 	if state != nil && strings.TrimSpace(state.instanceID) != "" {
-		attachRequested := true
-		attachErr := a.vultr.attachBlockStorage(ctx, provisionBlockStorageID, state.instanceID, provisionBlockAttachLive)
+		attachRequested := account.blockStorageID != ""
+		var attachErr error
+		if attachRequested {
+			if err := a.awaitAttachReady(ctx, account.client, state.instanceID); err != nil {
+				return err
+			}
+			attachErr = account.client.attachBlockStorage(ctx, account.blockStorageID, state.instanceID, a.blockAttachLive)
+		}
 		if attachErr != nil {
 			if isBlockAlreadyAttachedError(attachErr) {
 				a.logger.Info("block storage already attached; continuing",
-					"block_storage_id", provisionBlockStorageID,
+					"block_storage_id", account.blockStorageID,
 					"instance_id", state.instanceID,
 				)
 				attachRequested = false
 			} else {
-				return fmt.Errorf("attach block storage: %w", attachErr)
+				return a.attachFailure(ctx, account, attachErr)
 			}
 		}
 
 		if attachRequested {
 			a.logger.Info("block storage attach requested",
-				"block_storage_id", provisionBlockStorageID,
+				"block_storage_id", account.blockStorageID,
 				"instance_id", state.instanceID,
-				"live", provisionBlockAttachLive,
+				"live", a.blockAttachLive,
 			)
+			if err := a.confirmBlockAttached(ctx, account, state.instanceID); err != nil {
+				return err
+			}
 		}
 
-		if provisionReinstallAfterCreate && !state.reinstall {
-			if err := a.vultr.reinstallInstance(ctx, state.instanceID); err != nil {
+		if provisionReinstallAfterCreate && !state.reinstall && !state.fromSnapshot {
+			if err := account.client.reinstallInstance(ctx, state.instanceID); err != nil {
 				return fmt.Errorf("reinstall instance: %w", err)
 			}
 			state.reinstall = true
@@ -146,89 +294,300 @@ func (a *app) ensureParopalInstanceAndBlock(ctx context.Context, state *provisio
 				"label", state.label,
 			)
 		}
-		return nil
+		return a.confirmInstanceActive(ctx, account.client, state.instanceID)
 	}
 
-	instance, err := a.vultr.firstInstanceWithLabelPrefix(ctx, labelPrefix)
+	instance, err := account.client.firstInstanceWithLabelPrefix(ctx, labelPrefix)
 	if err != nil && !errors.Is(err, errInstanceNotFound) {
 		return fmt.Errorf("list instances: %w", err)
 	}
 
-	if err == nil && instance != nil && isTerminatingInstanceStatus(instance.Status) {
+	if errors.Is(err, errInstanceNotFound) {
+		instance = nil
+	}
+
+	create := false
+	// replacing is the instance a create in this attempt stands in for; it
+	// does not count against accountMaxInstances.
+	replacing := ""
+	// active records that the instance is already known to be ready, so the
+	// attach below need not poll for it again.
+	active := instance != nil && instanceReady(instance, a.provisionRequireServerOK)
+	switch provisionActionFor(classifyInstance(instance), a.provisionReplaceFailed) {
+	case provisionCreate:
+		create = true
+	case provisionCreateReplacement:
 		a.logger.Warn("ignoring terminating instance during provision",
 			"instance_id", instance.ID,
 			"label", instance.Label,
 			"status", instance.Status,
 			"ip", instance.MainIP,
 		)
-		err = errInstanceNotFound
+		create = true
+		replacing = instance.ID
+	case provisionDeleteAndRecreate:
+		a.logger.Warn("deleting failed instance before provisioning a replacement",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"status", instance.Status,
+		)
+		if a.provisionDryRun {
+			a.logger.Info("provision dry run; not deleting failed instance", "instance_id", instance.ID)
+		} else if err := account.client.deleteInstance(ctx, instance.ID); err != nil {
+			return fmt.Errorf("delete failed instance: %w", err)
+		}
+		create = true
+		replacing = instance.ID
+	case provisionWait:
+		a.logger.Info("instance is still pending; waiting instead of creating another",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"status", instance.Status,
+		)
+		if err := a.waitForInstanceActive(ctx, account.client, instance.ID, a.provisionActiveTimeout); err != nil {
+			return fmt.Errorf("wait for pending instance: %w", err)
+		}
+		active = true
+	case provisionAttach:
+		// Only a healthy instance is reinstalled; a failed one kept by
+		// provisionReplaceFailed=false is attached as before.
+		if a.provisionMode != provisionModeReinstall || classifyInstance(instance) != instanceActive {
+			a.logger.Info("instance already exists; skipping create",
+				"instance_id", instance.ID,
+				"label", instance.Label,
+				"status", instance.Status,
+				"ip", instance.MainIP,
+			)
+			break
+		}
+		if a.provisionDryRun {
+			a.logger.Info("provision dry run; not reinstalling existing instance", "instance_id", instance.ID)
+			break
+		}
+		if err := account.client.reinstallInstance(ctx, instance.ID); err != nil {
+			return fmt.Errorf("reinstall existing instance: %w", err)
+		}
+		a.logger.Warn("reinstalled existing instance instead of creating one",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"ip", instance.MainIP,
+		)
+		// Retries in this run only need the block attached; reinstalling
+		// again would restart the OS reset.
+		if state != nil {
+			state.instanceID = instance.ID
+			state.label = instance.Label
+			state.reinstall = true
+		}
+		active = false
+	}
+
+	if create {
+		if err := a.checkInstanceCeiling(ctx, account, replacing); err != nil {
+			return err
+		}
+	}
+
+	if a.provisionDryRun && !create {
+		a.logger.Info("provision dry run; not attaching block storage",
+			"account", account.name,
+			"instance_id", instance.ID,
+			"block_storage_id", account.blockStorageID,
+		)
+		return nil
 	}
 
 	createdNow := false
-	if errors.Is(err, errInstanceNotFound) {
-		cloudConfig, err := renderCloudConfig(provisionPrimaryUser)
+	if create {
+		label := newInstanceLabel(a.clock().Now(), a.labelLoc, a.labelTimeFormat)
+		regions := append([]string{a.provision.region()}, a.provisionFallbackRegions...)
+		regionIndex := 0
+		if state != nil {
+			regionIndex = min(state.regionIndex, len(regions)-1)
+		}
+
+		// Vultr has no idempotency key for creates, so the token travels as a
+		// tag. Duplicates on retry are prevented by the label-based adoption
+		// check above; the tag ties any instance back to the run that made it.
+		token := rand.Text()
+		if state != nil {
+			if state.createToken == "" {
+				state.createToken = token
+			}
+			token = state.createToken
+		}
+
+		// The instance reports ready with a separate secret, so a report can
+		// only come from this run's instance. The create token is readable by
+		// anyone who can list the account's tags.
+		var ready readyCallback
+		if a.readyCallbackURL != "" {
+			readyToken := rand.Text()
+			if state != nil {
+				if state.readyToken == "" {
+					state.readyToken = readyToken
+				}
+				readyToken = state.readyToken
+			}
+			ready = readyCallback{URL: a.readyCallbackURL, Token: readyToken}
+		}
+		cloudConfig, err := renderCloudConfig(a.sshUser(), a.sshListenPort(), ready, a.extraFilesDir)
 		if err != nil {
 			return err
 		}
 		userDataB64 := base64.StdEncoding.EncodeToString([]byte(cloudConfig))
 
-		label := newInstanceLabel(time.Now(), a.labelLoc)
-		instanceID, err := a.vultr.createInstance(ctx, createInstanceRequest{
-			Region:     provisionRegionID,
-			Plan:       provisionPlanID,
-			OSID:       provisionOSID,
+		tags := []string{createTokenTagPrefix + token}
+		if a.daemonID != "" {
+			tags = append(tags, daemonTagPrefix+a.daemonID)
+		}
+
+		req := createInstanceRequest{
+			Tags:       tags,
+			Plan:       a.provisionPlan(),
+			OSID:       a.provision.osID(),
 			Label:      label,
-			SSHKeyID:   []string{provisionSSHKeyID},
+			SSHKeyID:   a.provisionSSHKeyIDs(),
 			UserScheme: provisionUserScheme,
 			UserData:   userDataB64,
-		})
-		if err != nil {
-			return fmt.Errorf("create instance: %w", err)
+			ScriptID:   a.provisionScriptID,
+		}
+		// The carried-over snapshot lives on the primary account only.
+		if snapshot := a.snapshots.get(); a.snapshotCarryOver && snapshot.ID != "" && account.client == a.vultr {
+			req.SnapshotID = snapshot.ID
+			req.OSID = 0
+			a.logger.Info("booting from carried-over snapshot",
+				"snapshot_id", snapshot.ID,
+				"snapshot_of", snapshot.Label,
+			)
+		}
+		// Firewall groups are per account, so only the primary uses it.
+		if a.firewallGroupID != "" && account.client == a.vultr {
+			req.FirewallGroupID = a.firewallGroupID
+		}
+		if a.provisionDryRun {
+			req.Region = regions[regionIndex]
+			a.logger.Info("provision dry run; not creating instance",
+				"account", account.name,
+				"region", req.Region,
+				"plan", req.Plan,
+				"os_id", req.OSID,
+				"snapshot_id", req.SnapshotID,
+				"label", req.Label,
+				"sshkey_id", req.SSHKeyID,
+				"user_scheme", req.UserScheme,
+				"script_id", req.ScriptID,
+				"firewall_group_id", req.FirewallGroupID,
+				"ssh_port", a.sshListenPort(),
+				"create_token", token,
+				"user_data", fmt.Sprintf("<redacted %d bytes>", len(req.UserData)),
+				"block_storage_id", account.blockStorageID,
+			)
+			return nil
 		}
 
-			createdNow = true
-			if state != nil {
-				state.instanceID = instanceID
-				state.label = label
-				state.reinstall = false
+		if req.FirewallGroupID != "" {
+			if err := a.ensureSSHFirewallRule(ctx, account.client, req.FirewallGroupID); err != nil {
+				return err
 			}
-			instance = &vultrInstance{
-				ID:    instanceID,
-				Label: label,
+		}
+
+		var instanceID string
+		for {
+			req.Region = regions[regionIndex]
+			instanceID, err = account.client.createInstance(ctx, req)
+			if err == nil || !isRegionUnavailableError(err) || regionIndex+1 >= len(regions) {
+				break
 			}
+
+			regionIndex++
+			a.logger.Warn("region unavailable; retrying create in fallback region",
+				"region", regions[regionIndex-1],
+				"fallback_region", regions[regionIndex],
+				"error", err,
+			)
+			// Stay on the fallback region for the rest of the run.
+			if state != nil {
+				state.regionIndex = regionIndex
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("create instance: %w", err)
+		}
+		if regionIndex > 0 {
+			account.blockStorageID = ""
+		}
+
+		createdNow = true
+		if state != nil {
+			state.fromSnapshot = req.SnapshotID != ""
+		}
+		if ready.URL != "" {
+			a.ready.expect(ready.Token, label)
+		}
+		if state != nil {
+			state.instanceID = instanceID
+			state.label = label
+			state.reinstall = false
+		}
+		instance = &vultrInstance{
+			ID:    instanceID,
+			Label: label,
+		}
 		a.logger.Warn("created new instance",
+			"account", account.name,
+			"region", regions[regionIndex],
+			"plan", a.provisionPlan(),
+			"create_token", token,
 			"instance_id", instanceID,
 			"label", label,
 		)
-	} else {
-		a.logger.Info("instance already exists; skipping create",
+		a.scheduler.addToRun("provision", 1, 0, 0)
+		a.countInstances(1, 0)
+		a.notifyInstance(ctx, "instance_created", "created instance "+label, map[string]any{
+			"account":     account.name,
+			"instance_id": instanceID,
+			"label":       label,
+		})
+	}
+
+	if account.blockStorageID == "" {
+		a.logger.Warn("no block storage configured for account; skipping attach",
+			"account", account.name,
 			"instance_id", instance.ID,
-			"label", instance.Label,
-			"status", instance.Status,
-			"ip", instance.MainIP,
 		)
+		return a.confirmInstanceActive(ctx, account.client, instance.ID)
+	}
+
+	if !active {
+		if err := a.awaitAttachReady(ctx, account.client, instance.ID); err != nil {
+			return err
+		}
 	}
 
-	attachErr := a.vultr.attachBlockStorage(ctx, provisionBlockStorageID, instance.ID, provisionBlockAttachLive)
+	attachErr := account.client.attachBlockStorage(ctx, account.blockStorageID, instance.ID, a.blockAttachLive)
 	if attachErr != nil {
 		if isBlockAlreadyAttachedError(attachErr) && !createdNow {
 			a.logger.Info("block storage already attached; continuing",
-				"block_storage_id", provisionBlockStorageID,
+				"block_storage_id", account.blockStorageID,
 				"instance_id", instance.ID,
 			)
-			return nil
+			return a.confirmInstanceActive(ctx, account.client, instance.ID)
 		}
-		return fmt.Errorf("attach block storage: %w", attachErr)
+		return a.attachFailure(ctx, account, attachErr)
 	}
 
 	a.logger.Info("block storage attach requested",
-		"block_storage_id", provisionBlockStorageID,
+		"block_storage_id", account.blockStorageID,
 		"instance_id", instance.ID,
-		"live", provisionBlockAttachLive,
+		"live", a.blockAttachLive,
 	)
+	if err := a.confirmBlockAttached(ctx, account, instance.ID); err != nil {
+		return err
+	}
 
-	if createdNow && state != nil && provisionReinstallAfterCreate && !state.reinstall {
-		if err := a.vultr.reinstallInstance(ctx, instance.ID); err != nil {
+	if createdNow && state != nil && provisionReinstallAfterCreate && !state.reinstall && !state.fromSnapshot {
+		if err := account.client.reinstallInstance(ctx, instance.ID); err != nil {
 			return fmt.Errorf("reinstall instance: %w", err)
 		}
 		state.reinstall = true
@@ -237,22 +596,423 @@ func (a *app) ensureParopalInstanceAndBlock(ctx context.Context, state *provisio
 			"label", instance.Label,
 		)
 	}
+	return a.confirmInstanceActive(ctx, account.client, instance.ID)
+}
+
+// confirmBlockAttached polls the block until Vultr reports it attached to
+// instanceID. If the attach has not taken effect within attachVerifyTimeout,
+// it is re-issued once and polled for the same time again before giving up.
+// A zero attachVerifyTimeout turns the check off.
+func (a *app) confirmBlockAttached(ctx context.Context, account provisionAccount, instanceID string) error {
+	if a.attachVerifyTimeout <= 0 {
+		return nil
+	}
+
+	for reissued := false; ; reissued = true {
+		attached, err := a.pollBlockAttached(ctx, account, instanceID)
+		if err != nil {
+			return err
+		}
+		if attached {
+			a.logger.Info("block storage attach confirmed",
+				"block_storage_id", account.blockStorageID,
+				"instance_id", instanceID,
+			)
+			return nil
+		}
+		if reissued {
+			return fmt.Errorf("block storage %s not attached to %s after re-issuing attach", account.blockStorageID, instanceID)
+		}
+
+		a.logger.Warn("block storage attach did not take effect; re-issuing attach",
+			"block_storage_id", account.blockStorageID,
+			"instance_id", instanceID,
+			"waited", a.attachVerifyTimeout.String(),
+		)
+		if err := account.client.attachBlockStorage(ctx, account.blockStorageID, instanceID, a.blockAttachLive); err != nil && !isBlockAlreadyAttachedError(err) {
+			return fmt.Errorf("re-attach block storage: %w", err)
+		}
+	}
+}
+
+// pollBlockAttached reports whether the block shows as attached to instanceID
+// within attachVerifyTimeout.
+func (a *app) pollBlockAttached(ctx context.Context, account provisionAccount, instanceID string) (bool, error) {
+	interval := a.attachVerifyInterval
+	if interval <= 0 {
+		interval = defaultAttachVerifyInterval
+	}
+	deadline := a.clock().Now().Add(a.attachVerifyTimeout)
+
+	for {
+		block, err := account.client.getBlockStorage(ctx, account.blockStorageID)
+		switch {
+		case err != nil:
+			a.logger.Warn("block storage status check failed", "block_storage_id", account.blockStorageID, "error", err)
+		case block.AttachedToInstance == instanceID:
+			return true, nil
+		}
+
+		if !a.sleepWithContextUntil(ctx, interval, deadline) {
+			return false, ctx.Err()
+		}
+	}
+}
+
+// confirmInstanceActive gates provision success on the instance reaching the
+// active state when provisionRequireActive is set.
+func (a *app) confirmInstanceActive(ctx context.Context, client *vultrClient, instanceID string) error {
+	if !a.provisionRequireActive {
+		return nil
+	}
+	if err := a.waitForInstanceActive(ctx, client, instanceID, a.provisionActiveTimeout); err != nil {
+		return fmt.Errorf("wait for instance active: %w", err)
+	}
+	return nil
+}
+
+// checkInstanceCeiling guards against runaway creation: it returns
+// errInstanceCeilingReached when the account already holds
+// provisionMaxInstances or more paropal instances, or accountMaxInstances or
+// more instances of any label. Every listed paropal instance counts against
+// the first, including one that is terminating or being replaced. The
+// account-wide count skips terminating instances and replacing, the
+// instance this create replaces, so the default of one still lets a failed
+// instance be replaced. Pinned instances count against neither ceiling.
+func (a *app) checkInstanceCeiling(ctx context.Context, account provisionAccount, replacing string) error {
+	if a.provisionMaxInstances <= 0 && a.accountMaxInstances <= 0 {
+		return nil
+	}
+	all, err := account.client.listAllInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("count instances: %w", err)
+	}
+
+	var paropal, counted []vultrInstance
+	for _, instance := range all {
+		if isPinnedLabel(instance.Label, account.client.pinnedMarker) {
+			continue
+		}
+		if strings.HasPrefix(instance.Label, labelPrefix) {
+			paropal = append(paropal, instance)
+		}
+		if instance.ID != replacing && classifyInstance(&instance) != instanceTerminating {
+			counted = append(counted, instance)
+		}
+	}
+
+	if a.provisionMaxInstances > 0 && len(paropal) >= a.provisionMaxInstances {
+		a.logger.Error("refusing to create instance: paropal instance count is at the safety ceiling",
+			"account", account.name,
+			"count", len(paropal),
+			"max_instances", a.provisionMaxInstances,
+			"instance_ids", instanceIDs(paropal),
+		)
+		return fmt.Errorf("%w: %d on the %s account, max %d", errInstanceCeilingReached, len(paropal), account.name, a.provisionMaxInstances)
+	}
+	if a.accountMaxInstances > 0 && len(counted) >= a.accountMaxInstances {
+		labels := make([]string, 0, len(counted))
+		for _, instance := range counted {
+			labels = append(labels, instance.Label)
+		}
+		a.logger.Error("refusing to create instance: account already holds the maximum number of instances; was the paropal instance relabelled?",
+			"account", account.name,
+			"count", len(counted),
+			"account_max_instances", a.accountMaxInstances,
+			"instance_ids", instanceIDs(counted),
+			"labels", labels,
+		)
+		return fmt.Errorf("%w: %d instances of any label on the %s account, max %d", errInstanceCeilingReached, len(counted), account.name, a.accountMaxInstances)
+	}
 	return nil
 }
 
-func newInstanceLabel(now time.Time, loc *time.Location) string {
-	stamp := now.In(loc).Format("01-02_15-04-05")
+func instanceIDs(instances []vultrInstance) []string {
+	ids := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		ids = append(ids, instance.ID)
+	}
+	return ids
+}
+
+// ensureSSHFirewallRule makes sure the firewall group accepts TCP on the
+// configured SSH port from anywhere over IPv4, adding the rule when it is
+// missing. Other rules in the group are left alone.
+func (a *app) ensureSSHFirewallRule(ctx context.Context, client *vultrClient, firewallGroupID string) error {
+	port := strconv.Itoa(a.sshListenPort())
+	rules, err := client.listFirewallRules(ctx, firewallGroupID)
+	if err != nil {
+		return fmt.Errorf("list firewall rules: %w", err)
+	}
+	for _, rule := range rules {
+		if rule.IPType == "v4" && rule.Protocol == "tcp" && rule.Port == port && rule.SubnetSize == 0 {
+			return nil
+		}
+	}
+
+	err = client.createFirewallRule(ctx, firewallGroupID, vultrFirewallRule{
+		IPType:     "v4",
+		Protocol:   "tcp",
+		Subnet:     "0.0.0.0",
+		SubnetSize: 0,
+		Port:       port,
+		Notes:      "paropal ssh",
+	})
+	if err != nil {
+		return fmt.Errorf("create firewall rule: %w", err)
+	}
+	a.logger.Info("opened ssh port in firewall group",
+		"firewall_group_id", firewallGroupID,
+		"port", port,
+	)
+	return nil
+}
+
+// awaitAttachReady holds off attaching block storage until the instance is
+// active. Vultr reports new instances as "pending" for a while and attaching
+// then tends to fail. With provisionRequireServerOK it also waits for
+// server_status "ok", since installers hold the server locked after it turns
+// active. A zero provisionActiveTimeout disables the wait unless
+// provisionRequireServerOK is set, in which case it waits without a deadline
+// of its own.
+func (a *app) awaitAttachReady(ctx context.Context, client *vultrClient, instanceID string) error {
+	if a.provisionActiveTimeout <= 0 && !a.provisionRequireServerOK {
+		return nil
+	}
+	if err := a.waitForInstanceActive(ctx, client, instanceID, a.provisionActiveTimeout); err != nil {
+		return fmt.Errorf("wait for instance ready before attach: %w", err)
+	}
+	return nil
+}
+
+// instanceReady reports whether the instance counts as active. With
+// requireServerOK it must also report server_status "ok".
+func instanceReady(instance *vultrInstance, requireServerOK bool) bool {
+	if !strings.EqualFold(instance.Status, "active") {
+		return false
+	}
+	return !requireServerOK || strings.EqualFold(instance.ServerStatus, "ok")
+}
+
+// waitForInstanceActive polls the instance until Vultr reports it active (and,
+// with provisionRequireServerOK, its server_status ok). It fails early if the
+// instance starts terminating or reports a failed state. The poll interval
+// backs off from provisionActivePollInterval up to
+// maxProvisionActivePollInterval. A zero timeout sets no deadline of its own;
+// the wait then lasts as long as ctx.
+func (a *app) waitForInstanceActive(ctx context.Context, client *vultrClient, instanceID string, timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = a.clock().Now().Add(timeout)
+	}
+	interval := a.provisionActivePollInterval
+	if interval <= 0 {
+		interval = defaultProvisionActivePollInterval
+	}
+
+	for {
+		instance, err := client.getInstance(ctx, instanceID)
+		switch {
+		case err != nil:
+			a.logger.Warn("instance status check failed", "instance_id", instanceID, "error", err)
+		case instanceReady(instance, a.provisionRequireServerOK):
+			a.logger.Info("instance is active", "instance_id", instanceID, "server_status", instance.ServerStatus)
+			return nil
+		case isTerminatingInstanceStatus(instance.Status) || isFailedInstanceStatus(instance.Status):
+			return fmt.Errorf("instance %s entered status %q", instanceID, instance.Status)
+		default:
+			a.logger.Info("waiting for instance to become active",
+				"instance_id", instanceID,
+				"status", instance.Status,
+				"server_status", instance.ServerStatus,
+			)
+		}
+
+		if !a.sleepWithContextUntil(ctx, interval, deadline) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("instance %s not active after %s", instanceID, timeout)
+		}
+		interval = nextBackoff(interval, max(maxProvisionActivePollInterval, interval))
+	}
+}
+
+func newInstanceLabel(now time.Time, loc *time.Location, layout string) string {
+	if layout == "" {
+		layout = defaultLabelTimeFormat
+	}
+	stamp := now.In(loc).Format(layout)
 	return labelPrefix + stamp
 }
 
+// validateLabelTimeFormat rejects layouts that contain no Go reference-time
+// elements, so that every instance would get the same label, or that cannot
+// parse their own output.
+func validateLabelTimeFormat(layout string) error {
+	if strings.TrimSpace(layout) == "" {
+		return errors.New("label time format cannot be empty")
+	}
+
+	// The two times differ in every field, so any reference element in the
+	// layout makes their formatted labels differ.
+	reference := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+	other := time.Date(2007, time.March, 4, 16, 6, 7, 0, time.UTC)
+	formatted := reference.Format(layout)
+	if formatted == other.Format(layout) {
+		return fmt.Errorf("label time format %q contains no reference time elements (e.g. 01-02_15-04-05)", layout)
+	}
+	if _, err := time.Parse(layout, formatted); err != nil {
+		return fmt.Errorf("label time format %q is not a valid Go time layout: %w", layout, err)
+	}
+
+	return nil
+}
+
+// attachFailure wraps a failed attach. When Vultr reports the configured block
+// storage does not exist, no retry can succeed, so it returns
+// errBlockStorageMissing for the reconciler to give up on.
+func (a *app) attachFailure(ctx context.Context, account provisionAccount, attachErr error) error {
+	if !isNotFoundError(attachErr) {
+		return fmt.Errorf("attach block storage: %w", attachErr)
+	}
+	if _, err := account.client.getBlockStorage(ctx, account.blockStorageID); isNotFoundError(err) {
+		return fmt.Errorf("%w: %s on the %s account", errBlockStorageMissing, account.blockStorageID, account.name)
+	}
+	return fmt.Errorf("attach block storage: %w", attachErr)
+}
+
 func isBlockAlreadyAttachedError(err error) bool {
-	if err == nil {
+	msg, ok := vultrErrorMessage(err)
+	if !ok {
 		return false
 	}
-	msg := strings.ToLower(err.Error())
 	return strings.Contains(msg, "already attached") || strings.Contains(msg, "already in use")
 }
 
+// isBlockNotAttachedError matches Vultr's detach errors for a block that is
+// not attached to anything, which a detach can safely ignore.
+func isBlockNotAttachedError(err error) bool {
+	msg, ok := vultrErrorMessage(err)
+	if !ok {
+		return false
+	}
+	return strings.Contains(msg, "not attached") || strings.Contains(msg, "already detached")
+}
+
+// isRegionUnavailableError matches Vultr's create errors for a region that
+// cannot take new instances right now.
+func isRegionUnavailableError(err error) bool {
+	msg, ok := vultrErrorMessage(err)
+	if !ok {
+		return false
+	}
+	if !strings.Contains(msg, "region") {
+		return false
+	}
+	return strings.Contains(msg, "unavailable") || strings.Contains(msg, "not available") || strings.Contains(msg, "sold out")
+}
+
+// instanceState classifies an existing paropal instance for provisioning.
+type instanceState int
+
+const (
+	instanceAbsent instanceState = iota
+	instancePending
+	instanceActive
+	instanceTerminating
+	instanceFailed
+)
+
+func (s instanceState) String() string {
+	switch s {
+	case instanceAbsent:
+		return "absent"
+	case instancePending:
+		return "pending"
+	case instanceActive:
+		return "active"
+	case instanceTerminating:
+		return "terminating"
+	case instanceFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// provisionAction is what ensureParopalInstanceAndBlock does about the
+// instance it found.
+type provisionAction int
+
+const (
+	provisionCreate provisionAction = iota
+	provisionWait
+	provisionAttach
+	provisionCreateReplacement
+	provisionDeleteAndRecreate
+)
+
+func (p provisionAction) String() string {
+	switch p {
+	case provisionCreate:
+		return "create"
+	case provisionWait:
+		return "wait"
+	case provisionAttach:
+		return "attach"
+	case provisionCreateReplacement:
+		return "create-replacement"
+	case provisionDeleteAndRecreate:
+		return "delete-and-recreate"
+	default:
+		return "unknown"
+	}
+}
+
+// classifyInstance maps a listed instance onto an instanceState. A nil
+// instance is absent. Statuses that are neither terminating, failed nor
+// still coming up (pending, resizing) count as active, which keeps the
+// previous attach-and-go behaviour for anything unexpected.
+func classifyInstance(instance *vultrInstance) instanceState {
+	if instance == nil {
+		return instanceAbsent
+	}
+	switch {
+	case isTerminatingInstanceStatus(instance.Status):
+		return instanceTerminating
+	case isFailedInstanceStatus(instance.Status):
+		return instanceFailed
+	}
+	switch strings.ToLower(strings.TrimSpace(instance.Status)) {
+	case "pending", "resizing":
+		return instancePending
+	default:
+		return instanceActive
+	}
+}
+
+// provisionActionFor decides how to provision given the existing instance's
+// state. A failed instance is only replaced when replaceFailed is set;
+// otherwise it is left in place and attached to as before.
+func provisionActionFor(state instanceState, replaceFailed bool) provisionAction {
+	switch state {
+	case instanceAbsent:
+		return provisionCreate
+	case instancePending:
+		return provisionWait
+	case instanceTerminating:
+		return provisionCreateReplacement
+	case instanceFailed:
+		if replaceFailed {
+			return provisionDeleteAndRecreate
+		}
+		return provisionAttach
+	default:
+		return provisionAttach
+	}
+}
+
 func isTerminatingInstanceStatus(status string) bool {
 	s := strings.ToLower(strings.TrimSpace(status))
 	if s == "" {
@@ -263,3 +1023,11 @@ func isTerminatingInstanceStatus(status string) bool {
 		strings.Contains(s, "terminate") ||
 		strings.Contains(s, "remov")
 }
+
+// isFailedInstanceStatus reports whether status indicates an instance that
+// will not recover on its own and should be replaced. Of Vultr's documented
+// statuses (active, pending, suspended, resizing) only suspended qualifies;
+// anything undocumented is not treated as failed.
+func isFailedInstanceStatus(status string) bool {
+	return strings.EqualFold(strings.TrimSpace(status), "suspended")
+}
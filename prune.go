@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// runAgePrune periodically deletes paropal instances older than pruneMaxAge,
+// independent of the cleanup window. It catches instances the nightly cleanup
+// missed, for example because the cutoff arrived first. It does nothing when
+// pruneMaxAge is unset.
+func (a *app) runAgePrune(ctx context.Context) {
+	if a.pruneMaxAge <= 0 {
+		return
+	}
+
+	interval := a.pruneInterval
+	if interval <= 0 {
+		interval = defaultPruneInterval
+	}
+	a.logger.Info("age prune scheduler started", "max_age", a.pruneMaxAge.String(), "interval", interval.String())
+
+	for {
+		if !a.waitUntil(ctx, a.clock().Now().Add(interval)) {
+			a.logger.Info("age prune scheduler stopped")
+			return
+		}
+
+		if !a.runs.begin() {
+			a.logger.Info("skipping age prune: shutdown in progress")
+			continue
+		}
+		if err := a.pruneOldInstances(ctx); err != nil {
+			a.logger.Error("age prune failed", "error", err)
+		}
+		a.runs.end()
+	}
+}
+
+// pruneOldInstances deletes over-age paropal instances on the primary and,
+// when configured, the secondary account.
+func (a *app) pruneOldInstances(ctx context.Context) error {
+	if a.readOnly {
+		a.logger.Warn("read-only mode; skipping age prune")
+		return nil
+	}
+
+	err := a.pruneAccount(ctx, a.vultr, provisionBlockStorageID)
+	if a.secondaryVultr == nil || ctx.Err() != nil {
+		return err
+	}
+	return errors.Join(err, a.pruneAccount(ctx, a.secondaryVultr, a.secondaryBlockStorageID))
+}
+
+// pruneAccount deletes the account's over-age paropal instances, detaching
+// the account's managed block storage first as cleanup does. With
+// cleanupDryRun it only logs what it would delete.
+func (a *app) pruneAccount(ctx context.Context, client *vultrClient, blockStorageID string) error {
+	instances, err := client.listAllInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("list instances: %w", err)
+	}
+
+	now := a.clock().Now()
+	var errs []error
+	for _, instance := range a.cleanupTargets(instances) {
+		if !strings.HasPrefix(instance.Label, labelPrefix) {
+			continue
+		}
+		age, ok := a.instanceAge(instance, now)
+		if !ok {
+			a.logCleanupDecision("age prune cannot determine instance age; sparing it", instance, "spare",
+				"no date_created and label has no timestamp")
+			continue
+		}
+		if age <= a.pruneMaxAge {
+			a.logCleanupDecision("age prune sparing instance", instance, "spare",
+				"younger than max age", "age", age.Round(time.Minute).String(), "max_age", a.pruneMaxAge.String())
+			continue
+		}
+
+		if a.cleanupDryRun {
+			a.logger.Warn("age prune dry run: would delete over-age instance",
+				"instance_id", instance.ID,
+				"label", instance.Label,
+				"age", age.Round(time.Minute).String(),
+				"max_age", a.pruneMaxAge.String(),
+			)
+			continue
+		}
+
+		a.detachBlockBeforeDelete(ctx, client, blockStorageID, instance.ID)
+		if err := client.deleteInstance(ctx, instance.ID); err != nil {
+			errs = append(errs, fmt.Errorf("delete instance %s: %w", instance.ID, err))
+			continue
+		}
+		a.logger.Warn("age prune deleted over-age instance",
+			"instance_id", instance.ID,
+			"label", instance.Label,
+			"age", age.Round(time.Minute).String(),
+			"max_age", a.pruneMaxAge.String(),
+		)
+		a.countInstances(0, 1)
+		a.notifyInstance(ctx, "instance_deleted", "pruned over-age instance "+instance.Label, map[string]any{
+			"instance_id": instance.ID,
+			"label":       instance.Label,
+			"age":         age.Round(time.Minute).String(),
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// instanceAge reports how long ago the instance was created, preferring
+// Vultr's date_created and falling back to the timestamp in its label. Label
+// layouts without a year are taken to be in the most recent matching year.
+func (a *app) instanceAge(instance vultrInstance, now time.Time) (time.Duration, bool) {
+	if created, err := time.Parse(time.RFC3339, instance.DateCreated); err == nil {
+		return now.Sub(created), true
+	}
+
+	layout := a.labelTimeFormat
+	if layout == "" {
+		layout = defaultLabelTimeFormat
+	}
+	loc := a.labelLoc
+	if loc == nil {
+		loc = time.UTC
+	}
+	created, err := time.ParseInLocation(layout, strings.TrimPrefix(instance.Label, labelPrefix), loc)
+	if err != nil {
+		return 0, false
+	}
+	if created.Year() == 0 {
+		created = created.AddDate(now.In(loc).Year(), 0, 0)
+		if created.After(now) {
+			created = created.AddDate(-1, 0, 0)
+		}
+	}
+	return now.Sub(created), true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readyReport is what a new instance says about itself once cloud-init has
+// finished: the SSH port and user it actually serves, not the ones the daemon
+// assumes.
+type readyReport struct {
+	Label      string    `json:"label"`
+	SSHPort    int       `json:"ssh_port"`
+	User       string    `json:"user"`
+	Hostname   string    `json:"hostname,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// readyTracker remembers the token handed to the most recently created
+// instance and the last report received with it. The zero value is ready to
+// use.
+type readyTracker struct {
+	mu     sync.Mutex
+	token  string
+	label  string
+	report *readyReport
+}
+
+// expect arms the tracker for an instance created with label whose
+// cloud-config carries token. It replaces any earlier expectation.
+func (t *readyTracker) expect(token, label string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = token
+	t.label = label
+}
+
+// record stores report when token is the one handed out for the current
+// instance, filling in its label.
+func (t *readyTracker) record(token string, report readyReport) (readyReport, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" || !tokenMatches(token, t.token) {
+		return readyReport{}, false
+	}
+	report.Label = t.label
+	t.report = &report
+	return report, true
+}
+
+// lastFor returns the last report when it came from the instance with label.
+func (t *readyTracker) lastFor(label string) (readyReport, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.report == nil || t.report.Label != label {
+		return readyReport{}, false
+	}
+	return *t.report, true
+}
+
+// handleInstanceReady receives the callback a new instance makes when its
+// cloud-init finishes. It authenticates with the per-instance token from the
+// cloud-config, not the admin token.
+func (a *app) handleInstanceReady(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(strings.TrimSpace(r.Header.Get("Authorization")), "Bearer ")
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "unauthorized",
+		})
+		return
+	}
+
+	var body struct {
+		SSHPort  int    `json:"ssh_port"`
+		User     string `json:"user"`
+		Hostname string `json:"hostname"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "request body must be a JSON status document",
+		})
+		return
+	}
+	if body.SSHPort < 1 || body.SSHPort > 65535 || strings.TrimSpace(body.User) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "ssh_port and user are required",
+		})
+		return
+	}
+
+	report, ok := a.ready.record(strings.TrimSpace(token), readyReport{
+		SSHPort:    body.SSHPort,
+		User:       body.User,
+		Hostname:   body.Hostname,
+		RemoteAddr: r.RemoteAddr,
+		ReportedAt: a.clock().Now(),
+	})
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "unauthorized",
+		})
+		return
+	}
+
+	a.logger.Info("instance reported ready",
+		"label", report.Label,
+		"ssh_port", report.SSHPort,
+		"user", report.User,
+		"hostname", report.Hostname,
+		"remote_addr", report.RemoteAddr,
+	)
+	if report.SSHPort != a.sshListenPort() || report.User != a.sshUser() {
+		a.logger.Warn("instance reported a different ssh endpoint than expected",
+			"label", report.Label,
+			"ssh_port", report.SSHPort,
+			"expected_ssh_port", a.sshListenPort(),
+			"user", report.User,
+			"expected_user", a.sshUser(),
+		)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "recorded",
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type reconcileState struct {
+	Instances       int    `json:"instances"`
+	InstanceID      string `json:"instance_id,omitempty"`
+	BlockAttached   bool   `json:"block_attached"`
+	BlockAttachedTo string `json:"block_attached_to,omitempty"`
+}
+
+type reconcileStatus struct {
+	InSync   bool           `json:"in_sync"`
+	Desired  reconcileState `json:"desired"`
+	Observed reconcileState `json:"observed"`
+	Drift    []string       `json:"drift"`
+}
+
+// handleReconcileStatus compares the desired steady state (one paropal
+// instance with the managed block attached) against what Vultr reports.
+func (a *app) handleReconcileStatus(w http.ResponseWriter, r *http.Request) {
+	matches, err := a.vultr.instancesWithLabelPrefix(r.Context(), labelPrefix)
+	if err != nil {
+		a.logger.Error("failed to fetch instances", "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error": "failed to fetch instances from Vultr",
+		})
+		return
+	}
+
+	block, err := a.vultr.getBlockStorage(r.Context(), provisionBlockStorageID)
+	if err != nil {
+		a.logger.Error("failed to fetch block storage", "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error": "failed to fetch block storage from Vultr",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, compareReconcileState(matches, block))
+}
+
+func compareReconcileState(matches []vultrInstance, block *vultrBlock) reconcileStatus {
+	status := reconcileStatus{
+		Desired: reconcileState{
+			Instances:     1,
+			BlockAttached: true,
+		},
+		Observed: reconcileState{
+			Instances:       len(matches),
+			BlockAttachedTo: block.AttachedToInstance,
+		},
+		Drift: []string{},
+	}
+
+	if instance, err := bestInstance(matches); err == nil {
+		status.Desired.InstanceID = instance.ID
+		status.Desired.BlockAttachedTo = instance.ID
+		status.Observed.InstanceID = instance.ID
+		status.Observed.BlockAttached = block.AttachedToInstance != "" && block.AttachedToInstance == instance.ID
+	}
+
+	if len(matches) != status.Desired.Instances {
+		status.Drift = append(status.Drift, fmt.Sprintf("expected %d %s instance, found %d", status.Desired.Instances, labelPrefix+"*", len(matches)))
+	}
+	if len(matches) > 0 && !status.Observed.BlockAttached {
+		if block.AttachedToInstance == "" {
+			status.Drift = append(status.Drift, "block storage is not attached")
+		} else {
+			status.Drift = append(status.Drift, fmt.Sprintf("block storage is attached to %s, not %s", block.AttachedToInstance, status.Observed.InstanceID))
+		}
+	}
+
+	status.InSync = len(status.Drift) == 0
+	return status
+}
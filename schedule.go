@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const defaultScheduleCommandRuns = 5
+
+type scheduledRun struct {
+	Kind string
+	At   time.Time
+}
+
+// upcomingRuns lists the next count cleanup and provision runs after now,
+// ordered by time, using the same functions the schedulers use.
+func upcomingRuns(now time.Time, loc *time.Location, schedule dailySchedule, count int) []scheduledRun {
+	runs := make([]scheduledRun, 0, count*2)
+
+	next := nextCleanupTimeKST(now, loc, schedule.cleanupAt)
+	for i := 0; i < count; i++ {
+		runs = append(runs, scheduledRun{Kind: "cleanup", At: next})
+		next = nextCleanupTimeKST(next, loc, schedule.cleanupAt)
+	}
+
+	next = nextProvisionTimeKST(now, loc, schedule.provisionAt)
+	for i := 0; i < count; i++ {
+		runs = append(runs, scheduledRun{Kind: "provision", At: next})
+		next = nextProvisionTimeKST(next, loc, schedule.provisionAt)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].At.Before(runs[j].At) })
+	return runs
+}
+
+// runScheduleCommand implements `daemon schedule`: it prints the upcoming runs
+// and exits without contacting Vultr.
+func runScheduleCommand(args []string, stdout io.Writer, now time.Time) error {
+	fs := flag.NewFlagSet("schedule", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	count := fs.Int("n", defaultScheduleCommandRuns, "number of runs to print per scheduler")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *count <= 0 {
+		return fmt.Errorf("-n must be positive")
+	}
+
+	loc, err := locationFromEnv(timeZoneEnv, cleanupTimeZone)
+	if err != nil {
+		return err
+	}
+	schedule, err := scheduleFromEnv(defaultSchedule)
+	if err != nil {
+		return err
+	}
+
+	windowStart, windowEnd := cleanupWindowBounds(now, loc, schedule.window)
+	fmt.Fprintf(stdout, "timezone: %s\n", loc)
+	fmt.Fprintf(stdout, "cleanup window: %s-%s\n", windowStart.Format("15:04"), windowEnd.Format("15:04"))
+	for _, run := range upcomingRuns(now, loc, schedule, *count) {
+		fmt.Fprintf(stdout, "%-9s  %s\n", run.Kind, run.At.In(loc).Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// cleanupWindow is the next window cleanup may run in, as served by
+// /api/window/next.
+type cleanupWindow struct {
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Timezone    string `json:"timezone"`
+	InProgress  bool   `json:"in_progress"`
+	NextCleanup string `json:"next_cleanup"`
+}
+
+// nextCleanupWindow returns the window containing now, or failing that the
+// next one to open. Windows are projected one day at a time via
+// cleanupWindowBounds.
+func nextCleanupWindow(now time.Time, loc *time.Location, window timeWindow) (start, end time.Time, inProgress bool) {
+	start, end = cleanupWindowBounds(now, loc, window)
+	if !now.Before(end) {
+		localNow := now.In(loc)
+		tomorrow := time.Date(localNow.Year(), localNow.Month(), localNow.Day()+1, 12, 0, 0, 0, loc)
+		start, end = cleanupWindowBounds(tomorrow, loc, window)
+	}
+	return start, end, !now.Before(start) && now.Before(end)
+}
+
+func (a *app) handleNextWindow(w http.ResponseWriter, r *http.Request) {
+	now := a.clock().Now()
+	start, end, inProgress := nextCleanupWindow(now, a.cleanupLoc, a.schedule.window)
+	writeJSON(w, http.StatusOK, cleanupWindow{
+		Start:       start.In(a.cleanupLoc).Format(time.RFC3339),
+		End:         end.In(a.cleanupLoc).Format(time.RFC3339),
+		Timezone:    a.cleanupLoc.String(),
+		InProgress:  inProgress,
+		NextCleanup: nextCleanupTimeKST(now, a.cleanupLoc, a.schedule.cleanupAt).In(a.cleanupLoc).Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runRecord describes one scheduled run. DriftSeconds is how late the run
+// started relative to ScheduledAt, surfacing timer or clock problems.
+type runRecord struct {
+	ID           string    `json:"id"`
+	Kind         string    `json:"kind"`
+	ScheduledAt  time.Time `json:"scheduled_at,omitzero"`
+	StartedAt    time.Time `json:"started_at"`
+	DriftSeconds float64   `json:"drift_seconds"`
+	FinishedAt   time.Time `json:"finished_at,omitzero"`
+	Created      int       `json:"created"`
+	Deleted      int       `json:"deleted"`
+	Failed       int       `json:"failed"`
+	Error        string    `json:"error,omitempty"`
+}
+
+func newRunRecord(kind string, at time.Time) runRecord {
+	return runRecord{
+		ID:        kind + "-" + at.UTC().Format("20060102T150405Z"),
+		Kind:      kind,
+		StartedAt: at,
+	}
+}
+
+// schedulerState holds the scheduler bookkeeping that HTTP handlers read while
+// the schedulers write it. Every access goes through its methods; the zero
+// value is ready to use. State with its own lock (failureStreak, planLadder,
+// reconcileRuns) stays in those types.
+type schedulerState struct {
+	mu       sync.RWMutex
+	active   map[string]runRecord
+	lastRuns map[string]runRecord
+	// drift, when set, records each run's drift by kind.
+	drift *prometheus.GaugeVec
+}
+
+// schedulerSnapshot is a consistent copy of schedulerState.
+type schedulerSnapshot struct {
+	Active   []runRecord `json:"active"`
+	LastRuns []runRecord `json:"last_runs"`
+}
+
+// startRun records a run of kind that was due at scheduled and started at at.
+func (s *schedulerState) startRun(kind string, scheduled, at time.Time) {
+	record := newRunRecord(kind, at)
+	record.ScheduledAt = scheduled
+	record.DriftSeconds = at.Sub(scheduled).Seconds()
+	if s.drift != nil {
+		s.drift.WithLabelValues(kind).Set(record.DriftSeconds)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		s.active = make(map[string]runRecord)
+	}
+	s.active[kind] = record
+}
+
+// addToRun adds to the counters of the active run of kind. It is a no-op when
+// no such run is active, e.g. for reconciles not started by a scheduler.
+func (s *schedulerState) addToRun(kind string, created, deleted, failed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.active[kind]
+	if !ok {
+		return
+	}
+	record.Created += created
+	record.Deleted += deleted
+	record.Failed += failed
+	s.active[kind] = record
+}
+
+func (s *schedulerState) finishRun(kind string, at time.Time, err error) runRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.active[kind]
+	if !ok {
+		record = newRunRecord(kind, at)
+	}
+	delete(s.active, kind)
+
+	record.FinishedAt = at
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if s.lastRuns == nil {
+		s.lastRuns = make(map[string]runRecord)
+	}
+	s.lastRuns[kind] = record
+	return record
+}
+
+func (s *schedulerState) lastRun(kind string) (runRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.lastRuns[kind]
+	return record, ok
+}
+
+func (s *schedulerState) snapshot() schedulerSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := schedulerSnapshot{
+		Active:   make([]runRecord, 0, len(s.active)),
+		LastRuns: make([]runRecord, 0, len(s.lastRuns)),
+	}
+	for _, record := range s.active {
+		snap.Active = append(snap.Active, record)
+	}
+	for _, record := range s.lastRuns {
+		snap.LastRuns = append(snap.LastRuns, record)
+	}
+	sort.Slice(snap.Active, func(i, j int) bool { return snap.Active[i].Kind < snap.Active[j].Kind })
+	sort.Slice(snap.LastRuns, func(i, j int) bool { return snap.LastRuns[i].Kind < snap.LastRuns[j].Kind })
+	return snap
+}
+
+func (a *app) handleRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		schedulerSnapshot
+		Lifetime counterValues `json:"lifetime"`
+	}{a.scheduler.snapshot(), a.counters.snapshot()})
+}
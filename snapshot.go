@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type vultrSnapshot struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	DateCreated string `json:"date_created"`
+}
+
+type createSnapshotRequest struct {
+	InstanceID  string `json:"instance_id"`
+	Description string `json:"description"`
+}
+
+type snapshotResponse struct {
+	Snapshot vultrSnapshot `json:"snapshot"`
+}
+
+func (c *vultrClient) createSnapshot(ctx context.Context, instanceID, description string) (*vultrSnapshot, error) {
+	if strings.TrimSpace(instanceID) == "" {
+		return nil, errors.New("instance id cannot be empty")
+	}
+
+	var response snapshotResponse
+	req := createSnapshotRequest{InstanceID: instanceID, Description: description}
+	if err := c.doJSON(ctx, http.MethodPost, "/snapshots", req, &response); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(response.Snapshot.ID) == "" {
+		return nil, errors.New("create snapshot response missing snapshot id")
+	}
+	return &response.Snapshot, nil
+}
+
+func (c *vultrClient) getSnapshot(ctx context.Context, snapshotID string) (*vultrSnapshot, error) {
+	if strings.TrimSpace(snapshotID) == "" {
+		return nil, errors.New("snapshot id cannot be empty")
+	}
+
+	var response snapshotResponse
+	if err := c.do(ctx, http.MethodGet, "/snapshots/"+url.PathEscape(snapshotID), &response); err != nil {
+		return nil, err
+	}
+	return &response.Snapshot, nil
+}
+
+func (c *vultrClient) deleteSnapshot(ctx context.Context, snapshotID string) error {
+	if strings.TrimSpace(snapshotID) == "" {
+		return errors.New("snapshot id cannot be empty")
+	}
+	return c.do(ctx, http.MethodDelete, "/snapshots/"+url.PathEscape(snapshotID), nil)
+}
+
+// carriedSnapshot is the snapshot the nightly cleanup took, which the next
+// provision boots from. It is what the snapshot state file holds.
+type carriedSnapshot struct {
+	ID         string    `json:"id"`
+	InstanceID string    `json:"instance_id"`
+	Label      string    `json:"label"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// snapshotStore persists the carried-over snapshot between the cleanup that
+// takes it and the provision that uses it, across restarts.
+type snapshotStore struct {
+	mu      sync.Mutex
+	path    string
+	current carriedSnapshot
+}
+
+// load reads the snapshot recorded at path and saves to it from then on. A
+// missing file means there is no snapshot yet.
+func (s *snapshotStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.current); err != nil {
+		return fmt.Errorf("decode snapshot state file: %w", err)
+	}
+	return nil
+}
+
+func (s *snapshotStore) get() carriedSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// replace records snapshot and returns the one it supersedes.
+func (s *snapshotStore) replace(snapshot carriedSnapshot) (carriedSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return carriedSnapshot{}, fmt.Errorf("encode snapshot state: %w", err)
+		}
+		if err := writeFileAtomic(s.path, data); err != nil {
+			return carriedSnapshot{}, fmt.Errorf("write snapshot state file: %w", err)
+		}
+	}
+	previous := s.current
+	s.current = snapshot
+	return previous, nil
+}
+
+// snapshotBeforeCleanup snapshots the paropal instance so the next provision
+// can boot from it, waiting until Vultr reports the snapshot complete. The
+// wait is bounded by snapshotTimeout and by half the time left before cutoff,
+// so the deletes that follow always get most of the window; a snapshot that
+// fails or does not finish in time is deleted. The previous carried snapshot
+// is deleted only once the new one is recorded, so a failure here leaves the
+// last good snapshot in place.
+func (a *app) snapshotBeforeCleanup(ctx context.Context, client *vultrClient, cutoff time.Time) error {
+	matches, err := client.instancesWithLabelPrefix(ctx, labelPrefix)
+	var instance *vultrInstance
+	if err == nil {
+		instance, err = bestInstance(matches)
+	}
+	if errors.Is(err, errInstanceNotFound) {
+		a.logger.Info("no paropal instance to snapshot before cleanup")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find instance to snapshot: %w", err)
+	}
+
+	snapshot, err := client.createSnapshot(ctx, instance.ID, instance.Label)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	a.logger.Warn("snapshot requested before cleanup",
+		"instance_id", instance.ID,
+		"label", instance.Label,
+		"snapshot_id", snapshot.ID,
+	)
+
+	interval := a.snapshotPollInterval
+	if interval <= 0 {
+		interval = defaultSnapshotPollInterval
+	}
+	timeout := a.snapshotTimeout
+	if timeout <= 0 {
+		timeout = defaultSnapshotTimeout
+	}
+	now := a.clock().Now()
+	deadline := now.Add(timeout)
+	if half := now.Add(cutoff.Sub(now) / 2); half.Before(deadline) {
+		deadline = half
+	}
+
+	for snapshot.Status != "complete" {
+		if snapshot.Status != "" && snapshot.Status != "pending" {
+			a.discardSnapshot(ctx, client, snapshot.ID)
+			return fmt.Errorf("snapshot %s failed with status %q", snapshot.ID, snapshot.Status)
+		}
+		if !a.sleepWithContextUntil(ctx, interval, deadline) {
+			a.discardSnapshot(ctx, client, snapshot.ID)
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("snapshot %s not complete: %w", snapshot.ID, err)
+			}
+			return fmt.Errorf("snapshot %s not complete within %s", snapshot.ID, deadline.Sub(now).Round(time.Second))
+		}
+		polled, err := client.getSnapshot(ctx, snapshot.ID)
+		if err != nil {
+			a.logger.Warn("snapshot status check failed", "snapshot_id", snapshot.ID, "error", err)
+			continue
+		}
+		snapshot = polled
+	}
+
+	previous, err := a.snapshots.replace(carriedSnapshot{
+		ID:         snapshot.ID,
+		InstanceID: instance.ID,
+		Label:      instance.Label,
+		CreatedAt:  a.clock().Now(),
+	})
+	if err != nil {
+		return err
+	}
+	a.logger.Warn("snapshot complete; next provision will boot from it", "snapshot_id", snapshot.ID)
+
+	if previous.ID != "" && previous.ID != snapshot.ID {
+		if err := client.deleteSnapshot(ctx, previous.ID); err != nil && !isNotFoundError(err) {
+			a.logger.Error("failed to delete superseded snapshot", "snapshot_id", previous.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// discardSnapshot deletes a snapshot cleanup gave up on, so an unfinished or
+// failed one is not left on the account. It still runs once ctx is done.
+func (a *app) discardSnapshot(ctx context.Context, client *vultrClient, snapshotID string) {
+	if err := client.deleteSnapshot(context.WithoutCancel(ctx), snapshotID); err != nil && !isNotFoundError(err) {
+		a.logger.Error("failed to delete unfinished snapshot", "snapshot_id", snapshotID, "error", err)
+		return
+	}
+	a.logger.Warn("deleted unfinished snapshot", "snapshot_id", snapshotID)
+}
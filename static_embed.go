@@ -12,6 +12,20 @@ var sjbTarGz []byte
 
 func (a *app) handleSjbTar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/gzip")
+	// The whole archive is in memory, so the advertised length is exact; if the
+	// write is cut short the connection is dropped and clients see truncation.
 	w.Header().Set("Content-Length", strconv.Itoa(len(sjbTarGz)))
-	_, _ = w.Write(sjbTarGz)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	n, err := w.Write(sjbTarGz)
+	if err != nil {
+		a.logger.Warn("bootstrap archive download interrupted",
+			"written_bytes", n,
+			"total_bytes", len(sjbTarGz),
+			"remote_addr", r.RemoteAddr,
+			"error", err,
+		)
+	}
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// statusInstance is the instance block of GET /api/status.
+type statusInstance struct {
+	Status      string `json:"status"`
+	PowerStatus string `json:"power_status"`
+	IP          string `json:"ip"`
+	Label       string `json:"label"`
+	SSHPort     int    `json:"ssh_port"`
+	SSHUser     string `json:"ssh_user"`
+}
+
+// statusResponse is the dashboard's single round trip: charges, the current
+// paropal instance and the next scheduled runs.
+type statusResponse struct {
+	PendingCharges *float64        `json:"pending_charges"`
+	ChargesStale   bool            `json:"charges_stale"`
+	Instance       *statusInstance `json:"instance"`
+	InstanceError  string          `json:"instance_error,omitempty"`
+	NextCleanup    string          `json:"next_cleanup"`
+	NextProvision  string          `json:"next_provision"`
+}
+
+// handleStatus combines /api/charges and /api/instance with the next run
+// times. A Vultr failure blanks only its own part: pending_charges falls back
+// to the cached value or null, and instance is null with instance_error set.
+// A missing instance is a null instance, not an error.
+func (a *app) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var status statusResponse
+
+	if charges, err := a.fetchCharges(r.Context()); err == nil {
+		status.PendingCharges = &charges
+	} else {
+		a.logger.Error("failed to fetch pending charges", "error", err)
+		if cached, _, ok := a.charges.load(); ok {
+			status.PendingCharges = &cached
+			status.ChargesStale = true
+		}
+	}
+
+	matches, err := a.vultr.instancesWithLabelPrefix(r.Context(), labelPrefix)
+	var instance *vultrInstance
+	if err == nil {
+		instance, err = bestInstance(matches)
+	}
+	switch {
+	case err == nil:
+		status.Instance = &statusInstance{
+			Status:      instance.Status,
+			PowerStatus: instance.PowerStatus,
+			IP:          instance.MainIP,
+			Label:       instance.Label,
+			SSHPort:     a.sshListenPort(),
+			SSHUser:     a.sshUser(),
+		}
+	case !errors.Is(err, errInstanceNotFound):
+		a.logger.Error("failed to fetch instance", "error", err)
+		status.InstanceError = "failed to fetch instances from Vultr"
+	}
+
+	now := a.clock().Now()
+	status.NextCleanup = nextCleanupTimeKST(now, a.cleanupLoc, a.schedule.cleanupAt).In(a.cleanupLoc).Format(time.RFC3339)
+	status.NextProvision = nextProvisionTimeKST(now, a.cleanupLoc, a.schedule.provisionAt).In(a.cleanupLoc).Format(time.RFC3339)
+
+	writeJSON(w, http.StatusOK, status)
+}
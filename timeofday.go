@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// timeOfDay is a wall-clock time within a day, as configured with HH:MM.
+type timeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+// dailySchedule is when the daily runs happen: cleanup at cleanupAt, which
+// must lie inside window, and provision at provisionAt. All are KST.
+type dailySchedule struct {
+	cleanupAt   timeOfDay
+	provisionAt timeOfDay
+	window      timeWindow
+}
+
+// defaultSchedule is the compiled-in schedule, used for anything
+// PAROPAL_CLEANUP_TIME, PAROPAL_PROVISION_TIME and the
+// PAROPAL_CLEANUP_WINDOW_* options leave unset.
+var defaultSchedule = dailySchedule{
+	cleanupAt:   timeOfDay{Hour: cleanupHourKST, Minute: cleanupMinuteKST},
+	provisionAt: timeOfDay{Hour: createHourKST, Minute: createMinuteKST},
+	window: timeWindow{
+		Start: timeOfDay{Hour: cleanupWindowStartHourKST, Minute: cleanupWindowStartMinuteKST},
+		End:   timeOfDay{Hour: cleanupWindowEndHourKST, Minute: cleanupWindowEndMinuteKST},
+	},
+}
+
+func (t timeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+// minutes returns the time as minutes since midnight.
+func (t timeOfDay) minutes() int {
+	return t.Hour*60 + t.Minute
+}
+
+// timeWindow is a same-day [Start, End) range, as configured with
+// HH:MM-HH:MM.
+type timeWindow struct {
+	Start timeOfDay
+	End   timeOfDay
+}
+
+func (w timeWindow) String() string {
+	return w.Start.String() + "-" + w.End.String()
+}
+
+// parseTimeOfDay parses an HH:MM value for the config option named field.
+// Errors name the field and say what was wrong with the value.
+func parseTimeOfDay(field, raw string) (timeOfDay, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return timeOfDay{}, fmt.Errorf("%s: empty value, want HH:MM", field)
+	}
+
+	hourPart, minutePart, ok := strings.Cut(value, ":")
+	if !ok {
+		return timeOfDay{}, fmt.Errorf("%s: %q is missing the colon in HH:MM", field, value)
+	}
+	if len(hourPart) == 0 || len(hourPart) > 2 {
+		return timeOfDay{}, fmt.Errorf("%s: %q needs a one- or two-digit hour", field, value)
+	}
+	if len(minutePart) != 2 {
+		return timeOfDay{}, fmt.Errorf("%s: %q needs a two-digit minute", field, value)
+	}
+
+	hour, err := strconv.Atoi(hourPart)
+	if err != nil || hour < 0 {
+		return timeOfDay{}, fmt.Errorf("%s: hour %q is not a number", field, hourPart)
+	}
+	if hour > 23 {
+		return timeOfDay{}, fmt.Errorf("%s: hour %d is out of range 0-23", field, hour)
+	}
+	minute, err := strconv.Atoi(minutePart)
+	if err != nil || minute < 0 {
+		return timeOfDay{}, fmt.Errorf("%s: minute %q is not a number", field, minutePart)
+	}
+	if minute > 59 {
+		return timeOfDay{}, fmt.Errorf("%s: minute %d is out of range 0-59", field, minute)
+	}
+
+	return timeOfDay{Hour: hour, Minute: minute}, nil
+}
+
+// parseWindow parses an HH:MM-HH:MM value for the config option named field.
+// The window must not wrap midnight, so its end has to come after its start.
+func parseWindow(field, raw string) (timeWindow, error) {
+	value := strings.TrimSpace(raw)
+	startPart, endPart, ok := strings.Cut(value, "-")
+	if !ok {
+		return timeWindow{}, fmt.Errorf("%s: %q is missing the '-' in HH:MM-HH:MM", field, value)
+	}
+
+	start, err := parseTimeOfDay(field+" start", startPart)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	end, err := parseTimeOfDay(field+" end", endPart)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	if end.minutes() <= start.minutes() {
+		return timeWindow{}, fmt.Errorf("%s: end %s is not after start %s", field, end, start)
+	}
+
+	return timeWindow{Start: start, End: end}, nil
+}
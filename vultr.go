@@ -9,7 +9,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func (c *vultrClient) pendingCharges(ctx context.Context) (float64, error) {
@@ -22,18 +24,43 @@ func (c *vultrClient) pendingCharges(ctx context.Context) (float64, error) {
 }
 
 func (c *vultrClient) firstInstanceWithLabelPrefix(ctx context.Context, prefix string) (*vultrInstance, error) {
+	matches, err := c.instancesWithLabelPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return bestInstance(matches)
+}
+
+func (c *vultrClient) instancesWithLabelPrefix(ctx context.Context, prefix string) ([]vultrInstance, error) {
 	instances, err := c.listAllInstances(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	matches := make([]vultrInstance, 0, len(instances))
+	for _, instance := range instances {
+		if strings.HasPrefix(instance.Label, prefix) && !isPinnedLabel(instance.Label, c.pinnedMarker) {
+			matches = append(matches, instance)
+		}
+	}
+
+	return matches, nil
+}
+
+// isPinnedLabel reports whether label carries the pinned marker, which keeps
+// an instance out of the daily cleanup and provision cycle. An empty marker
+// pins nothing.
+func isPinnedLabel(label, marker string) bool {
+	return marker != "" && strings.Contains(label, marker)
+}
+
+// bestInstance picks the most usable instance out of candidates, returning
+// errInstanceNotFound when there are none.
+func bestInstance(instances []vultrInstance) (*vultrInstance, error) {
 	var best *vultrInstance
 	for i := range instances {
 		instance := &instances[i]
-		if !strings.HasPrefix(instance.Label, prefix) {
-			continue
-		}
-
 		if best == nil {
 			best = instance
 			continue
@@ -76,6 +103,10 @@ func (c *vultrClient) listAllInstances(ctx context.Context) ([]vultrInstance, er
 		path := "/instances?" + params.Encode()
 		var response listInstancesResponse
 		if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+			if len(instances) > 0 {
+				// Hand back what earlier pages returned so callers can opt in to acting on it.
+				return instances, fmt.Errorf("%w after %d instances: %w", errIncompleteInstanceList, len(instances), err)
+			}
 			return nil, err
 		}
 
@@ -94,6 +125,50 @@ func (c *vultrClient) listAllInstances(ctx context.Context) ([]vultrInstance, er
 	return instances, nil
 }
 
+type getInstanceResponse struct {
+	Instance vultrInstance `json:"instance"`
+}
+
+// getInstance looks up a single instance by ID, so callers that already hold
+// an ID need not list the account. A 404 is reported as errInstanceNotFound.
+func (c *vultrClient) getInstance(ctx context.Context, instanceID string) (*vultrInstance, error) {
+	if strings.TrimSpace(instanceID) == "" {
+		return nil, errors.New("instance id cannot be empty")
+	}
+
+	path := "/instances/" + url.PathEscape(instanceID)
+	var response getInstanceResponse
+	if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+		if isNotFoundError(err) {
+			return nil, errInstanceNotFound
+		}
+		return nil, err
+	}
+
+	return &response.Instance, nil
+}
+
+// getInstanceRaw returns the instance exactly as Vultr reports it, including
+// fields vultrInstance does not model.
+func (c *vultrClient) getInstanceRaw(ctx context.Context, instanceID string) (map[string]any, error) {
+	if strings.TrimSpace(instanceID) == "" {
+		return nil, errors.New("instance id cannot be empty")
+	}
+
+	path := "/instances/" + url.PathEscape(instanceID)
+	var response struct {
+		Instance map[string]any `json:"instance"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+		if isNotFoundError(err) {
+			return nil, errInstanceNotFound
+		}
+		return nil, err
+	}
+
+	return response.Instance, nil
+}
+
 func (c *vultrClient) deleteInstance(ctx context.Context, instanceID string) error {
 	if strings.TrimSpace(instanceID) == "" {
 		return errors.New("instance id cannot be empty")
@@ -112,14 +187,40 @@ func (c *vultrClient) reinstallInstance(ctx context.Context, instanceID string)
 	return c.doJSON(ctx, http.MethodPost, path, struct{}{}, nil)
 }
 
+func (c *vultrClient) startInstance(ctx context.Context, instanceID string) error {
+	return c.instanceAction(ctx, instanceID, "start")
+}
+
+func (c *vultrClient) haltInstance(ctx context.Context, instanceID string) error {
+	return c.instanceAction(ctx, instanceID, "halt")
+}
+
+func (c *vultrClient) rebootInstance(ctx context.Context, instanceID string) error {
+	return c.instanceAction(ctx, instanceID, "reboot")
+}
+
+// instanceAction posts an empty body to /instances/{id}/{action}.
+func (c *vultrClient) instanceAction(ctx context.Context, instanceID, action string) error {
+	if strings.TrimSpace(instanceID) == "" {
+		return errors.New("instance id cannot be empty")
+	}
+
+	path := "/instances/" + url.PathEscape(instanceID) + "/" + action
+	return c.doJSON(ctx, http.MethodPost, path, struct{}{}, nil)
+}
+
 type createInstanceRequest struct {
-	Region     string   `json:"region"`
-	Plan       string   `json:"plan"`
-	OSID       int      `json:"os_id"`
-	Label      string   `json:"label"`
-	SSHKeyID   []string `json:"sshkey_id,omitempty"`
-	UserScheme string   `json:"user_scheme,omitempty"`
-	UserData   string   `json:"user_data,omitempty"`
+	Region          string   `json:"region"`
+	Plan            string   `json:"plan"`
+	OSID            int      `json:"os_id,omitempty"`
+	SnapshotID      string   `json:"snapshot_id,omitempty"`
+	Label           string   `json:"label"`
+	SSHKeyID        []string `json:"sshkey_id,omitempty"`
+	UserScheme      string   `json:"user_scheme,omitempty"`
+	UserData        string   `json:"user_data,omitempty"`
+	ScriptID        string   `json:"script_id,omitempty"`
+	FirewallGroupID string   `json:"firewall_group_id,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
 }
 
 type createInstanceResponse struct {
@@ -162,6 +263,183 @@ func (c *vultrClient) attachBlockStorage(ctx context.Context, blockStorageID, in
 	}, nil)
 }
 
+// detachBlockStorage detaches the block from whatever instance it is
+// attached to.
+func (c *vultrClient) detachBlockStorage(ctx context.Context, blockStorageID string, live bool) error {
+	if strings.TrimSpace(blockStorageID) == "" {
+		return errors.New("block storage id cannot be empty")
+	}
+
+	path := "/blocks/" + url.PathEscape(blockStorageID) + "/detach"
+	return c.doJSON(ctx, http.MethodPost, path, struct {
+		Live bool `json:"live"`
+	}{Live: live}, nil)
+}
+
+type vultrBlock struct {
+	ID                 string `json:"id"`
+	Status             string `json:"status"`
+	Label              string `json:"label"`
+	AttachedToInstance string `json:"attached_to_instance"`
+}
+
+type getBlockResponse struct {
+	Block vultrBlock `json:"block"`
+}
+
+func (c *vultrClient) getBlockStorage(ctx context.Context, blockStorageID string) (*vultrBlock, error) {
+	if strings.TrimSpace(blockStorageID) == "" {
+		return nil, errors.New("block storage id cannot be empty")
+	}
+
+	path := "/blocks/" + url.PathEscape(blockStorageID)
+	var response getBlockResponse
+	if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.Block, nil
+}
+
+type vultrReservedIP struct {
+	ID         string `json:"id"`
+	Label      string `json:"label"`
+	Subnet     string `json:"subnet"`
+	InstanceID string `json:"instance_id"`
+}
+
+type listReservedIPsResponse struct {
+	ReservedIPs []vultrReservedIP `json:"reserved_ips"`
+	Meta        struct {
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"meta"`
+}
+
+func (c *vultrClient) listReservedIPs(ctx context.Context) ([]vultrReservedIP, error) {
+	cursor := ""
+	var ips []vultrReservedIP
+
+	for {
+		params := url.Values{}
+		params.Set("per_page", "100")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		var response listReservedIPsResponse
+		if err := c.do(ctx, http.MethodGet, "/reserved-ips?"+params.Encode(), &response); err != nil {
+			return nil, err
+		}
+		ips = append(ips, response.ReservedIPs...)
+
+		nextCursor, err := extractCursor(response.Meta.Links.Next)
+		if err != nil {
+			return nil, err
+		}
+		if nextCursor == "" {
+			return ips, nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func (c *vultrClient) deleteReservedIP(ctx context.Context, reservedIPID string) error {
+	if strings.TrimSpace(reservedIPID) == "" {
+		return errors.New("reserved ip id cannot be empty")
+	}
+
+	return c.do(ctx, http.MethodDelete, "/reserved-ips/"+url.PathEscape(reservedIPID), nil)
+}
+
+type vultrFirewallRule struct {
+	ID         int    `json:"id,omitempty"`
+	IPType     string `json:"ip_type"`
+	Protocol   string `json:"protocol"`
+	Subnet     string `json:"subnet"`
+	SubnetSize int    `json:"subnet_size"`
+	Port       string `json:"port"`
+	Notes      string `json:"notes,omitempty"`
+}
+
+type listFirewallRulesResponse struct {
+	FirewallRules []vultrFirewallRule `json:"firewall_rules"`
+	Meta          struct {
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"meta"`
+}
+
+func (c *vultrClient) listFirewallRules(ctx context.Context, firewallGroupID string) ([]vultrFirewallRule, error) {
+	if strings.TrimSpace(firewallGroupID) == "" {
+		return nil, errors.New("firewall group id cannot be empty")
+	}
+
+	cursor := ""
+	var rules []vultrFirewallRule
+	for {
+		params := url.Values{}
+		params.Set("per_page", "100")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		var response listFirewallRulesResponse
+		path := "/firewalls/" + url.PathEscape(firewallGroupID) + "/rules?" + params.Encode()
+		if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+			return nil, err
+		}
+		rules = append(rules, response.FirewallRules...)
+
+		nextCursor, err := extractCursor(response.Meta.Links.Next)
+		if err != nil {
+			return nil, err
+		}
+		if nextCursor == "" {
+			return rules, nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func (c *vultrClient) createFirewallRule(ctx context.Context, firewallGroupID string, rule vultrFirewallRule) error {
+	if strings.TrimSpace(firewallGroupID) == "" {
+		return errors.New("firewall group id cannot be empty")
+	}
+
+	path := "/firewalls/" + url.PathEscape(firewallGroupID) + "/rules"
+	return c.doJSON(ctx, http.MethodPost, path, rule, nil)
+}
+
+type instanceBandwidthResponse struct {
+	Bandwidth map[string]struct {
+		IncomingBytes int64 `json:"incoming_bytes"`
+		OutgoingBytes int64 `json:"outgoing_bytes"`
+	} `json:"bandwidth"`
+}
+
+// instanceBandwidth returns the total bytes the instance has transferred
+// across every day Vultr reports for it.
+func (c *vultrClient) instanceBandwidth(ctx context.Context, instanceID string) (int64, error) {
+	if strings.TrimSpace(instanceID) == "" {
+		return 0, errors.New("instance id cannot be empty")
+	}
+
+	path := "/instances/" + url.PathEscape(instanceID) + "/bandwidth"
+	var response instanceBandwidthResponse
+	if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, day := range response.Bandwidth {
+		total += day.IncomingBytes + day.OutgoingBytes
+	}
+	return total, nil
+}
+
 func (c *vultrClient) do(ctx context.Context, method, path string, dest any) error {
 	return c.doRequest(ctx, method, path, "", nil, dest)
 }
@@ -179,12 +457,60 @@ func (c *vultrClient) doJSON(ctx context.Context, method, path string, request a
 	return c.doRequest(ctx, method, path, "application/json", body, dest)
 }
 
+// doRequest sends one request to Vultr. GETs and body-less DELETEs are
+// retried up to maxRetries times on transient failures, waiting retryBackoff
+// and doubling it between attempts. Other methods, creates above all, are
+// never retried here, since a repeat could duplicate what the first did.
 func (c *vultrClient) doRequest(ctx context.Context, method, path, contentType string, body io.Reader, dest any) error {
+	if c.readOnly && method != http.MethodGet {
+		return fmt.Errorf("%s %s: %w", method, path, errReadOnly)
+	}
+
+	idempotent := method == http.MethodGet || (method == http.MethodDelete && body == nil)
+	wait := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.doRequestOnce(ctx, method, path, contentType, body, dest)
+		if err == nil || !retry || !idempotent || attempt >= c.maxRetries {
+			return err
+		}
+		if c.logger != nil {
+			c.logger.Warn("transient vultr error; retrying",
+				"method", method,
+				"path", path,
+				"attempt", attempt+1,
+				"retry_in", wait.String(),
+				"error", err,
+			)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// doRequestOnce makes a single attempt. retry reports whether the failure is
+// transient: a network error or a 502, 503 or 504.
+func (c *vultrClient) doRequestOnce(ctx context.Context, method, path, contentType string, body io.Reader, dest any) (retry bool, err error) {
 	endpoint := c.baseURL + path
+	op := vultrOperation(method, path)
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.timeoutFor(op))
+	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	start := time.Now()
+	if c.requestDurations != nil {
+		defer func() { c.requestDurations.WithLabelValues(op).Observe(time.Since(start).Seconds()) }()
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, method, endpoint, body)
 	if err != nil {
-		return fmt.Errorf("build request: %w", err)
+		return false, fmt.Errorf("build request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Accept", "application/json")
@@ -194,28 +520,203 @@ func (c *vultrClient) doRequest(ctx context.Context, method, path, contentType s
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("request %s failed: %w", path, err)
+		// A timeout of this attempt is retryable; cancellation of the
+		// caller's context is not.
+		return ctx.Err() == nil, fmt.Errorf("request %s failed: %w", path, err)
 	}
 	defer resp.Body.Close()
 
+	c.observeRateLimit(path, resp)
+
+	unavailable := int32(0)
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		unavailable = c.unavailableStreak.Add(1)
+	} else {
+		c.unavailableStreak.Store(0)
+	}
+
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return fmt.Errorf("vultr %s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+		err := newVultrAPIError(path, resp.StatusCode, body)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return false, &rateLimitError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), err: err}
+		}
+		if c.maintenanceAfter > 0 && int(unavailable) >= c.maintenanceAfter {
+			return false, fmt.Errorf("%w: %w", errVultrMaintenance, err)
+		}
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, err
+		}
+		return false, err
 	}
+	c.lastSuccess.Store(time.Now().UnixNano())
 
 	if dest == nil {
 		io.Copy(io.Discard, resp.Body)
-		return nil
+		return false, nil
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
 		if errors.Is(err, io.EOF) {
-			return nil
+			return false, nil
 		}
-		return fmt.Errorf("decode %s response: %w", path, err)
+		return false, fmt.Errorf("decode %s response: %w", path, err)
+	}
+
+	return false, nil
+}
+
+// vultrOperation names the kind of call for timeout lookup.
+func vultrOperation(method, path string) string {
+	p, _, _ := strings.Cut(path, "?")
+	switch {
+	case method == http.MethodPost && p == "/instances":
+		return "create"
+	case method == http.MethodPost && (strings.HasSuffix(p, "/attach") || strings.HasSuffix(p, "/detach")):
+		return "attach"
+	case method == http.MethodPost && strings.HasSuffix(p, "/reinstall"):
+		return "reinstall"
+	case method == http.MethodDelete:
+		return "delete"
+	case method == http.MethodGet && p == "/instances":
+		return "list"
+	default:
+		return "get"
+	}
+}
+
+func (c *vultrClient) timeoutFor(op string) time.Duration {
+	if d, ok := c.timeouts[op]; ok && d > 0 {
+		return d
+	}
+	if d, ok := defaultVultrTimeouts[op]; ok {
+		return d
+	}
+	return requestTimeout
+}
+
+// lastSuccessAt reports when Vultr last answered with a 2xx, or the zero time
+// if it has not yet.
+func (c *vultrClient) lastSuccessAt() time.Time {
+	n := c.lastSuccess.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// observeRateLimit warns when Vultr reports that the account is throttled or
+// close to it, so operators can widen intervals before requests start failing.
+func (c *vultrClient) observeRateLimit(path string, resp *http.Response) {
+	if c.logger == nil {
+		return
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.logger.Warn("vultr rate limit exceeded",
+			"path", path,
+			"retry_after", resp.Header.Get("Retry-After"),
+		)
+		return
+	}
+
+	if c.rateLimitWarnRemaining <= 0 {
+		return
+	}
+	raw := resp.Header.Get("RateLimit-Remaining")
+	if raw == "" {
+		raw = resp.Header.Get("X-RateLimit-Remaining")
+	}
+	if raw == "" {
+		return
+	}
+	remaining, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return
+	}
+	if remaining < c.rateLimitWarnRemaining {
+		c.logger.Warn("approaching vultr rate limit",
+			"path", path,
+			"remaining", remaining,
+			"warn_below", c.rateLimitWarnRemaining,
+		)
+	}
+}
+
+// vultrAPIError is a non-2xx response from Vultr. Message is the "error"
+// field of Vultr's JSON error body, or the raw body when it is not one.
+type vultrAPIError struct {
+	StatusCode int
+	Message    string
+	Path       string
+}
+
+func newVultrAPIError(path string, statusCode int, body []byte) *vultrAPIError {
+	var decoded struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &decoded) == nil && strings.TrimSpace(decoded.Error) != "" {
+		message = strings.TrimSpace(decoded.Error)
+	}
+	return &vultrAPIError{StatusCode: statusCode, Message: message, Path: path}
+}
+
+func (e *vultrAPIError) Error() string {
+	return fmt.Sprintf("vultr %s returned %d %s: %s", e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// vultrErrorMessage returns the lowercased message of the Vultr API error in
+// err's chain; ok is false when there is none.
+func vultrErrorMessage(err error) (message string, ok bool) {
+	var apiErr *vultrAPIError
+	if !errors.As(err, &apiErr) {
+		return "", false
 	}
+	return strings.ToLower(apiErr.Message), true
+}
+
+// rateLimitError is returned for a 429 and carries the delay Vultr asked for
+// in Retry-After (zero when it gave none).
+type rateLimitError struct {
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *rateLimitError) Error() string { return e.err.Error() }
+
+func (e *rateLimitError) Unwrap() error { return e.err }
+
+// parseRetryAfter reads a Retry-After value given either in seconds or as an
+// HTTP date. Unparseable or past values yield zero.
+func parseRetryAfter(raw string, now time.Time) time.Duration {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(raw); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// rateLimitWait stretches backoff to at least the Retry-After delay when err
+// is a 429 from Vultr.
+func rateLimitWait(err error, backoff time.Duration) time.Duration {
+	var limited *rateLimitError
+	if errors.As(err, &limited) && limited.retryAfter > backoff {
+		return limited.retryAfter
+	}
+	return backoff
+}
 
-	return nil
+func isNotFoundError(err error) bool {
+	var apiErr *vultrAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
 }
 
 func extractCursor(nextLink string) (string, error) {
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runWarmup fetches pending charges and the paropal instance once, warmupDelay
+// after startup, so the charges cache holds a value and the connection to
+// Vultr is open before the first dashboard request. It does nothing when
+// warmupDelay is unset.
+func (a *app) runWarmup(ctx context.Context) {
+	if a.warmupDelay <= 0 {
+		return
+	}
+	if !a.waitUntil(ctx, a.clock().Now().Add(a.warmupDelay)) {
+		return
+	}
+
+	start := a.clock().Now()
+	charges, chargesErr := a.fetchCharges(ctx)
+	_, instancesErr := a.vultr.instancesWithLabelPrefix(ctx, labelPrefix)
+	if ctx.Err() != nil {
+		return
+	}
+	if chargesErr != nil || instancesErr != nil {
+		a.logger.Warn("startup warm-up incomplete",
+			"charges_error", chargesErr,
+			"instances_error", instancesErr,
+		)
+		return
+	}
+	a.logger.Info("startup warm-up complete",
+		"pending_charges", charges,
+		"elapsed", a.clock().Now().Sub(start).Round(time.Millisecond).String(),
+	)
+}